@@ -18,15 +18,21 @@
 //	# Specify block reference
 //	go run ./cmd/verify_proof/ 0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826 "" 0x1234
 //
+//	# Read state variables through proofs, using the solc storage layout
+//	go run ./cmd/verify_proof/ --layout Token.layout.json --var 'balances[0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826]' 0x77045E71a7A2c50903d88e564cD72fab11e82051
+//
 // Flags:
 //
 //	--rpc-url    RPC endpoint URL (default: http://localhost:4444)
 //	--no-verify  Skip proof verification, just fetch and display
+//	--layout     solc storageLayout JSON of the contract
+//	--var        State variable to read with the layout; can be repeated
 package main
 
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"math/big"
@@ -37,6 +43,8 @@ import (
 	"gorsk/ethclient"
 	"gorsk/rskblocks"
 
+	"github.com/ethereum-optimism/optimism/op-service/rsk/gorsk/rsktrie"
+
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 )
@@ -46,6 +54,9 @@ func main() {
 	rpcURL := flag.String("rpc-url", "http://localhost:4444", "RSKj RPC endpoint URL")
 	noVerify := flag.Bool("no-verify", false, "Skip proof verification")
 	rawJSON := flag.Bool("json", false, "Output raw JSON response")
+	layoutFile := flag.String("layout", "", "solc storageLayout JSON of the contract")
+	var variables stringList
+	flag.Var(&variables, "var", "State variable to read with --layout, e.g. 'balances[0xabc...]'; can be repeated")
 	flag.Parse()
 
 	args := flag.Args()
@@ -106,7 +117,7 @@ func main() {
 	}
 
 	// Display proof information
-	fmt.Println("\n=== Account Info ===")
+	fmt.Println("\n=== Account Info (reported by RPC) ===")
 	fmt.Printf("Address:      %s\n", proof.Address.Hex())
 	fmt.Printf("Balance:      %s wei\n", proof.GetBalance().String())
 	fmt.Printf("Nonce:        %d\n", proof.GetNonce())
@@ -158,8 +169,21 @@ func main() {
 
 	if accountResult.Valid {
 		fmt.Println("\nAccount Proof: VALID")
-		if len(accountResult.Value) > 0 {
+		if accountResult.Account != nil {
 			fmt.Printf("  Value (RLP): %s\n", hexutil.Encode(accountResult.Value))
+			fmt.Printf("  Balance:     %s wei\n", accountResult.Account.Balance.String())
+			fmt.Printf("  Nonce:       %d\n", accountResult.Account.Nonce)
+			fmt.Printf("  Hibernated:  %v\n", accountResult.Account.IsHibernated())
+		} else {
+			fmt.Println("  Account does not exist")
+		}
+
+		// The RPC fields printed above are only trusted if they match the proof
+		if err := proof.CheckAccountFields(accountResult); err != nil {
+			fmt.Printf("  RPC fields:  MISMATCH (%v)\n", err)
+			accountResult.Valid = false
+		} else {
+			fmt.Println("  RPC fields:  match the proof")
 		}
 	} else {
 		fmt.Println("\nAccount Proof: INVALID")
@@ -168,8 +192,32 @@ func main() {
 		}
 	}
 
+	// Verify the code hash, whose node is embedded in the account proof
+	codeResult, err := verifier.VerifyCodeProof(stateRoot, address, proof.CodeHash, nil, accountProofNodes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Code proof verification error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if codeResult.Valid {
+		fmt.Println("\nCode Proof: VALID")
+		if codeResult.Absent && codeResult.CodeHash == (common.Hash{}) {
+			fmt.Println("  Account does not exist")
+		} else if codeResult.Absent {
+			fmt.Println("  Account has no code")
+		} else {
+			fmt.Printf("  CodeHash:    %s\n", codeResult.CodeHash.Hex())
+			fmt.Printf("  Code Length: %d bytes\n", codeResult.CodeLength)
+		}
+	} else {
+		fmt.Println("\nCode Proof: INVALID")
+		if codeResult.Error != nil {
+			fmt.Printf("  Error: %v\n", codeResult.Error)
+		}
+	}
+
 	// Verify storage proofs
-	allValid := accountResult.Valid
+	allValid := accountResult.Valid && codeResult.Valid
 	for _, sp := range proof.StorageProof {
 		keyHash := common.HexToHash(sp.Key)
 		proofNodes, err := rskblocks.DecodeRLPProofNodes(sp.Proofs)
@@ -198,6 +246,41 @@ func main() {
 		}
 	}
 
+	// Verify the storage hash; storage proofs cover the storage root node
+	storageProofs := [][][]byte{accountProofNodes}
+	for _, sp := range proof.StorageProof {
+		if proofNodes, err := rskblocks.DecodeRLPProofNodes(sp.Proofs); err == nil {
+			storageProofs = append(storageProofs, proofNodes)
+		}
+	}
+	storageRootResult, err := verifier.VerifyStorageRoot(stateRoot, address, proof.StorageHash, storageProofs...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Storage root verification error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var missingNode *rsktrie.MissingNodeError
+	switch {
+	case storageRootResult.Valid:
+		fmt.Println("\nStorage Root: VALID")
+		fmt.Printf("  StorageHash: %s\n", storageRootResult.StorageHash.Hex())
+		fmt.Printf("  Contract:    %v\n", storageRootResult.IsContract)
+		fmt.Printf("  Has Storage: %v\n", storageRootResult.HasStorage)
+	case errors.As(storageRootResult.Error, &missingNode):
+		fmt.Println("\nStorage Root: not covered by the proofs (pass a storage key to verify it)")
+	default:
+		fmt.Println("\nStorage Root: INVALID")
+		fmt.Printf("  Error: %v\n", storageRootResult.Error)
+		allValid = false
+	}
+
+	// Read state variables through verified storage proofs
+	if *layoutFile != "" {
+		if !readVariables(ctx, client, stateRoot, address, blockRef, *layoutFile, variables) {
+			allValid = false
+		}
+	}
+
 	// Final summary
 	fmt.Println("\n=== Summary ===")
 	if allValid {
@@ -208,6 +291,69 @@ func main() {
 	}
 }
 
+// stringList is a flag that can be repeated
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// readVariables resolves state variables with a solc storage layout and reads
+// them through storage proofs. It reports whether all reads were verified.
+func readVariables(
+	ctx context.Context,
+	client *rskblocks.ProofClient,
+	stateRoot common.Hash,
+	address common.Address,
+	blockRef string,
+	layoutFile string,
+	variables []string,
+) bool {
+	fmt.Println("\n=== State Variables ===")
+	data, err := os.ReadFile(layoutFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read layout: %v\n", err)
+		return false
+	}
+	layout, err := rskblocks.ParseStorageLayout(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return false
+	}
+
+	reader := client.NewStorageReader(ctx, stateRoot, address, blockRef)
+	allValid := true
+	for _, path := range variables {
+		v, err := layout.Resolve(path)
+		if err != nil {
+			fmt.Printf("%s: %v\n", path, err)
+			allValid = false
+			continue
+		}
+		value, err := reader.ReadVariable(v)
+		if err != nil {
+			fmt.Printf("%s: NOT VERIFIED (%v)\n", path, err)
+			allValid = false
+			continue
+		}
+
+		switch value := value.(type) {
+		case []byte:
+			fmt.Printf("%s = %s (%s, slot %s)\n", path, hexutil.Encode(value), v.Type.Label, v.Location.Slot.Hex())
+		case string:
+			fmt.Printf("%s = %q (%s, slot %s)\n", path, value, v.Type.Label, v.Location.Slot.Hex())
+		default:
+			fmt.Printf("%s = %v (%s, slot %s)\n", path, value, v.Type.Label, v.Location.Slot.Hex())
+		}
+	}
+	return allValid
+}
+
 // getStateRoot fetches the state root from a block header using the RSK ethclient
 func getStateRoot(ctx context.Context, rpcURL, blockRef string) (common.Hash, error) {
 	client, err := ethclient.DialContext(ctx, rpcURL)
@@ -119,7 +119,7 @@ type rpcLog struct {
 
 func main() {
 	if len(os.Args) < 2 {
-		log.Fatal("Usage: verify_roots <block_number>")
+		log.Fatal("Usage: verify_roots <block_number> [regtest|testnet|mainnet]")
 	}
 
 	blockNum, err := strconv.ParseInt(os.Args[1], 10, 64)
@@ -127,7 +127,13 @@ func main() {
 		log.Fatalf("Invalid block number: %v", err)
 	}
 
-	fmt.Printf("Fetching block %d from RSK node at %s\n", blockNum, rpcURL)
+	network := "regtest"
+	if len(os.Args) > 2 {
+		network = os.Args[2]
+	}
+	config := rskblocks.ConfigForBlockNumber(blockNum, network)
+
+	fmt.Printf("Fetching %s block %d from RSK node at %s\n", network, blockNum, rpcURL)
 	fmt.Println(strings.Repeat("=", 60))
 
 	// 1. Get block with full transactions
@@ -143,16 +149,29 @@ func main() {
 	fmt.Printf("Expected ReceiptsRoot: %s\n", block.ReceiptsRoot)
 	fmt.Println()
 
-	// 2. Convert RPC transactions to gorsk Transaction structs
-	transactions := make([]*rskblocks.Transaction, len(block.Transactions))
+	// 2. Convert the RPC block, its transactions and uncles to a gorsk Block
+	rskBlock := &rskblocks.Block{
+		Header:       convertRPCBlockToHeader(block, config),
+		Transactions: make([]*rskblocks.Transaction, len(block.Transactions)),
+		Uncles:       make([]*rskblocks.BlockHeader, len(block.Uncles)),
+	}
 	for i, rpcTx := range block.Transactions {
 		tx, err := convertRPCTxToTransaction(rpcTx)
 		if err != nil {
 			log.Fatalf("Failed to convert transaction %d: %v", i, err)
 		}
-		transactions[i] = tx
+		rskBlock.Transactions[i] = tx
 		fmt.Printf("  Tx %d: %s\n", i, rpcTx.Hash)
 	}
+	for i, uncleHash := range block.Uncles {
+		uncle, err := getUncleByBlockNumberAndIndex(blockNum, i)
+		if err != nil {
+			log.Fatalf("Failed to get uncle %s: %v", uncleHash, err)
+		}
+		uncleConfig := rskblocks.ConfigForBlockNumber(hexToBigInt(uncle.Number).Int64(), network)
+		rskBlock.Uncles[i] = convertRPCBlockToHeader(uncle, uncleConfig)
+		fmt.Printf("  Uncle %d: %s\n", i, uncleHash)
+	}
 
 	// 3. Get receipts for each transaction
 	receipts := make([]*rskblocks.TransactionReceipt, len(block.Transactions))
@@ -168,17 +187,15 @@ func main() {
 	}
 	fmt.Println()
 
-	// 4. Calculate transaction root
-	txRoot := rskblocks.GetTxTrieRoot(transactions)
-	txRootHex := "0x" + hex.EncodeToString(txRoot)
+	// 4. Check the transactions root, uncles and edges against the header
+	bodyErr := rskBlock.Validate(config.UseRskip126TrieHash)
 
 	// 5. Calculate receipt root
-	receiptRoot := rskblocks.CalculateReceiptsTrieRoot(receipts)
+	receiptRoot := rskblocks.CalculateReceiptsTrieRoot(receipts, config.UseRskip126TrieHash)
 	receiptRootHex := "0x" + hex.EncodeToString(receiptRoot)
 
-	// 6. Build block header and compute hash
-	header := convertRPCBlockToHeader(block)
-	computedHash := header.Hash()
+	// 6. Compute the block hash
+	computedHash := rskBlock.Hash()
 	computedHashHex := "0x" + hex.EncodeToString(computedHash[:])
 
 	// 7. Compare results
@@ -195,13 +212,11 @@ func main() {
 		fmt.Printf("  ✗ MISMATCH!\n")
 	}
 
-	fmt.Printf("\nTransaction Root:\n")
-	fmt.Printf("  Expected: %s\n", block.TransactionsRoot)
-	fmt.Printf("  Computed: %s\n", txRootHex)
-	if strings.EqualFold(block.TransactionsRoot, txRootHex) {
+	fmt.Printf("\nBlock Body (transactions root, uncles, edges):\n")
+	if bodyErr == nil {
 		fmt.Printf("  ✓ MATCH!\n")
 	} else {
-		fmt.Printf("  ✗ MISMATCH!\n")
+		fmt.Printf("  ✗ MISMATCH: %v\n", bodyErr)
 	}
 
 	fmt.Printf("\nReceipts Root:\n")
@@ -265,6 +280,22 @@ func getBlockByNumber(blockNum int64) (*rpcBlock, error) {
 	return &block, nil
 }
 
+func getUncleByBlockNumberAndIndex(blockNum int64, index int) (*rpcBlock, error) {
+	blockNumHex := fmt.Sprintf("0x%x", blockNum)
+	indexHex := fmt.Sprintf("0x%x", index)
+	result, err := rpcCall("eth_getUncleByBlockNumberAndIndex", []interface{}{blockNumHex, indexHex})
+	if err != nil {
+		return nil, err
+	}
+
+	var uncle rpcBlock
+	if err := json.Unmarshal(result, &uncle); err != nil {
+		return nil, fmt.Errorf("unmarshal uncle: %w", err)
+	}
+
+	return &uncle, nil
+}
+
 func getTransactionReceipt(txHash string) (*rpcReceipt, error) {
 	result, err := rpcCall("eth_getTransactionReceipt", []interface{}{txHash})
 	if err != nil {
@@ -386,9 +417,7 @@ func createSignedTransaction(rpcTx rpcTx) *rskblocks.Transaction {
 
 // convertRPCBlockToHeader converts an RPC block to a BlockHeader struct
 // using the block_header_hash_helper for proper encoding
-func convertRPCBlockToHeader(block *rpcBlock) *rskblocks.BlockHeader {
-	blockNum := hexToBigInt(block.Number).Int64()
-
+func convertRPCBlockToHeader(block *rpcBlock, config rskblocks.BlockHashConfig) *rskblocks.BlockHeader {
 	// Convert RskPteEdges from int to int16
 	var edges []int16
 	if len(block.RskPteEdges) > 0 {
@@ -427,9 +456,6 @@ func convertRPCBlockToHeader(block *rpcBlock) *rskblocks.BlockHeader {
 		copy(input.LogsBloom[:], bloomBytes)
 	}
 
-	// Get config for regtest (all RSKIPs active)
-	config := rskblocks.ConfigForBlockNumber(blockNum, "regtest")
-
 	// Convert to BlockHeader using the helper
 	return rskblocks.InputToBlockHeader(input, config)
 }
@@ -0,0 +1,82 @@
+package rskblocks
+
+import (
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// accountHibernatedMask is the stateFlags bit of a hibernated account
+const accountHibernatedMask = 0x01
+
+// AccountState is the value stored under an account key of the unified trie.
+// Ported from org.ethereum.core.AccountState
+type AccountState struct {
+	Nonce      uint64
+	Balance    *big.Int
+	StateFlags uint64
+}
+
+// accountStateRLP is the RLP encoding structure for RSK account states:
+// [nonce, balance, stateFlags]. stateFlags is only present when not zero.
+// The balance is a signed big-endian integer (a Java BigInteger), and a zero
+// balance is encoded as 0x00 rather than as empty bytes.
+type accountStateRLP struct {
+	Nonce      []byte
+	Balance    []byte
+	StateFlags []byte `rlp:"optional"`
+}
+
+// DecodeAccountState decodes an account state from its trie value.
+func DecodeAccountState(data []byte) (*AccountState, error) {
+	var state AccountState
+	if err := rlp.DecodeBytes(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// IsHibernated reports whether the hibernation flag is set in StateFlags.
+func (a *AccountState) IsHibernated() bool {
+	return a.StateFlags&accountHibernatedMask != 0
+}
+
+func (a *AccountState) EncodeRLP(w io.Writer) error {
+	balance := []byte{0}
+	if a.Balance != nil && a.Balance.Sign() != 0 {
+		balance = a.Balance.Bytes()
+		if balance[0]&0x80 != 0 {
+			// Keep the value positive as a two's complement number
+			balance = append([]byte{0}, balance...)
+		}
+	}
+
+	return rlp.Encode(w, &accountStateRLP{
+		Nonce:      uint64ToBytes(a.Nonce),
+		Balance:    balance,
+		StateFlags: uint64ToBytes(a.StateFlags),
+	})
+}
+
+func (a *AccountState) DecodeRLP(s *rlp.Stream) error {
+	var dec accountStateRLP
+	if err := s.Decode(&dec); err != nil {
+		return err
+	}
+	if len(dec.Balance) > 0 && dec.Balance[0]&0x80 != 0 {
+		return errors.New("negative account balance")
+	}
+	if len(new(big.Int).SetBytes(dec.Nonce).Bytes()) > 8 {
+		return errors.New("account nonce does not fit in 64 bits")
+	}
+	if len(new(big.Int).SetBytes(dec.StateFlags).Bytes()) > 8 {
+		return errors.New("account state flags do not fit in 64 bits")
+	}
+
+	a.Nonce = bytesToUint64(dec.Nonce)
+	a.Balance = new(big.Int).SetBytes(dec.Balance)
+	a.StateFlags = bytesToUint64(dec.StateFlags)
+	return nil
+}
@@ -0,0 +1,75 @@
+package rskblocks
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func TestAccountStateEncoding(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   *AccountState
+		encoded string
+	}{
+		// A zero balance is 0x00 and a zero nonce is empty bytes
+		{"empty account", &AccountState{Balance: big.NewInt(0)}, "0xc28000"},
+		{"nil balance", &AccountState{}, "0xc28000"},
+		{"small values", &AccountState{Nonce: 5, Balance: big.NewInt(100)}, "0xc20564"},
+		// A balance with its top bit set keeps a leading zero byte
+		{"signed balance", &AccountState{Nonce: 1, Balance: big.NewInt(0x80)}, "0xc401820080"},
+		{"hibernated", &AccountState{Nonce: 1, Balance: big.NewInt(1), StateFlags: 1}, "0xc3010101"},
+	}
+	for _, tt := range tests {
+		encoded, err := rlp.EncodeToBytes(tt.state)
+		if err != nil {
+			t.Fatalf("%s: encode failed: %v", tt.name, err)
+		}
+		if hexutil.Encode(encoded) != tt.encoded {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.encoded, hexutil.Encode(encoded))
+		}
+
+		decoded, err := DecodeAccountState(encoded)
+		if err != nil {
+			t.Fatalf("%s: decode failed: %v", tt.name, err)
+		}
+		reencoded, _ := rlp.EncodeToBytes(decoded)
+		if !bytes.Equal(reencoded, encoded) {
+			t.Errorf("%s: round trip mismatch: %x", tt.name, reencoded)
+		}
+	}
+}
+
+func TestDecodeAccountState(t *testing.T) {
+	state, err := DecodeAccountState(hexutil.MustDecode("0xc401820080"))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if state.Nonce != 1 || state.Balance.Cmp(big.NewInt(0x80)) != 0 || state.IsHibernated() {
+		t.Errorf("Unexpected account state %+v", state)
+	}
+
+	state, err = DecodeAccountState(hexutil.MustDecode("0xc3010101"))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if !state.IsHibernated() {
+		t.Error("Expected hibernated account")
+	}
+
+	invalid := map[string]string{
+		"not a list":        "0x01",
+		"missing balance":   "0xc101",
+		"negative balance":  "0xc20181",
+		"nonce too large":   "0xcb8901000000000000000000",
+		"trailing elements": "0xc401010101",
+	}
+	for name, data := range invalid {
+		if _, err := DecodeAccountState(hexutil.MustDecode(data)); err == nil {
+			t.Errorf("%s: expected decode error", name)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package rskblocks
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// ErrInvalidBlock is returned when the body of a block does not match its header
+var ErrInvalidBlock = errors.New("invalid block")
+
+// transactionExecutionThreads bounds the RSKIP-144 edges of a block.
+// Corresponds to Constants.getTransactionExecutionThreads
+const transactionExecutionThreads = 2
+
+// Block represents an RSK block: a header, its transactions and its uncles.
+// Ported from org.ethereum.core.Block
+type Block struct {
+	Header       *BlockHeader
+	Transactions []*Transaction
+	Uncles       []*BlockHeader
+}
+
+// Hash returns the hash of the block header
+func (b *Block) Hash() common.Hash {
+	return b.Header.Hash()
+}
+
+// EncodeRLP implements rlp.Encoder. The encoding is that of RSKj's
+// Block.getEncoded: [header, [transactions...], [uncles...]], with the header
+// and uncles in their full encoding.
+func (b *Block) EncodeRLP(w io.Writer) error {
+	transactions := b.Transactions
+	if transactions == nil {
+		transactions = []*Transaction{}
+	}
+	return rlp.Encode(w, []interface{}{
+		rlp.RawValue(b.Header.GetFullEncoded()),
+		transactions,
+		encodeUncles(b.Uncles),
+	})
+}
+
+// GetEncodedRLP returns the RLP encoded bytes of the block
+func (b *Block) GetEncodedRLP() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := b.EncodeRLP(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeBlock decodes a block encoded by EncodeRLP or RSKj's Block.getEncoded.
+// The header and the uncles are decoded as by DecodeBlockHeader for network.
+func DecodeBlock(data []byte, network string) (*Block, error) {
+	return decodeBlock(data, func(number int64) BlockHashConfig {
+		return ConfigForBlockNumber(number, network)
+	})
+}
+
+// DecodeBlockWithConfig decodes a block like DecodeBlock, with the RSKIP
+// activations of config for the header and the uncles.
+func DecodeBlockWithConfig(data []byte, config BlockHashConfig) (*Block, error) {
+	return decodeBlock(data, func(int64) BlockHashConfig {
+		return config
+	})
+}
+
+func decodeBlock(data []byte, configFor func(number int64) BlockHashConfig) (*Block, error) {
+	items, err := splitRawList(data)
+	if err != nil {
+		return nil, fmt.Errorf("decode block: %w", err)
+	}
+	if len(items) != 3 {
+		return nil, fmt.Errorf("decode block: expected 3 items, got %d", len(items))
+	}
+
+	header, err := decodeBlockHeader(items[0], configFor)
+	if err != nil {
+		return nil, fmt.Errorf("decode block header: %w", err)
+	}
+	block := &Block{Header: header}
+
+	rawTransactions, err := splitRawList(items[1])
+	if err != nil {
+		return nil, fmt.Errorf("decode block transactions: %w", err)
+	}
+	block.Transactions = make([]*Transaction, len(rawTransactions))
+	for i, raw := range rawTransactions {
+		block.Transactions[i] = new(Transaction)
+		if err := rlp.DecodeBytes(raw, block.Transactions[i]); err != nil {
+			return nil, fmt.Errorf("decode transaction %d: %w", i, err)
+		}
+	}
+
+	rawUncles, err := splitRawList(items[2])
+	if err != nil {
+		return nil, fmt.Errorf("decode block uncles: %w", err)
+	}
+	block.Uncles = make([]*BlockHeader, len(rawUncles))
+	for i, raw := range rawUncles {
+		if block.Uncles[i], err = decodeBlockHeader(raw, configFor); err != nil {
+			return nil, fmt.Errorf("decode uncle %d: %w", i, err)
+		}
+	}
+	return block, nil
+}
+
+// Validate checks that the body of the block matches its header, like RSKj's
+// BlockRootValidationRule, BlockUnclesHashValidationRule and
+// ValidTxExecutionSublistsEdgesRule:
+//   - TxTrieRoot is the root of the transactions, as by GetTxTrieRoot
+//   - UnclesHash is the hash of the uncles, as by CalculateUnclesHash
+//   - UncleCount is the number of uncles
+//   - the RSKIP-144 edges increase, are within the transactions and are at
+//     most one per transaction execution thread
+//
+// The returned error wraps ErrInvalidBlock.
+func (b *Block) Validate(isRskip126Enabled bool) error {
+	h := b.Header
+
+	if txRoot := GetTxTrieRoot(b.Transactions, isRskip126Enabled); !bytes.Equal(txRoot, h.TxTrieRoot[:]) {
+		return fmt.Errorf("%w: transactions root %x, header has %s", ErrInvalidBlock, txRoot, h.TxTrieRoot.Hex())
+	}
+	if unclesHash := CalculateUnclesHash(b.Uncles); unclesHash != h.UnclesHash {
+		return fmt.Errorf("%w: uncles hash %s, header has %s", ErrInvalidBlock, unclesHash.Hex(), h.UnclesHash.Hex())
+	}
+	if len(b.Uncles) != h.UncleCount {
+		return fmt.Errorf("%w: %d uncles, header has uncle count %d", ErrInvalidBlock, len(b.Uncles), h.UncleCount)
+	}
+
+	// Each edge ends a sublist of transactions executed in parallel
+	edges := h.TxExecutionSublistsEdges
+	if len(edges) > transactionExecutionThreads {
+		return fmt.Errorf("%w: %d edges for %d execution threads", ErrInvalidBlock, len(edges), transactionExecutionThreads)
+	}
+	previous := 0
+	for i, edge := range edges {
+		if int(edge) <= previous {
+			return fmt.Errorf("%w: edge %d (%d) does not increase", ErrInvalidBlock, i, edge)
+		}
+		if int(edge) > len(b.Transactions) {
+			return fmt.Errorf("%w: edge %d (%d) beyond %d transactions", ErrInvalidBlock, i, edge, len(b.Transactions))
+		}
+		previous = int(edge)
+	}
+	return nil
+}
+
+// CalculateUnclesHash returns the uncles hash of a header with the given
+// uncles: Keccak256 of the RLP list of their full encodings.
+func CalculateUnclesHash(uncles []*BlockHeader) common.Hash {
+	encoded, _ := rlp.EncodeToBytes(encodeUncles(uncles))
+	return keccak256Hash(encoded)
+}
+
+func encodeUncles(uncles []*BlockHeader) []rlp.RawValue {
+	encoded := make([]rlp.RawValue, len(uncles))
+	for i, uncle := range uncles {
+		encoded[i] = uncle.GetFullEncoded()
+	}
+	return encoded
+}
+
+// splitRawList returns the encodings of the items of an RLP list
+func splitRawList(data []byte) ([][]byte, error) {
+	content, rest, err := rlp.SplitList(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%d trailing bytes", len(rest))
+	}
+
+	var items [][]byte
+	for len(content) > 0 {
+		_, _, next, err := rlp.Split(content)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, content[:len(content)-len(next)])
+		content = next
+	}
+	return items, nil
+}
@@ -1,6 +1,9 @@
 package rskblocks
 
 import (
+	"bytes"
+	"sort"
+
 	"github.com/ethereum-optimism/optimism/op-service/rsk/gorsk/rsktrie"
 
 	"github.com/ethereum/go-ethereum/rlp"
@@ -12,13 +15,15 @@ type BlockHashesHelper struct{}
 
 // CalculateReceiptsTrieRoot calculates the root hash of the receipts trie.
 // Corresponds to calculateReceiptsTrieRoot(List<TransactionReceipt> receipts, boolean isRskip126Enabled)
-// NOTE: We assume isRskip126Enabled is always TRUE, as requested.
-func CalculateReceiptsTrieRoot(receipts []*TransactionReceipt) []byte {
-	trie := CalculateReceiptsTrieFor(receipts)
-	// if (isRskip126Enabled) {
-	return trie.GetHash()
-	// }
-	// return trie.getHashOrchid(false).getBytes(); // Skipped as per instructions
+// Before RSKIP-126 the root is the Orchid hash of the trie.
+func CalculateReceiptsTrieRoot(receipts []*TransactionReceipt, isRskip126Enabled bool) []byte {
+	if !isRskip126Enabled {
+		return CalculateReceiptsTrieFor(receipts).GetHashOrchid(false)
+	}
+	return indexedTrieRoot(len(receipts), func(i int) []byte {
+		encodedReceipt, _ := rlp.EncodeToBytes(receipts[i])
+		return encodedReceipt
+	})
 }
 
 // CalculateReceiptsTrieFor builds a Trie containing the given receipts.
@@ -34,13 +39,15 @@ func CalculateReceiptsTrieFor(receipts []*TransactionReceipt) *rsktrie.Trie {
 
 // GetTxTrieRoot calculates the root hash of the transactions trie.
 // Corresponds to getTxTrieRoot(List<Transaction> transactions, boolean isRskip126Enabled)
-// NOTE: We assume isRskip126Enabled is always TRUE, as requested.
-func GetTxTrieRoot(transactions []*Transaction) []byte {
-	trie := GetTxTrieFor(transactions)
-	// if (isRskip126Enabled) {
-	return trie.GetHash()
-	// }
-	// return trie.getHashOrchid(false).getBytes(); // Skipped as per instructions
+// Before RSKIP-126 the root is the Orchid hash of the trie.
+func GetTxTrieRoot(transactions []*Transaction, isRskip126Enabled bool) []byte {
+	if !isRskip126Enabled {
+		return GetTxTrieFor(transactions).GetHashOrchid(false)
+	}
+	return indexedTrieRoot(len(transactions), func(i int) []byte {
+		encodedTx, _ := rlp.EncodeToBytes(transactions[i])
+		return encodedTx
+	})
 }
 
 // GetTxTrieFor builds a Trie containing the given transactions.
@@ -58,3 +65,27 @@ func GetTxTrieFor(transactions []*Transaction) *rsktrie.Trie {
 
 	return txsState
 }
+
+// indexedTrieRoot returns the root hash of the trie that maps RLP(i) to
+// item(i) for every i < n, like the tx and receipts tries. The items are
+// streamed into a StackTrie in key order, which differs from index order
+// (RLP(0) is 0x80), so that the trie is never held in memory as a whole.
+func indexedTrieRoot(n int, item func(i int) []byte) []byte {
+	keys := make([][]byte, n)
+	order := make([]int, n)
+	for i := range keys {
+		keys[i], _ = rlp.EncodeToBytes(uint64(i))
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return bytes.Compare(keys[order[a]], keys[order[b]]) < 0
+	})
+
+	stackTrie := rsktrie.NewStackTrie(nil)
+	for _, i := range order {
+		if err := stackTrie.Update(keys[i], item(i)); err != nil {
+			panic(err) // Keys are distinct and sorted
+		}
+	}
+	return stackTrie.Hash()
+}
@@ -24,7 +24,7 @@ func TestCalculateReceiptsTrieRoot(t *testing.T) {
 	}
 	receipts := []*TransactionReceipt{r1, r2}
 
-	root := CalculateReceiptsTrieRoot(receipts)
+	root := CalculateReceiptsTrieRoot(receipts, true)
 	if len(root) != 32 {
 		t.Errorf("Expected 32-byte root, got %d", len(root))
 	}
@@ -35,14 +35,14 @@ func TestGetTxTrieRoot(t *testing.T) {
 	tx2 := NewTransaction(1, common.Address{}, big.NewInt(100), 21000, big.NewInt(1), nil)
 	txs := []*Transaction{tx1, tx2}
 
-	root := GetTxTrieRoot(txs)
+	root := GetTxTrieRoot(txs, true)
 	if len(root) != 32 {
 		t.Errorf("Expected 32-byte root, got %d", len(root))
 	}
 }
 
 func TestTxTrieRootEmpty(t *testing.T) {
-	root := GetTxTrieRoot(nil)
+	root := GetTxTrieRoot(nil, true)
 	// Empty trie hash
 	// Keccak256(RLP(Empty String "80"))? No, Empty Trie hash is often specific constant.
 	// In our Trie implementation:
@@ -53,3 +53,45 @@ func TestTxTrieRootEmpty(t *testing.T) {
 		t.Errorf("Empty root mismatch. Got %x, want %x", root, expected)
 	}
 }
+
+func TestTrieRootsBeforeRskip126UseOrchidHash(t *testing.T) {
+	tx1 := NewTransaction(0, common.Address{}, big.NewInt(0), 21000, big.NewInt(1), nil)
+	tx2 := NewTransaction(1, common.Address{}, big.NewInt(100), 21000, big.NewInt(1), nil)
+	txs := []*Transaction{tx1, tx2}
+
+	txRoot := GetTxTrieRoot(txs, false)
+	if !bytes.Equal(txRoot, GetTxTrieFor(txs).GetHashOrchid(false)) {
+		t.Errorf("Expected Orchid tx root, got %x", txRoot)
+	}
+	if bytes.Equal(txRoot, GetTxTrieRoot(txs, true)) {
+		t.Error("Expected Orchid and RSKIP-126 tx roots to differ")
+	}
+
+	receipts := []*TransactionReceipt{{Status: []byte{1}, CumulativeGasUsed: 1000}}
+	receiptRoot := CalculateReceiptsTrieRoot(receipts, false)
+	if !bytes.Equal(receiptRoot, CalculateReceiptsTrieFor(receipts).GetHashOrchid(false)) {
+		t.Errorf("Expected Orchid receipts root, got %x", receiptRoot)
+	}
+
+	// Both algorithms agree on the empty trie
+	if !bytes.Equal(GetTxTrieRoot(nil, false), GetTxTrieRoot(nil, true)) {
+		t.Error("Expected the same empty tx root")
+	}
+}
+
+func TestTrieRootsMatchTrieForLargeBlocks(t *testing.T) {
+	// Enough items for RLP index keys of one, two and three bytes
+	var txs []*Transaction
+	var receipts []*TransactionReceipt
+	for i := 0; i < 300; i++ {
+		txs = append(txs, NewTransaction(uint64(i), common.Address{}, big.NewInt(int64(i)), 21000, big.NewInt(1), nil))
+		receipts = append(receipts, &TransactionReceipt{Status: []byte{1}, CumulativeGasUsed: uint64(21000 * (i + 1))})
+	}
+
+	if got, want := GetTxTrieRoot(txs, true), GetTxTrieFor(txs).GetHash(); !bytes.Equal(got, want) {
+		t.Errorf("Tx root mismatch. Got %x, want %x", got, want)
+	}
+	if got, want := CalculateReceiptsTrieRoot(receipts, true), CalculateReceiptsTrieFor(receipts).GetHash(); !bytes.Equal(got, want) {
+		t.Errorf("Receipts root mismatch. Got %x, want %x", got, want)
+	}
+}
@@ -108,21 +108,21 @@ func (h *BlockHeader) getEncoded(withMergedMiningFields, withMerkleProofAndCoinb
 		fields = append(fields, *h.UmmRoot)
 	}
 
-	// For V0 headers or non-compressed V1, add extra fields
+	// For V0 headers or non-compressed V1/V2, add extra fields
 	if h.Version == 0 {
 		// V0: add edges if present (including empty edges [] which encodes to 0x80)
 		// nil means edges field doesn't exist; [] means it exists but is empty
 		if h.TxExecutionSublistsEdges != nil {
 			fields = append(fields, encodeShortsToRLP(h.TxExecutionSublistsEdges))
 		}
-	} else if h.Version == 1 && !compressed {
-		// V1 non-compressed: add version and edges
+	} else if !compressed {
+		// V1/V2 non-compressed: add version and edges
 		fields = append(fields, []byte{h.Version})
 		if h.TxExecutionSublistsEdges != nil {
 			fields = append(fields, encodeShortsToRLP(h.TxExecutionSublistsEdges))
 		}
 	}
-	// V1 compressed: don't add version or edges (they're in extensionData)
+	// V1/V2 compressed: don't add version or edges (they're in extensionData)
 
 	// Merged mining fields
 	if withMergedMiningFields && h.hasMiningFields() {
@@ -0,0 +1,231 @@
+package rskblocks
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// ErrInvalidBlockHeader is returned when header RLP cannot be decoded into a BlockHeader
+var ErrInvalidBlockHeader = errors.New("invalid block header")
+
+// Field counts of a header, as in co.rsk.core.BlockFactory
+const (
+	headerCoreFields         = 15 // parentHash up to minimumGasPrice
+	headerMergedMiningFields = 3  // bitcoin header, merkle proof and coinbase transaction
+)
+
+// DecodeBlockHeader decodes a header encoded by GetFullEncoded, or by RSKj's
+// BlockHeader.getFullEncoded as returned by rsk_getRawBlockHeaderByNumber.
+//
+// The fields a header has depend on the RSKIPs active at its block number,
+// which are taken from ConfigForBlockNumber for network.
+func DecodeBlockHeader(data []byte, network string) (*BlockHeader, error) {
+	return decodeBlockHeader(data, func(number int64) BlockHashConfig {
+		return ConfigForBlockNumber(number, network)
+	})
+}
+
+// DecodeBlockHeaderWithConfig decodes a header like DecodeBlockHeader, with
+// the RSKIP activations of config rather than those of a known network.
+func DecodeBlockHeaderWithConfig(data []byte, config BlockHashConfig) (*BlockHeader, error) {
+	return decodeBlockHeader(data, func(int64) BlockHashConfig {
+		return config
+	})
+}
+
+// decodeBlockHeader ports BlockFactory.decodeHeader for full (non-compressed)
+// encodings. After the core fields and the uncle count come:
+//   - ummRoot, if UMM is active, even if empty
+//   - version, if RSKIP-351 is active (V1 and V2 headers)
+//   - txExecutionSublistsEdges, if present
+//   - the three merged mining fields, if present
+//
+// As in BlockFactory.canBeDecoded, the field count tells which of the last two
+// are present. The RSKIP-535 baseEvent is not part of the header encoding and
+// is left nil.
+func decodeBlockHeader(data []byte, configFor func(number int64) BlockHashConfig) (*BlockHeader, error) {
+	fields, err := splitHeaderFields(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) < headerCoreFields+1 {
+		return nil, fmt.Errorf("%w: %d fields", ErrInvalidBlockHeader, len(fields))
+	}
+
+	h := &BlockHeader{}
+	hashes := []struct {
+		index int
+		name  string
+		hash  *common.Hash
+	}{
+		{0, "parentHash", &h.ParentHash},
+		{1, "unclesHash", &h.UnclesHash},
+		{3, "stateRoot", &h.StateRoot},
+		{4, "txTrieRoot", &h.TxTrieRoot},
+		{5, "receiptTrieRoot", &h.ReceiptTrieRoot},
+	}
+	for _, field := range hashes {
+		if *field.hash, err = fields[field.index].hash(); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidBlockHeader, field.name, err)
+		}
+	}
+	if h.Coinbase, err = fields[2].rskAddress(); err != nil {
+		return nil, fmt.Errorf("%w: coinbase: %v", ErrInvalidBlockHeader, err)
+	}
+
+	// Compressed headers have extensionData in place of the logs bloom, which
+	// cannot be recovered from it
+	if fields[6].kind == rlp.List || len(fields[6].content) != len(h.LogsBloom) {
+		return nil, fmt.Errorf("%w: logs bloom of %d bytes, or a compressed header", ErrInvalidBlockHeader, len(fields[6].content))
+	}
+	copy(h.LogsBloom[:], fields[6].content)
+
+	if len(fields[7].content) > 0 {
+		h.Difficulty = new(big.Int).SetBytes(fields[7].content)
+	}
+	h.Number = new(big.Int).SetBytes(fields[8].content)
+	if !h.Number.IsInt64() {
+		return nil, fmt.Errorf("%w: block number %s", ErrInvalidBlockHeader, h.Number)
+	}
+	h.GasLimit = fields[9].bytes()
+	h.GasUsed = new(big.Int).SetBytes(fields[10].content)
+	h.Timestamp = new(big.Int).SetBytes(fields[11].content)
+	h.ExtraData = fields[12].bytes()
+	h.PaidFees = new(big.Int).SetBytes(fields[13].content)
+	if len(fields[14].content) > 0 {
+		h.MinimumGasPrice = new(big.Int).SetBytes(fields[14].content)
+	}
+
+	uncleCount := new(big.Int).SetBytes(fields[15].content)
+	if !uncleCount.IsInt64() || uncleCount.Int64() > math.MaxInt32 {
+		return nil, fmt.Errorf("%w: uncle count %s", ErrInvalidBlockHeader, uncleCount)
+	}
+	h.UncleCount = int(uncleCount.Int64())
+
+	config := configFor(h.Number.Int64())
+	h.UseRskip92Encoding = config.UseRskip92Encoding
+
+	r := headerCoreFields + 1
+	if config.IncludeUmmRoot {
+		if r >= len(fields) {
+			return nil, fmt.Errorf("%w: missing ummRoot", ErrInvalidBlockHeader)
+		}
+		ummRoot := fields[r].bytes()
+		h.UmmRoot = &ummRoot
+		r++
+	}
+	if config.Version > 0 {
+		if r >= len(fields) {
+			return nil, fmt.Errorf("%w: missing version", ErrInvalidBlockHeader)
+		}
+		if len(fields[r].content) != 1 || fields[r].content[0] == 0 || fields[r].content[0] > 2 {
+			return nil, fmt.Errorf("%w: unknown version %x", ErrInvalidBlockHeader, fields[r].content)
+		}
+		h.Version = fields[r].content[0]
+		r++
+	}
+
+	switch len(fields) - r {
+	case 0, headerMergedMiningFields:
+	case 1, 1 + headerMergedMiningFields:
+		if h.TxExecutionSublistsEdges, err = fields[r].shorts(); err != nil {
+			return nil, fmt.Errorf("%w: txExecutionSublistsEdges: %v", ErrInvalidBlockHeader, err)
+		}
+		r++
+	default:
+		return nil, fmt.Errorf("%w: %d fields for version %d", ErrInvalidBlockHeader, len(fields), h.Version)
+	}
+
+	if r < len(fields) {
+		h.BitcoinMergedMiningHeader = fields[r].bytes()
+		h.BitcoinMergedMiningMerkleProof = fields[r+1].bytes()
+		h.BitcoinMergedMiningCoinbaseTransaction = fields[r+2].bytes()
+	}
+	return h, nil
+}
+
+// headerField is one top-level item of an RLP-encoded header
+type headerField struct {
+	kind    rlp.Kind
+	content []byte
+}
+
+// splitHeaderFields splits the list of an RLP-encoded header into its items
+func splitHeaderFields(data []byte) ([]headerField, error) {
+	content, rest, err := rlp.SplitList(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBlockHeader, err)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%w: %d trailing bytes", ErrInvalidBlockHeader, len(rest))
+	}
+
+	var fields []headerField
+	for len(content) > 0 {
+		kind, value, next, err := rlp.Split(content)
+		if err != nil {
+			return nil, fmt.Errorf("%w: field %d: %v", ErrInvalidBlockHeader, len(fields), err)
+		}
+		fields = append(fields, headerField{kind: kind, content: value})
+		content = next
+	}
+	return fields, nil
+}
+
+// bytes returns a copy of the field's content, empty rather than nil
+func (f headerField) bytes() []byte {
+	return append([]byte{}, f.content...)
+}
+
+func (f headerField) hash() (common.Hash, error) {
+	if f.kind == rlp.List || len(f.content) != common.HashLength {
+		return common.Hash{}, fmt.Errorf("expected a %d byte hash, got %d bytes", common.HashLength, len(f.content))
+	}
+	return common.BytesToHash(f.content), nil
+}
+
+// rskAddress decodes an address encoded by encodeRskAddress
+func (f headerField) rskAddress() (common.Address, error) {
+	if f.kind == rlp.List || (len(f.content) != 0 && len(f.content) != common.AddressLength) {
+		return common.Address{}, fmt.Errorf("expected a %d byte address, got %d bytes", common.AddressLength, len(f.content))
+	}
+	return common.BytesToAddress(f.content), nil
+}
+
+// shorts decodes txExecutionSublistsEdges. RSKj writes them as an RLP list,
+// encodeShortsToRLP as a string holding that list.
+func (f headerField) shorts() ([]int16, error) {
+	list := f.content
+	if f.kind != rlp.List {
+		if len(f.content) == 0 {
+			return []int16{}, nil
+		}
+		var err error
+		if list, _, err = rlp.SplitList(f.content); err != nil {
+			return nil, err
+		}
+	}
+
+	shorts := []int16{}
+	for len(list) > 0 {
+		kind, value, next, err := rlp.Split(list)
+		if err != nil {
+			return nil, err
+		}
+		if kind == rlp.List || len(value) > 2 {
+			return nil, fmt.Errorf("edge %d does not fit in 16 bits", len(shorts))
+		}
+		var edge uint16
+		for _, b := range value {
+			edge = edge<<8 | uint16(b)
+		}
+		shorts = append(shorts, int16(edge))
+		list = next
+	}
+	return shorts, nil
+}
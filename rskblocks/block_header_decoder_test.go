@@ -0,0 +1,176 @@
+package rskblocks
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// decoderTestInput is regtest block 1, at the given number and with merged
+// mining fields when mergedMining is set
+func decoderTestInput(number int64, mergedMining bool) *BlockHeaderInput {
+	input := &BlockHeaderInput{
+		ParentHash:      common.HexToHash("0x8ea789fabef0dd4946ed53f001e7b6f8a8d0c22a612a6099fc7f93c990af68fe"),
+		UnclesHash:      common.HexToHash("0x1dcc4de8dec75d7aab85b567b6ccd41ad312451b948a7413f0a142fd40d49347"),
+		Coinbase:        common.HexToAddress("0xec4ddeb4380ad69b3e509baad9f158cdf4e4681d"),
+		StateRoot:       common.HexToHash("0xf276a3a8c9c4eb4dcbbfb9bf6965f36dc611b815614c0d7cd06e15b8890c272c"),
+		TxTrieRoot:      common.HexToHash("0x8c9664a30670ddc67aa13992fdd8751b7b797bbe172506ffd5cda10ebbf97952"),
+		ReceiptTrieRoot: common.HexToHash("0x66cfdb731f620cd96e2c2cb0f7d3c3a2879c29b40014aa27efbbf3cf9cd3b0f6"),
+		Difficulty:      big.NewInt(1),
+		Number:          big.NewInt(number),
+		GasLimit:        big.NewInt(10000000),
+		GasUsed:         big.NewInt(0),
+		Timestamp:       big.NewInt(0x69824213),
+		ExtraData:       hexToBytes("d40192534e415053484f542d343031373966623937"),
+		PaidFees:        big.NewInt(0),
+		MinimumGasPrice: big.NewInt(0),
+	}
+	input.LogsBloom[7] = 0x80
+	if mergedMining {
+		input.BitcoinMergedMiningHeader = bytes.Repeat([]byte{0x11}, 80)
+		input.BitcoinMergedMiningMerkleProof = bytes.Repeat([]byte{0x22}, 64)
+		input.BitcoinMergedMiningCoinbaseTransaction = bytes.Repeat([]byte{0x33}, 100)
+	}
+	return input
+}
+
+func TestDecodeBlockHeaderRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		network string
+		number  int64
+		mining  bool
+		edges   []int16
+	}{
+		{"regtest V2", "regtest", 1, false, nil},
+		{"regtest V2 with edges and merged mining", "regtest", 1, true, []int16{3, 1000}},
+		{"testnet V1 with merged mining", "testnet", 7139600, true, nil},
+		{"testnet V0 before V1", "testnet", 7139599, true, nil},
+		{"mainnet V0 with UMM", "mainnet", 8000000, true, nil},
+		{"mainnet pre-UMM", "mainnet", 1000000, true, nil},
+		{"mainnet pre-orchid", "mainnet", 100, true, nil},
+		{"mainnet without merged mining", "mainnet", 8000000, false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := decoderTestInput(tt.number, tt.mining)
+			input.TxExecutionSublistsEdges = tt.edges
+			header := InputToBlockHeader(input, ConfigForBlockNumber(tt.number, tt.network))
+			encoded := header.GetFullEncoded()
+
+			decoded, err := DecodeBlockHeader(encoded, tt.network)
+			if err != nil {
+				t.Fatalf("DecodeBlockHeader failed: %v", err)
+			}
+			if !bytes.Equal(decoded.GetFullEncoded(), encoded) {
+				t.Errorf("Decoded header re-encodes differently\n  Expected: %x\n  Computed: %x", encoded, decoded.GetFullEncoded())
+			}
+			if decoded.Hash() != header.Hash() {
+				t.Errorf("Hash mismatch\n  Expected: %s\n  Computed: %s", header.Hash().Hex(), decoded.Hash().Hex())
+			}
+			if decoded.Version != header.Version || (decoded.UmmRoot == nil) != (header.UmmRoot == nil) {
+				t.Errorf("Expected version %d and ummRoot %v, got %d and %v", header.Version, header.UmmRoot, decoded.Version, decoded.UmmRoot)
+			}
+			if !reflect.DeepEqual(decoded.TxExecutionSublistsEdges, header.TxExecutionSublistsEdges) {
+				t.Errorf("Expected edges %v, got %v", header.TxExecutionSublistsEdges, decoded.TxExecutionSublistsEdges)
+			}
+			if !bytes.Equal(decoded.BitcoinMergedMiningCoinbaseTransaction, header.BitcoinMergedMiningCoinbaseTransaction) {
+				t.Errorf("Merged mining fields not decoded")
+			}
+		})
+	}
+}
+
+func TestDecodeBlockHeaderBlock1Hash(t *testing.T) {
+	config := DefaultRegtestConfig()
+	input := decoderTestInput(1, false)
+	input.LogsBloom = [256]byte{}
+	input.TxExecutionSublistsEdges = []int16{}
+
+	decoded, err := DecodeBlockHeaderWithConfig(InputToBlockHeader(input, config).GetFullEncoded(), config)
+	if err != nil {
+		t.Fatalf("DecodeBlockHeaderWithConfig failed: %v", err)
+	}
+	expectedHash := common.HexToHash("0x90299cad077d0759beee6c9625be98114874d9ae65ede6979752a97112043b63")
+	if decoded.Hash() != expectedHash {
+		t.Errorf("Block hash mismatch\n  Expected: %s\n  Computed: %s", expectedHash.Hex(), decoded.Hash().Hex())
+	}
+}
+
+// RSKj writes the edges as an RLP list rather than a string holding one
+func TestDecodeBlockHeaderEdgesList(t *testing.T) {
+	input := decoderTestInput(7139600, true)
+	input.TxExecutionSublistsEdges = []int16{10, 300}
+	header := InputToBlockHeader(input, ConfigForBlockNumber(7139600, "testnet"))
+
+	var fields []rlp.RawValue
+	if err := rlp.DecodeBytes(header.GetFullEncoded(), &fields); err != nil {
+		t.Fatalf("Split header: %v", err)
+	}
+	fields[18], _ = rlp.EncodeToBytes([]uint64{10, 300})
+	encoded, _ := rlp.EncodeToBytes(fields)
+
+	decoded, err := DecodeBlockHeader(encoded, "testnet")
+	if err != nil {
+		t.Fatalf("DecodeBlockHeader failed: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.TxExecutionSublistsEdges, input.TxExecutionSublistsEdges) {
+		t.Errorf("Expected edges %v, got %v", input.TxExecutionSublistsEdges, decoded.TxExecutionSublistsEdges)
+	}
+	if decoded.Hash() != header.Hash() {
+		t.Errorf("Hash mismatch\n  Expected: %s\n  Computed: %s", header.Hash().Hex(), decoded.Hash().Hex())
+	}
+}
+
+func TestDecodeBlockHeaderRejectsInvalidHeaders(t *testing.T) {
+	v1 := InputToBlockHeader(decoderTestInput(7139600, true), ConfigForBlockNumber(7139600, "testnet"))
+	encoded := v1.GetFullEncoded()
+
+	var fields []rlp.RawValue
+	if err := rlp.DecodeBytes(encoded, &fields); err != nil {
+		t.Fatalf("Split header: %v", err)
+	}
+	withFields := func(fields ...rlp.RawValue) []byte {
+		encoded, _ := rlp.EncodeToBytes(fields)
+		return encoded
+	}
+	replaced := func(i int, value interface{}) []byte {
+		field, _ := rlp.EncodeToBytes(value)
+		return withFields(append(append(append([]rlp.RawValue{}, fields[:i]...), field), fields[i+1:]...)...)
+	}
+
+	withoutUmm := InputToBlockHeader(decoderTestInput(8000000, true), ConfigForBlockNumber(100, "mainnet"))
+
+	tests := []struct {
+		name    string
+		network string
+		encoded []byte
+	}{
+		{"not a list", "testnet", []byte{0x80}},
+		{"trailing bytes", "testnet", append(append([]byte{}, encoded...), 0x00)},
+		{"compressed header", "testnet", v1.GetEncodedForHash()},
+		{"too few fields", "testnet", withFields(fields[:15]...)},
+		{"extra field", "testnet", withFields(append(append([]rlp.RawValue{}, fields...), rlp.RawValue{0x80})...)},
+		{"two extra fields", "testnet", withFields(append(append([]rlp.RawValue{}, fields...), rlp.RawValue{0x80}, rlp.RawValue{0x80})...)},
+		{"short parent hash", "testnet", replaced(0, []byte{0x01})},
+		{"short coinbase", "testnet", replaced(2, []byte{0x01, 0x02})},
+		{"short logs bloom", "testnet", replaced(6, make([]byte, 255))},
+		{"unknown version", "testnet", replaced(17, []byte{0x03})},
+		{"edge over 16 bits", "testnet", replaced(18, []uint64{1 << 16})},
+		{"missing ummRoot", "mainnet", withoutUmm.GetFullEncoded()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeBlockHeader(tt.encoded, tt.network); !errors.Is(err, ErrInvalidBlockHeader) {
+				t.Errorf("Expected ErrInvalidBlockHeader, got %v", err)
+			}
+		})
+	}
+}
@@ -86,16 +86,24 @@ type BlockHashConfig struct {
 
 	// Use4ByteGasLimit: If true, pad gasLimit to 4 bytes (regtest). If false, use minimal bytes (mainnet/testnet).
 	Use4ByteGasLimit bool
+
+	// UseRskip126TrieHash: If true, tx and receipt roots use the RSKIP-107 trie hash; otherwise the Orchid hash
+	UseRskip126TrieHash bool
+
+	// UseRskip180MerkleProof: If true, RSKIP-92 merged mining merkle proofs must be a whole number of hashes
+	UseRskip180MerkleProof bool
 }
 
 // DefaultRegtestConfig returns the default configuration for regtest mode.
 // All RSKIPs are active from block 0 in regtest, including RSKIP-535 (V2 headers).
 func DefaultRegtestConfig() BlockHashConfig {
 	return BlockHashConfig{
-		UseRskip92Encoding: true,
-		Version:            2, // V2 for RSKIP-535 (baseEvent support)
-		IncludeUmmRoot:     true,
-		Use4ByteGasLimit:   true, // Regtest uses 4-byte gasLimit
+		UseRskip92Encoding:     true,
+		Version:                2, // V2 for RSKIP-535 (baseEvent support)
+		IncludeUmmRoot:         true,
+		Use4ByteGasLimit:       true, // Regtest uses 4-byte gasLimit
+		UseRskip126TrieHash:    true,
+		UseRskip180MerkleProof: true,
 	}
 }
 
@@ -106,14 +114,16 @@ func DefaultRegtestConfig() BlockHashConfig {
 // The actual ummRoot should only be included if the block has one (check RPC response).
 //
 // Mainnet activation heights (from main.conf):
-//   - orchid = 729000 (RSKIP-92)
+//   - orchid = 729000 (RSKIP-92, RSKIP-126)
 //   - papyrus200 = 2392700 (UMM)
+//   - iris300 = 3614800 (RSKIP-180)
 //   - reed810 = -1 (RSKIP-144, RSKIP-351/V1 - NOT YET ACTIVATED)
 //   - vetiver900 = -1 (RSKIP-535/V2 - NOT YET ACTIVATED)
 //
 // Testnet activation heights (from testnet.conf):
-//   - orchid = 0 (RSKIP-92)
+//   - orchid = 0 (RSKIP-92, RSKIP-126)
 //   - papyrus200 = 863000 (UMM)
+//   - iris300 = 2060500 (RSKIP-180)
 //   - reed810 = 7139600 (RSKIP-144, RSKIP-351/V1)
 //   - vetiver900 = -1 (RSKIP-535/V2 - NOT YET ACTIVATED)
 //
@@ -124,19 +134,23 @@ func ConfigForBlockNumber(blockNum int64, network string) BlockHashConfig {
 		// In regtest, all RSKIPs are active from genesis (block 0)
 		// This includes RSKIP-535 (V2 headers with baseEvent)
 		return BlockHashConfig{
-			UseRskip92Encoding: true,
-			Version:            2, // V2 for RSKIP-535
-			IncludeUmmRoot:     true,
-			Use4ByteGasLimit:   true, // Regtest uses 4-byte gasLimit
+			UseRskip92Encoding:     true,
+			Version:                2, // V2 for RSKIP-535
+			IncludeUmmRoot:         true,
+			Use4ByteGasLimit:       true, // Regtest uses 4-byte gasLimit
+			UseRskip126TrieHash:    true,
+			UseRskip180MerkleProof: true,
 		}
 	case "mainnet":
 		// Mainnet: RSKIP-351 (V1) and RSKIP-535 (V2) are NOT YET ACTIVE
 		// UMM is active from papyrus200 (2392700)
 		return BlockHashConfig{
-			UseRskip92Encoding: blockNum >= 729000,  // orchid
-			Version:            0,                   // RSKIP-351 NOT active (reed810 = -1)
-			IncludeUmmRoot:     blockNum >= 2392700, // UMM active from papyrus200
-			Use4ByteGasLimit:   false,               // Mainnet uses minimal gasLimit
+			UseRskip92Encoding:     blockNum >= 729000,  // orchid
+			Version:                0,                   // RSKIP-351 NOT active (reed810 = -1)
+			IncludeUmmRoot:         blockNum >= 2392700, // UMM active from papyrus200
+			Use4ByteGasLimit:       false,               // Mainnet uses minimal gasLimit
+			UseRskip126TrieHash:    blockNum >= 729000,  // orchid
+			UseRskip180MerkleProof: blockNum >= 3614800, // iris300
 		}
 	case "testnet":
 		// Testnet: RSKIP-351 (V1) activated at reed810 = 7139600
@@ -146,10 +160,12 @@ func ConfigForBlockNumber(blockNum int64, network string) BlockHashConfig {
 			version = 1 // V1 after reed810
 		}
 		return BlockHashConfig{
-			UseRskip92Encoding: true, // orchid = 0
-			Version:            version,
-			IncludeUmmRoot:     blockNum >= 863000, // UMM active from papyrus200
-			Use4ByteGasLimit:   false,              // Testnet uses minimal gasLimit
+			UseRskip92Encoding:     true, // orchid = 0
+			Version:                version,
+			IncludeUmmRoot:         blockNum >= 863000,  // UMM active from papyrus200
+			Use4ByteGasLimit:       false,               // Testnet uses minimal gasLimit
+			UseRskip126TrieHash:    true,                // orchid = 0
+			UseRskip180MerkleProof: blockNum >= 2060500, // iris300
 		}
 	default:
 		// Default to regtest behavior
@@ -142,37 +142,55 @@ func TestConfigForBlockNumber(t *testing.T) {
 			name:     "regtest block 0",
 			blockNum: 0,
 			network:  "regtest",
-			expected: BlockHashConfig{UseRskip92Encoding: true, Version: 2, IncludeUmmRoot: true, Use4ByteGasLimit: true},
+			expected: BlockHashConfig{UseRskip92Encoding: true, Version: 2, IncludeUmmRoot: true, Use4ByteGasLimit: true, UseRskip126TrieHash: true, UseRskip180MerkleProof: true},
 		},
 		{
 			name:     "regtest block 100",
 			blockNum: 100,
 			network:  "regtest",
-			expected: BlockHashConfig{UseRskip92Encoding: true, Version: 2, IncludeUmmRoot: true, Use4ByteGasLimit: true},
+			expected: BlockHashConfig{UseRskip92Encoding: true, Version: 2, IncludeUmmRoot: true, Use4ByteGasLimit: true, UseRskip126TrieHash: true, UseRskip180MerkleProof: true},
 		},
 		{
 			name:     "mainnet post-UMM (V0)",
 			blockNum: 5000000,
 			network:  "mainnet",
-			expected: BlockHashConfig{UseRskip92Encoding: true, Version: 0, IncludeUmmRoot: true, Use4ByteGasLimit: false},
+			expected: BlockHashConfig{UseRskip92Encoding: true, Version: 0, IncludeUmmRoot: true, Use4ByteGasLimit: false, UseRskip126TrieHash: true, UseRskip180MerkleProof: true},
 		},
 		{
 			name:     "mainnet current (V0)",
 			blockNum: 8000000,
 			network:  "mainnet",
-			expected: BlockHashConfig{UseRskip92Encoding: true, Version: 0, IncludeUmmRoot: true, Use4ByteGasLimit: false},
+			expected: BlockHashConfig{UseRskip92Encoding: true, Version: 0, IncludeUmmRoot: true, Use4ByteGasLimit: false, UseRskip126TrieHash: true, UseRskip180MerkleProof: true},
+		},
+		{
+			name:     "mainnet pre-iris",
+			blockNum: 3000000,
+			network:  "mainnet",
+			expected: BlockHashConfig{UseRskip92Encoding: true, Version: 0, IncludeUmmRoot: true, Use4ByteGasLimit: false, UseRskip126TrieHash: true},
 		},
 		{
 			name:     "mainnet pre-UMM",
 			blockNum: 2000000,
 			network:  "mainnet",
-			expected: BlockHashConfig{UseRskip92Encoding: true, Version: 0, IncludeUmmRoot: false, Use4ByteGasLimit: false},
+			expected: BlockHashConfig{UseRskip92Encoding: true, Version: 0, IncludeUmmRoot: false, Use4ByteGasLimit: false, UseRskip126TrieHash: true},
+		},
+		{
+			name:     "mainnet pre-orchid",
+			blockNum: 700000,
+			network:  "mainnet",
+			expected: BlockHashConfig{UseRskip92Encoding: false, Version: 0, IncludeUmmRoot: false, Use4ByteGasLimit: false, UseRskip126TrieHash: false},
+		},
+		{
+			name:     "testnet pre-iris",
+			blockNum: 2000000,
+			network:  "testnet",
+			expected: BlockHashConfig{UseRskip92Encoding: true, Version: 0, IncludeUmmRoot: true, Use4ByteGasLimit: false, UseRskip126TrieHash: true},
 		},
 		{
 			name:     "testnet V1",
 			blockNum: 7200000,
 			network:  "testnet",
-			expected: BlockHashConfig{UseRskip92Encoding: true, Version: 1, IncludeUmmRoot: true, Use4ByteGasLimit: false},
+			expected: BlockHashConfig{UseRskip92Encoding: true, Version: 1, IncludeUmmRoot: true, Use4ByteGasLimit: false, UseRskip126TrieHash: true, UseRskip180MerkleProof: true},
 		},
 	}
 
@@ -191,6 +209,12 @@ func TestConfigForBlockNumber(t *testing.T) {
 			if config.Use4ByteGasLimit != tt.expected.Use4ByteGasLimit {
 				t.Errorf("Use4ByteGasLimit: expected %v, got %v", tt.expected.Use4ByteGasLimit, config.Use4ByteGasLimit)
 			}
+			if config.UseRskip126TrieHash != tt.expected.UseRskip126TrieHash {
+				t.Errorf("UseRskip126TrieHash: expected %v, got %v", tt.expected.UseRskip126TrieHash, config.UseRskip126TrieHash)
+			}
+			if config.UseRskip180MerkleProof != tt.expected.UseRskip180MerkleProof {
+				t.Errorf("UseRskip180MerkleProof: expected %v, got %v", tt.expected.UseRskip180MerkleProof, config.UseRskip180MerkleProof)
+			}
 		})
 	}
 }
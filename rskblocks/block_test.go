@@ -0,0 +1,163 @@
+package rskblocks
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/op-service/rsk/gorsk/rsktrie"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// buildTestBlock returns a regtest block with a signed transaction, a
+// REMASC-like transaction and one uncle, whose header matches its body
+func buildTestBlock(t *testing.T) *Block {
+	var signed Transaction
+	if err := rlp.DecodeBytes(decodeHexTx(RlpEncodedSignedTx), &signed); err != nil {
+		t.Fatalf("Failed to decode signed tx: %v", err)
+	}
+	remasc := NewTransaction(0, common.HexToAddress("0x0000000000000000000000000000000001000008"), big.NewInt(0), 0, big.NewInt(0), nil)
+	transactions := []*Transaction{&signed, remasc}
+
+	config := DefaultRegtestConfig()
+	uncle := InputToBlockHeader(decoderTestInput(1, true), config)
+
+	input := decoderTestInput(2, false)
+	input.UncleCount = 1
+	input.TxExecutionSublistsEdges = []int16{1}
+	header := InputToBlockHeader(input, config)
+	header.TxTrieRoot = common.BytesToHash(GetTxTrieRoot(transactions, true))
+	header.UnclesHash = CalculateUnclesHash([]*BlockHeader{uncle})
+
+	return &Block{Header: header, Transactions: transactions, Uncles: []*BlockHeader{uncle}}
+}
+
+func TestBlockRoundTrip(t *testing.T) {
+	block := buildTestBlock(t)
+	if err := block.Validate(true); err != nil {
+		t.Fatalf("Expected a valid block, got %v", err)
+	}
+
+	encoded, err := block.GetEncodedRLP()
+	if err != nil {
+		t.Fatalf("GetEncodedRLP failed: %v", err)
+	}
+	decoded, err := DecodeBlock(encoded, "regtest")
+	if err != nil {
+		t.Fatalf("DecodeBlock failed: %v", err)
+	}
+	if reencoded, _ := decoded.GetEncodedRLP(); !bytes.Equal(reencoded, encoded) {
+		t.Errorf("Decoded block re-encodes differently\n  Expected: %x\n  Computed: %x", encoded, reencoded)
+	}
+	if decoded.Hash() != block.Hash() {
+		t.Errorf("Hash mismatch\n  Expected: %s\n  Computed: %s", block.Hash().Hex(), decoded.Hash().Hex())
+	}
+	if len(decoded.Transactions) != 2 || len(decoded.Uncles) != 1 {
+		t.Fatalf("Expected 2 transactions and 1 uncle, got %d and %d", len(decoded.Transactions), len(decoded.Uncles))
+	}
+	if decoded.Transactions[1].Hash() != block.Transactions[1].Hash() {
+		t.Errorf("REMASC transaction decoded differently")
+	}
+	if err := decoded.Validate(true); err != nil {
+		t.Errorf("Expected the decoded block to be valid, got %v", err)
+	}
+}
+
+func TestBlockValidateKeepsTransactionEncoding(t *testing.T) {
+	// The transactions root commits to the transaction as RSKj encodes it
+	encodedTx := decodeHexTx(RlpEncodedZeroGasPriceTx)
+	key, _ := rlp.EncodeToBytes(uint64(0))
+	txRoot := rsktrie.NewTrie(nil).Put(key, encodedTx).GetHash()
+
+	block := buildTestBlock(t)
+	block.Header.TxTrieRoot = common.BytesToHash(txRoot)
+	encoded, _ := rlp.EncodeToBytes([]interface{}{
+		rlp.RawValue(block.Header.GetFullEncoded()),
+		[]rlp.RawValue{encodedTx},
+		encodeUncles(block.Uncles),
+	})
+
+	decoded, err := DecodeBlock(encoded, "regtest")
+	if err != nil {
+		t.Fatalf("DecodeBlock failed: %v", err)
+	}
+	if err := decoded.Validate(true); err != nil {
+		t.Errorf("Expected a valid block, got %v", err)
+	}
+}
+
+func TestCalculateUnclesHashEmpty(t *testing.T) {
+	expected := common.HexToHash("0x1dcc4de8dec75d7aab85b567b6ccd41ad312451b948a7413f0a142fd40d49347")
+	if hash := CalculateUnclesHash(nil); hash != expected {
+		t.Errorf("Expected %s, got %s", expected.Hex(), hash.Hex())
+	}
+}
+
+func TestBlockValidateRejectsMismatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		rskip126 bool
+		modify   func(b *Block)
+	}{
+		{"transactions root", true, func(b *Block) { b.Transactions = b.Transactions[:1] }},
+		{"orchid transactions root", false, func(b *Block) {}},
+		{"uncles hash", true, func(b *Block) { b.Uncles = nil }},
+		{"uncle count", true, func(b *Block) { b.Header.UncleCount = 2 }},
+		{"zero edge", true, func(b *Block) { b.Header.TxExecutionSublistsEdges = []int16{0} }},
+		{"decreasing edges", true, func(b *Block) { b.Header.TxExecutionSublistsEdges = []int16{2, 1} }},
+		{"edge beyond transactions", true, func(b *Block) { b.Header.TxExecutionSublistsEdges = []int16{3} }},
+		{"more edges than execution threads", true, func(b *Block) {
+			remasc := b.Transactions[1]
+			b.Transactions = append(b.Transactions, remasc, remasc)
+			b.Header.TxTrieRoot = common.BytesToHash(GetTxTrieRoot(b.Transactions, true))
+			b.Header.TxExecutionSublistsEdges = []int16{1, 2, 3}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := buildTestBlock(t)
+			tt.modify(block)
+			if err := block.Validate(tt.rskip126); !errors.Is(err, ErrInvalidBlock) {
+				t.Errorf("Expected ErrInvalidBlock, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDecodeBlockRejectsMalformedBlocks(t *testing.T) {
+	block := buildTestBlock(t)
+	encoded, _ := block.GetEncodedRLP()
+	var items []rlp.RawValue
+	if err := rlp.DecodeBytes(encoded, &items); err != nil {
+		t.Fatalf("Split block: %v", err)
+	}
+	withItems := func(items ...rlp.RawValue) []byte {
+		encoded, _ := rlp.EncodeToBytes(items)
+		return encoded
+	}
+
+	tests := []struct {
+		name    string
+		encoded []byte
+	}{
+		{"not a list", []byte{0x80}},
+		{"trailing bytes", append(append([]byte{}, encoded...), 0x00)},
+		{"missing uncles", withItems(items[:2]...)},
+		{"extra item", withItems(append(append([]rlp.RawValue{}, items...), rlp.RawValue{0xc0})...)},
+		{"compressed header", withItems(block.Header.GetEncodedForHash(), items[1], items[2])},
+		{"malformed transaction", withItems(items[0], rlp.RawValue{0xc1, 0xc0}, items[2])},
+		{"malformed uncle", withItems(items[0], items[1], rlp.RawValue{0xc1, 0xc0})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeBlock(tt.encoded, "regtest"); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
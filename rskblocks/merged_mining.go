@@ -0,0 +1,447 @@
+package rskblocks
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ErrInvalidMergedMining is returned when the merged mining fields of a header
+// do not prove its proof of work
+var ErrInvalidMergedMining = errors.New("invalid merged mining proof of work")
+
+// Merged mining constants, from co.rsk.config.RskMiningConstants and
+// co.rsk.mine.MinerServerImpl
+const (
+	bitcoinHeaderSize = 80
+	// Bytes of the compressed coinbase holding the SHA-256 mid-state: the byte
+	// count processed so far and the eight state words
+	midstateSizeTrimmed           = 40
+	maxBytesAfterMergedMiningHash = 128
+	forkDetectionDataLength       = 12
+	// Bytes of the header hash and of the UMM root hashed together for
+	// unified merged mining (RSKIP-110 as amended by UMM)
+	ummLeavesLength = 20
+	// Blocks needed to compute fork detection data (RSKIP-110)
+	forkDetectionBlocks = 449
+)
+
+// rskTag precedes the hash for merged mining in the Bitcoin coinbase
+var rskTag = []byte("RSKBLOCK:")
+
+// maxTarget is 2^256, divided by the difficulty to get the target
+var maxTarget = new(big.Int).Lsh(big.NewInt(1), 256)
+
+// minTargetDifficulty is the lowest difficulty a target is computed for, so
+// that the target fits in 256 bits
+var minTargetDifficulty = big.NewInt(3)
+
+// BitcoinHeader is the Bitcoin block header of a merged-mined RSK block.
+// Hashes are in internal byte order, the reverse of how they are displayed.
+type BitcoinHeader struct {
+	Version    uint32
+	PrevBlock  [32]byte
+	MerkleRoot [32]byte
+	Time       uint32
+	Bits       uint32
+	Nonce      uint32
+}
+
+// ParseBitcoinHeader parses a serialized 80-byte Bitcoin block header
+func ParseBitcoinHeader(data []byte) (*BitcoinHeader, error) {
+	if len(data) != bitcoinHeaderSize {
+		return nil, fmt.Errorf("bitcoin header of %d bytes, expected %d", len(data), bitcoinHeaderSize)
+	}
+	h := &BitcoinHeader{
+		Version: binary.LittleEndian.Uint32(data[0:4]),
+		Time:    binary.LittleEndian.Uint32(data[68:72]),
+		Bits:    binary.LittleEndian.Uint32(data[72:76]),
+		Nonce:   binary.LittleEndian.Uint32(data[76:80]),
+	}
+	copy(h.PrevBlock[:], data[4:36])
+	copy(h.MerkleRoot[:], data[36:68])
+	return h, nil
+}
+
+// Serialize returns the 80-byte serialization of the header
+func (h *BitcoinHeader) Serialize() []byte {
+	data := make([]byte, bitcoinHeaderSize)
+	binary.LittleEndian.PutUint32(data[0:4], h.Version)
+	copy(data[4:36], h.PrevBlock[:])
+	copy(data[36:68], h.MerkleRoot[:])
+	binary.LittleEndian.PutUint32(data[68:72], h.Time)
+	binary.LittleEndian.PutUint32(data[72:76], h.Bits)
+	binary.LittleEndian.PutUint32(data[76:80], h.Nonce)
+	return data
+}
+
+// Hash returns the double SHA-256 hash of the header
+func (h *BitcoinHeader) Hash() [32]byte {
+	return doubleSHA256(h.Serialize())
+}
+
+// DifficultyToTarget returns the highest proof of work hash, as a number,
+// meeting difficulty: 2^256 / max(difficulty, 3).
+// Corresponds to co.rsk.util.DifficultyUtils.difficultyToTarget
+func DifficultyToTarget(difficulty *big.Int) *big.Int {
+	if difficulty.Cmp(minTargetDifficulty) < 0 {
+		difficulty = minTargetDifficulty
+	}
+	return new(big.Int).Div(maxTarget, difficulty)
+}
+
+// HashForMergedMining returns the hash a merge miner commits to in the
+// Bitcoin coinbase: Keccak256 of the compressed header without merged mining
+// fields. For UMM headers, those with a non-empty ummRoot, it is Keccak256 of
+// the first 20 bytes of that hash and the 20-byte ummRoot. With RSKIP-110 its
+// last 12 bytes are the fork detection data, which are read from the
+// coinbase, after the tag and the first 20 bytes of the hash.
+// Corresponds to BlockHeader.getHashForMergedMining
+func (h *BlockHeader) HashForMergedMining() (common.Hash, error) {
+	hash := keccak256Hash(h.getEncoded(false, false, true))
+	if h.UmmRoot != nil && len(*h.UmmRoot) > 0 {
+		var err error
+		if hash, err = h.hashRootForMergedMining(hash); err != nil {
+			return common.Hash{}, err
+		}
+	}
+	if !h.includesForkDetectionData() {
+		return hash, nil
+	}
+
+	prefix := append(append([]byte{}, rskTag...), hash[:common.HashLength-forkDetectionDataLength]...)
+	position := bytes.LastIndex(h.BitcoinMergedMiningCoinbaseTransaction, prefix)
+	if position == -1 {
+		return common.Hash{}, errors.New("fork detection data not found in the coinbase transaction")
+	}
+	from := position + len(prefix)
+	if from+forkDetectionDataLength > len(h.BitcoinMergedMiningCoinbaseTransaction) {
+		return common.Hash{}, errors.New("coinbase transaction ends within the fork detection data")
+	}
+	copy(hash[common.HashLength-forkDetectionDataLength:], h.BitcoinMergedMiningCoinbaseTransaction[from:])
+	return hash, nil
+}
+
+// hashRootForMergedMining combines the base hash for merged mining with the
+// UMM root. Corresponds to BlockHeader.getHashRootForMergedMining
+func (h *BlockHeader) hashRootForMergedMining(hash common.Hash) (common.Hash, error) {
+	if len(*h.UmmRoot) != ummLeavesLength {
+		return common.Hash{}, fmt.Errorf("UMM root of %d bytes, must be either 0 or %d", len(*h.UmmRoot), ummLeavesLength)
+	}
+	leftRight := append(append([]byte{}, hash[:ummLeavesLength]...), *h.UmmRoot...)
+	return keccak256Hash(leftRight), nil
+}
+
+// includesForkDetectionData tells whether RSKIP-110 is active for the header.
+// It activates with RSKIP-92 at Orchid on all networks, once enough blocks
+// exist to compute the data.
+func (h *BlockHeader) includesForkDetectionData() bool {
+	return h.UseRskip92Encoding && h.Number != nil && h.Number.Cmp(big.NewInt(forkDetectionBlocks)) >= 0
+}
+
+// ValidateMergedMining checks that the Bitcoin merged mining fields of header
+// prove its proof of work:
+//   - the Bitcoin header hash meets the target of the RSK difficulty
+//   - the coinbase transaction is in the Bitcoin header's merkle root
+//   - the coinbase commits to HashForMergedMining behind a single RSKBLOCK: tag
+//
+// The coinbase is compressed: the SHA-256 mid-state of its leading 64-byte
+// blocks, then the remaining tail holding the tag. Since RSKIP-92 the merkle
+// proof lists the siblings on the path from the coinbase to the root; before
+// it, the proof is a BIP37 partial merkle tree. Before RSKIP-180, set with
+// rskip180, bytes after the last whole hash of such a list are ignored.
+//
+// Fork detection data, which depends on ancestor headers, is not checked.
+// The returned error wraps ErrInvalidMergedMining.
+// Ported from co.rsk.validators.ProofOfWorkRule
+func ValidateMergedMining(header *BlockHeader, rskip180 bool) error {
+	btcHeader, err := ParseBitcoinHeader(header.BitcoinMergedMiningHeader)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMergedMining, err)
+	}
+
+	if header.Difficulty == nil || header.Difficulty.Sign() <= 0 {
+		return fmt.Errorf("%w: difficulty %v", ErrInvalidMergedMining, header.Difficulty)
+	}
+	btcHash := btcHeader.Hash()
+	target := DifficultyToTarget(header.Difficulty)
+	if hashToBig(btcHash).Cmp(target) > 0 {
+		return fmt.Errorf("%w: bitcoin header hash %x above target %x", ErrInvalidMergedMining, reverseBytes(btcHash[:]), target)
+	}
+
+	coinbaseHash, err := verifyMergedMiningCoinbase(header)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMergedMining, err)
+	}
+
+	if header.UseRskip92Encoding {
+		err = verifyCoinbaseBranch(header.BitcoinMergedMiningMerkleProof, coinbaseHash, btcHeader.MerkleRoot, rskip180)
+	} else {
+		err = verifyCoinbasePartialMerkleTree(header.BitcoinMergedMiningMerkleProof, coinbaseHash, btcHeader.MerkleRoot)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMergedMining, err)
+	}
+	return nil
+}
+
+// verifyMergedMiningCoinbase checks the RSK tag in the tail of the compressed
+// coinbase and returns the coinbase transaction hash
+func verifyMergedMiningCoinbase(header *BlockHeader) ([32]byte, error) {
+	compressed := header.BitcoinMergedMiningCoinbaseTransaction
+	if len(compressed) < midstateSizeTrimmed {
+		return [32]byte{}, fmt.Errorf("compressed coinbase transaction of %d bytes", len(compressed))
+	}
+	midstate, tail := compressed[:midstateSizeTrimmed], compressed[midstateSizeTrimmed:]
+
+	hashForMergedMining, err := header.HashForMergedMining()
+	if err != nil {
+		return [32]byte{}, err
+	}
+	expected := append(append([]byte{}, rskTag...), hashForMergedMining[:]...)
+	position := bytes.LastIndex(tail, expected)
+	if position == -1 {
+		return [32]byte{}, fmt.Errorf("coinbase transaction tail does not contain RSKBLOCK:%s", hashForMergedMining.Hex())
+	}
+	// A tag after a whole 64-byte block could also be hashed into the
+	// mid-state, giving another tail for the same coinbase
+	if position >= 64 {
+		return [32]byte{}, fmt.Errorf("RSK tag at position %d of the coinbase transaction tail", position)
+	}
+	if last := bytes.LastIndex(tail, rskTag); last != position {
+		return [32]byte{}, errors.New("the valid RSK tag is not the last RSK tag")
+	}
+	if after := len(tail) - position - len(expected); after > maxBytesAfterMergedMiningHash {
+		return [32]byte{}, fmt.Errorf("%d bytes after the hash for merged mining", after)
+	}
+
+	byteCount := binary.BigEndian.Uint64(midstate[:8])
+	if byteCount+uint64(len(tail)) <= 64 {
+		return [32]byte{}, errors.New("coinbase transaction must be longer than 64 bytes")
+	}
+	firstRound, err := resumeSHA256(midstate, tail)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return sha256.Sum256(firstRound[:]), nil
+}
+
+// resumeSHA256 finishes the SHA-256 hash of a message from the mid-state
+// after its leading 64-byte blocks, serialized as by BouncyCastle's
+// SHA256Digest: the byte count then the state words, big-endian.
+func resumeSHA256(midstate, tail []byte) ([32]byte, error) {
+	byteCount := binary.BigEndian.Uint64(midstate[:8])
+	if byteCount%64 != 0 {
+		return [32]byte{}, fmt.Errorf("mid-state after %d bytes, not a whole number of blocks", byteCount)
+	}
+
+	// crypto/sha256 state: magic, state words, block buffer and length
+	state := make([]byte, 0, 108)
+	state = append(state, "sha\x03"...)
+	state = append(state, midstate[8:40]...)
+	state = append(state, make([]byte, 64)...)
+	state = binary.BigEndian.AppendUint64(state, byteCount)
+
+	digest := sha256.New()
+	if err := digest.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		return [32]byte{}, fmt.Errorf("restore SHA-256 mid-state: %w", err)
+	}
+	digest.Write(tail)
+	var sum [32]byte
+	digest.Sum(sum[:0])
+	return sum, nil
+}
+
+// verifyCoinbaseBranch checks an RSKIP-92 merkle proof: the hashes of the
+// siblings of the coinbase, the leftmost transaction, from the leaves up.
+// Trailing bytes are only rejected with RSKIP-180.
+// Corresponds to co.rsk.validators.Rskip92MerkleProofValidator
+func verifyCoinbaseBranch(proof []byte, coinbaseHash, merkleRoot [32]byte, rskip180 bool) error {
+	if rskip180 && len(proof)%32 != 0 {
+		return fmt.Errorf("merkle proof of %d bytes is not a list of hashes", len(proof))
+	}
+	node := coinbaseHash
+	for i := 0; i+32 <= len(proof); i += 32 {
+		node = doubleSHA256(append(node[:], proof[i:i+32]...))
+	}
+	if node != merkleRoot {
+		return fmt.Errorf("merkle proof leads to %x, bitcoin header has %x", reverseBytes(node[:]), reverseBytes(merkleRoot[:]))
+	}
+	return nil
+}
+
+// verifyCoinbasePartialMerkleTree checks a BIP37 partial merkle tree that
+// matches the coinbase, as used before RSKIP-92.
+// Corresponds to co.rsk.validators.GenesisMerkleProofValidator
+func verifyCoinbasePartialMerkleTree(proof []byte, coinbaseHash, merkleRoot [32]byte) error {
+	tree, err := parsePartialMerkleTree(proof)
+	if err != nil {
+		return err
+	}
+	root, matched, err := tree.extractMatches()
+	if err != nil {
+		return err
+	}
+	if root != merkleRoot {
+		return fmt.Errorf("partial merkle tree root %x, bitcoin header has %x", reverseBytes(root[:]), reverseBytes(merkleRoot[:]))
+	}
+	for _, hash := range matched {
+		if hash == coinbaseHash {
+			return nil
+		}
+	}
+	return errors.New("partial merkle tree does not match the coinbase transaction")
+}
+
+// partialMerkleTree is a BIP37 partial merkle tree, as serialized by
+// bitcoinj's PartialMerkleTree
+type partialMerkleTree struct {
+	transactions uint32
+	hashes       [][32]byte
+	bits         []byte
+
+	bitsUsed, hashesUsed int
+}
+
+func parsePartialMerkleTree(data []byte) (*partialMerkleTree, error) {
+	if len(data) < 4 {
+		return nil, errors.New("partial merkle tree too short")
+	}
+	tree := &partialMerkleTree{transactions: binary.LittleEndian.Uint32(data)}
+	data = data[4:]
+
+	count, data, err := readCompactSize(data)
+	if err != nil || count > uint64(len(data))/32 {
+		return nil, errors.New("partial merkle tree hashes truncated")
+	}
+	tree.hashes = make([][32]byte, count)
+	for i := range tree.hashes {
+		copy(tree.hashes[i][:], data[i*32:])
+	}
+	data = data[count*32:]
+
+	count, data, err = readCompactSize(data)
+	if err != nil || count != uint64(len(data)) {
+		return nil, errors.New("partial merkle tree flags truncated or followed by trailing bytes")
+	}
+	tree.bits = data
+	return tree, nil
+}
+
+// extractMatches returns the merkle root and the matched transaction hashes,
+// like Bitcoin Core's CPartialMerkleTree::ExtractMatches
+func (t *partialMerkleTree) extractMatches() ([32]byte, [][32]byte, error) {
+	if t.transactions == 0 {
+		return [32]byte{}, nil, errors.New("partial merkle tree without transactions")
+	}
+	if uint64(len(t.hashes)) > uint64(t.transactions) {
+		return [32]byte{}, nil, errors.New("partial merkle tree with more hashes than transactions")
+	}
+	if len(t.bits)*8 < len(t.hashes) {
+		return [32]byte{}, nil, errors.New("partial merkle tree with fewer flag bits than hashes")
+	}
+
+	height := 0
+	for t.width(height) > 1 {
+		height++
+	}
+	var matched [][32]byte
+	root, err := t.traverse(height, 0, &matched)
+	if err != nil {
+		return [32]byte{}, nil, err
+	}
+	if (t.bitsUsed+7)/8 != len(t.bits) || t.hashesUsed != len(t.hashes) {
+		return [32]byte{}, nil, errors.New("partial merkle tree has unused flags or hashes")
+	}
+	return root, matched, nil
+}
+
+// width returns the number of nodes at height in the tree
+func (t *partialMerkleTree) width(height int) uint64 {
+	return (uint64(t.transactions) + (1 << height) - 1) >> height
+}
+
+func (t *partialMerkleTree) traverse(height int, pos uint64, matched *[][32]byte) ([32]byte, error) {
+	if t.bitsUsed >= len(t.bits)*8 {
+		return [32]byte{}, errors.New("partial merkle tree overflowed its flags")
+	}
+	parentOfMatch := t.bits[t.bitsUsed/8]&(1<<(t.bitsUsed%8)) != 0
+	t.bitsUsed++
+
+	if height == 0 || !parentOfMatch {
+		if t.hashesUsed >= len(t.hashes) {
+			return [32]byte{}, errors.New("partial merkle tree overflowed its hashes")
+		}
+		hash := t.hashes[t.hashesUsed]
+		t.hashesUsed++
+		if height == 0 && parentOfMatch {
+			*matched = append(*matched, hash)
+		}
+		return hash, nil
+	}
+
+	left, err := t.traverse(height-1, pos*2, matched)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	right := left
+	if pos*2+1 < t.width(height-1) {
+		if right, err = t.traverse(height-1, pos*2+1, matched); err != nil {
+			return [32]byte{}, err
+		}
+		// Equal siblings would allow duplicate transactions (CVE-2012-2459)
+		if right == left {
+			return [32]byte{}, errors.New("partial merkle tree with equal left and right hashes")
+		}
+	}
+	return doubleSHA256(append(left[:], right[:]...)), nil
+}
+
+// readCompactSize reads a Bitcoin variable length integer
+func readCompactSize(data []byte) (uint64, []byte, error) {
+	if len(data) == 0 {
+		return 0, nil, errors.New("missing compact size")
+	}
+	var size int
+	switch data[0] {
+	case 0xfd:
+		size = 2
+	case 0xfe:
+		size = 4
+	case 0xff:
+		size = 8
+	default:
+		return uint64(data[0]), data[1:], nil
+	}
+	if len(data) < 1+size {
+		return 0, nil, errors.New("truncated compact size")
+	}
+	var buf [8]byte
+	copy(buf[:], data[1:1+size])
+	return binary.LittleEndian.Uint64(buf[:]), data[1+size:], nil
+}
+
+func doubleSHA256(data []byte) [32]byte {
+	first := sha256.Sum256(data)
+	return sha256.Sum256(first[:])
+}
+
+// hashToBig interprets a hash in internal byte order as a number, as Bitcoin
+// does to compare it with a target
+func hashToBig(hash [32]byte) *big.Int {
+	return new(big.Int).SetBytes(reverseBytes(hash[:]))
+}
+
+func reverseBytes(b []byte) []byte {
+	reversed := make([]byte, len(b))
+	for i := range b {
+		reversed[len(b)-1-i] = b[i]
+	}
+	return reversed
+}
@@ -0,0 +1,293 @@
+package rskblocks
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// mergedMiningPrefix is the part of test coinbases hashed into the mid-state
+var mergedMiningPrefix = bytes.Repeat([]byte{0xaa}, 128)
+
+// mergedMiningTestHeader returns a header at number, before RSKIP-92 unless
+// rskip92 is set, with difficulty 16
+func mergedMiningTestHeader(number int64, rskip92 bool) *BlockHeader {
+	header := InputToBlockHeader(decoderTestInput(number, false), ConfigForBlockNumber(number, "regtest"))
+	header.UseRskip92Encoding = rskip92
+	header.Difficulty = big.NewInt(16)
+	return header
+}
+
+// coinbaseTail returns a coinbase tail committing to the header, with the
+// given bytes before the tag and after the hash for merged mining
+func coinbaseTail(header *BlockHeader, before, after []byte) []byte {
+	// The fork detection data is read from the coinbase, so any value fits
+	hash := keccak256Hash(header.getEncoded(false, false, true))
+	if header.UmmRoot != nil && len(*header.UmmRoot) > 0 {
+		hash, _ = header.hashRootForMergedMining(hash)
+	}
+	if header.includesForkDetectionData() {
+		copy(hash[20:], bytes.Repeat([]byte{0x5f}, forkDetectionDataLength))
+	}
+	tail := append(append([]byte{}, before...), rskTag...)
+	return append(append(tail, hash[:]...), after...)
+}
+
+// mergeMine sets the merged mining fields of header for a coinbase made of
+// mergedMiningPrefix and tail, the first of three Bitcoin transactions, and
+// mines the Bitcoin header for the header's difficulty
+func mergeMine(t *testing.T, header *BlockHeader, tail []byte) {
+	digest := sha256.New()
+	digest.Write(mergedMiningPrefix)
+	state, err := digest.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		t.Fatalf("Failed to get SHA-256 mid-state: %v", err)
+	}
+	compressed := binary.BigEndian.AppendUint64(nil, uint64(len(mergedMiningPrefix)))
+	compressed = append(append(compressed, state[4:36]...), tail...)
+	header.BitcoinMergedMiningCoinbaseTransaction = compressed
+
+	coinbase := doubleSHA256(append(append([]byte{}, mergedMiningPrefix...), tail...))
+	tx1, tx2 := [32]byte{0x01}, [32]byte{0x02}
+	right := doubleSHA256(append(tx2[:], tx2[:]...))
+	left := doubleSHA256(append(coinbase[:], tx1[:]...))
+
+	btcHeader := &BitcoinHeader{Version: 0x20000000, Time: 1700000000, Bits: 0x1d00ffff}
+	btcHeader.MerkleRoot = doubleSHA256(append(left[:], right[:]...))
+	if header.UseRskip92Encoding {
+		header.BitcoinMergedMiningMerkleProof = append(tx1[:], right[:]...)
+	} else {
+		// Flags 1, 1, 1, 0, 0: the root and left nodes are parents of the
+		// matched coinbase, tx1 and the right node are given by their hashes
+		pmt := binary.LittleEndian.AppendUint32(nil, 3)
+		pmt = append(append(append(append(pmt, 3), coinbase[:]...), tx1[:]...), right[:]...)
+		header.BitcoinMergedMiningMerkleProof = append(pmt, 1, 0x07)
+	}
+
+	target := DifficultyToTarget(header.Difficulty)
+	for hashToBig(btcHeader.Hash()).Cmp(target) > 0 {
+		btcHeader.Nonce++
+	}
+	header.BitcoinMergedMiningHeader = btcHeader.Serialize()
+}
+
+func TestValidateMergedMining(t *testing.T) {
+	ummRoot := bytes.Repeat([]byte{0x7e}, ummLeavesLength)
+	tests := []struct {
+		name    string
+		number  int64
+		rskip92 bool
+		ummRoot []byte
+	}{
+		{"RSKIP-92 with fork detection data", 1000, true, nil},
+		{"RSKIP-92 before fork detection data", 100, true, nil},
+		{"partial merkle tree before RSKIP-92", 1000, false, nil},
+		{"UMM with fork detection data", 1000, true, ummRoot},
+		{"UMM before fork detection data", 100, true, ummRoot},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := mergedMiningTestHeader(tt.number, tt.rskip92)
+			if tt.ummRoot != nil {
+				header.UmmRoot = &tt.ummRoot
+			}
+			mergeMine(t, header, coinbaseTail(header, []byte{0x01, 0x02}, make([]byte, 4)))
+			if err := ValidateMergedMining(header, true); err != nil {
+				t.Fatalf("Expected valid merged mining, got %v", err)
+			}
+
+			// The merged mining fields round trip through the header encoding
+			decoded, err := DecodeBlockHeaderWithConfig(header.GetFullEncoded(), BlockHashConfig{
+				UseRskip92Encoding: tt.rskip92,
+				Version:            header.Version,
+				IncludeUmmRoot:     true,
+			})
+			if err != nil {
+				t.Fatalf("DecodeBlockHeaderWithConfig failed: %v", err)
+			}
+			if err := ValidateMergedMining(decoded, true); err != nil {
+				t.Errorf("Expected the decoded header to be valid, got %v", err)
+			}
+		})
+	}
+}
+
+func TestHashForMergedMiningUMM(t *testing.T) {
+	// The UMM root is also part of the header encoding
+	header := mergedMiningTestHeader(100, true)
+	ummRoot := bytes.Repeat([]byte{0x7e}, ummLeavesLength)
+	header.UmmRoot = &ummRoot
+	base := keccak256Hash(header.getEncoded(false, false, true))
+
+	hash, err := header.HashForMergedMining()
+	if err != nil {
+		t.Fatalf("HashForMergedMining failed: %v", err)
+	}
+	if want := keccak256Hash(append(append([]byte{}, base[:ummLeavesLength]...), ummRoot...)); hash != want {
+		t.Errorf("Expected %s, got %s", want.Hex(), hash.Hex())
+	}
+
+	for _, length := range []int{1, ummLeavesLength - 1, ummLeavesLength + 1, 32} {
+		ummRoot := make([]byte, length)
+		header.UmmRoot = &ummRoot
+		if _, err := header.HashForMergedMining(); err == nil {
+			t.Errorf("Expected an error for a UMM root of %d bytes", length)
+		}
+	}
+}
+
+func TestBitcoinHeaderRoundTrip(t *testing.T) {
+	header := mergedMiningTestHeader(1000, true)
+	mergeMine(t, header, coinbaseTail(header, nil, nil))
+
+	btcHeader, err := ParseBitcoinHeader(header.BitcoinMergedMiningHeader)
+	if err != nil {
+		t.Fatalf("ParseBitcoinHeader failed: %v", err)
+	}
+	if !bytes.Equal(btcHeader.Serialize(), header.BitcoinMergedMiningHeader) {
+		t.Error("Bitcoin header re-serializes differently")
+	}
+	if btcHeader.Bits != 0x1d00ffff {
+		t.Errorf("Expected bits 1d00ffff, got %08x", btcHeader.Bits)
+	}
+	if _, err := ParseBitcoinHeader(header.BitcoinMergedMiningHeader[:79]); err == nil {
+		t.Error("Expected an error for a truncated header")
+	}
+}
+
+func TestValidateMergedMiningRejectsInvalidProofs(t *testing.T) {
+	header := mergedMiningTestHeader(1000, true)
+	tests := []struct {
+		name    string
+		rskip92 bool
+		tail    []byte
+		modify  func(h *BlockHeader)
+	}{
+		{"hash above target", true, nil, func(h *BlockHeader) { h.Difficulty = new(big.Int).Lsh(big.NewInt(1), 200) }},
+		{"missing difficulty", true, nil, func(h *BlockHeader) { h.Difficulty = nil }},
+		{"truncated bitcoin header", true, nil, func(h *BlockHeader) { h.BitcoinMergedMiningHeader = h.BitcoinMergedMiningHeader[:79] }},
+		{"header changed after mining", true, nil, func(h *BlockHeader) { h.GasUsed = big.NewInt(1) }},
+		{"tampered merkle proof", true, nil, func(h *BlockHeader) { h.BitcoinMergedMiningMerkleProof[0] ^= 0x01 }},
+		{"merkle proof not a list of hashes", true, nil, func(h *BlockHeader) {
+			h.BitcoinMergedMiningMerkleProof = h.BitcoinMergedMiningMerkleProof[:40]
+		}},
+		{"tampered coinbase", true, nil, func(h *BlockHeader) {
+			h.BitcoinMergedMiningCoinbaseTransaction[len(h.BitcoinMergedMiningCoinbaseTransaction)-1] ^= 0x01
+		}},
+		{"truncated compressed coinbase", true, nil, func(h *BlockHeader) {
+			h.BitcoinMergedMiningCoinbaseTransaction = h.BitcoinMergedMiningCoinbaseTransaction[:39]
+		}},
+		{"mid-state within a block", true, nil, func(h *BlockHeader) { h.BitcoinMergedMiningCoinbaseTransaction[7] = 0x81 }},
+		{"coinbase of 64 bytes or less", true, nil, func(h *BlockHeader) {
+			copy(h.BitcoinMergedMiningCoinbaseTransaction, make([]byte, 8))
+		}},
+		{"tag after a whole block", true, coinbaseTail(header, make([]byte, 64), nil), nil},
+		{"another tag after", true, coinbaseTail(header, nil, rskTag), nil},
+		{"too many bytes after", true, coinbaseTail(header, nil, make([]byte, 129)), nil},
+		{"no fork detection data", true, append(append([]byte{}, rskTag...), make([]byte, 32)...), nil},
+		{"UMM root set after mining", true, nil, func(h *BlockHeader) {
+			ummRoot := bytes.Repeat([]byte{0x7e}, ummLeavesLength)
+			h.UmmRoot = &ummRoot
+		}},
+		{"UMM root of wrong length", true, nil, func(h *BlockHeader) {
+			ummRoot := bytes.Repeat([]byte{0x7e}, ummLeavesLength-1)
+			h.UmmRoot = &ummRoot
+		}},
+		{"no commitment", true, nil, func(h *BlockHeader) {
+			// Without fork detection data the hash is not read from the coinbase
+			h.Number = big.NewInt(100)
+		}},
+		{"partial merkle tree not matching the coinbase", false, nil, func(h *BlockHeader) {
+			btcHeader, _ := ParseBitcoinHeader(h.BitcoinMergedMiningHeader)
+			pmt := binary.LittleEndian.AppendUint32(nil, 3)
+			h.BitcoinMergedMiningMerkleProof = append(append(append(pmt, 1), btcHeader.MerkleRoot[:]...), 1, 0x00)
+		}},
+		{"partial merkle tree with unused flags", false, nil, func(h *BlockHeader) {
+			proof := h.BitcoinMergedMiningMerkleProof
+			h.BitcoinMergedMiningMerkleProof = append(append([]byte{}, proof[:len(proof)-2]...), 2, 0x07, 0x00)
+		}},
+		{"partial merkle tree with more hashes than transactions", false, nil, func(h *BlockHeader) {
+			proof := h.BitcoinMergedMiningMerkleProof
+			extra := append(append([]byte{}, proof[:4]...), 4)
+			extra = append(append(extra, proof[5:len(proof)-2]...), make([]byte, 32)...)
+			h.BitcoinMergedMiningMerkleProof = append(extra, 1, 0x07)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := mergedMiningTestHeader(1000, tt.rskip92)
+			tail := tt.tail
+			if tail == nil {
+				tail = coinbaseTail(header, nil, make([]byte, 4))
+			}
+			mergeMine(t, header, tail)
+			if tt.modify != nil {
+				tt.modify(header)
+			}
+			if err := ValidateMergedMining(header, true); !errors.Is(err, ErrInvalidMergedMining) {
+				t.Errorf("Expected ErrInvalidMergedMining, got %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateMergedMiningTrailingProofBytes(t *testing.T) {
+	header := mergedMiningTestHeader(1000, true)
+	mergeMine(t, header, coinbaseTail(header, nil, nil))
+	header.BitcoinMergedMiningMerkleProof = append(header.BitcoinMergedMiningMerkleProof, 0x01, 0x02, 0x03)
+
+	// Ignored before RSKIP-180
+	if err := ValidateMergedMining(header, false); err != nil {
+		t.Errorf("Expected valid merged mining before RSKIP-180, got %v", err)
+	}
+	if err := ValidateMergedMining(header, true); !errors.Is(err, ErrInvalidMergedMining) {
+		t.Errorf("Expected ErrInvalidMergedMining with RSKIP-180, got %v", err)
+	}
+}
+
+func TestDifficultyToTarget(t *testing.T) {
+	third := new(big.Int).Div(maxTarget, big.NewInt(3))
+	for _, difficulty := range []int64{1, 2, 3} {
+		if target := DifficultyToTarget(big.NewInt(difficulty)); target.Cmp(third) != 0 {
+			t.Errorf("Expected 2^256 / 3 for difficulty %d, got %x", difficulty, target)
+		}
+	}
+	if target := DifficultyToTarget(big.NewInt(16)); target.Cmp(new(big.Int).Lsh(big.NewInt(1), 252)) != 0 {
+		t.Errorf("Expected 2^252 for difficulty 16, got %x", target)
+	}
+}
+
+func TestValidateMergedMiningClampsLowDifficulty(t *testing.T) {
+	// Regtest blocks have difficulty 1, whose target is that of difficulty 3
+	header := mergedMiningTestHeader(1000, true)
+	header.Difficulty = big.NewInt(1)
+	mergeMine(t, header, coinbaseTail(header, nil, nil))
+	if err := ValidateMergedMining(header, true); err != nil {
+		t.Fatalf("Expected valid merged mining, got %v", err)
+	}
+
+	// Look for a Bitcoin header hash between 2^256 / 3 and 2^256 / 2
+	btcHeader, err := ParseBitcoinHeader(header.BitcoinMergedMiningHeader)
+	if err != nil {
+		t.Fatalf("ParseBitcoinHeader failed: %v", err)
+	}
+	third := new(big.Int).Div(maxTarget, big.NewInt(3))
+	half := new(big.Int).Rsh(maxTarget, 1)
+	for {
+		btcHeader.Nonce++
+		hash := hashToBig(btcHeader.Hash())
+		if hash.Cmp(third) > 0 && hash.Cmp(half) <= 0 {
+			break
+		}
+	}
+	header.BitcoinMergedMiningHeader = btcHeader.Serialize()
+	if err := ValidateMergedMining(header, true); !errors.Is(err, ErrInvalidMergedMining) {
+		t.Errorf("Expected ErrInvalidMergedMining, got %v", err)
+	}
+}
@@ -21,14 +21,21 @@ package rskblocks
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
 
+	"github.com/ethereum-optimism/optimism/op-service/rsk/gorsk/rsktrie"
+
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
+// ErrAccountFieldMismatch is returned when an eth_getProof response reports a
+// balance or nonce that differs from the account state its proof verifies.
+var ErrAccountFieldMismatch = errors.New("RPC account field differs from the proven account state")
+
 // ProofResponse represents the eth_getProof RPC response from RSKj.
 // This matches the format returned by both eth_getProof and rsk_getProof endpoints.
 type ProofResponse struct {
@@ -151,6 +158,7 @@ func (c *ProofClient) GetRSKProof(
 // 1. Calls eth_getProof to get the account proof
 // 2. Decodes the RLP-encoded proof nodes
 // 3. Verifies the proof against the provided state root
+// 4. Checks the balance and nonce in the response against the proven account
 //
 // Parameters:
 //   - ctx: Context for the RPC call
@@ -182,6 +190,60 @@ func (c *ProofClient) GetAndVerifyAccountProof(
 	if err != nil {
 		return nil, fmt.Errorf("proof verification error: %w", err)
 	}
+	checkProvenAccountFields(proof, result)
+
+	return result, nil
+}
+
+// GetCode calls eth_getCode on the RSKj node and returns the account bytecode.
+// The code is reported by the RPC node; see GetAndVerifyCodeProof.
+func (c *ProofClient) GetCode(
+	ctx context.Context,
+	address common.Address,
+	blockRef string,
+) ([]byte, error) {
+	var code hexutil.Bytes
+	err := c.rpc.CallContext(ctx, &code, "eth_getCode", address, blockRef)
+	if err != nil {
+		return nil, fmt.Errorf("eth_getCode RPC call failed: %w", err)
+	}
+
+	return code, nil
+}
+
+// GetAndVerifyCodeProof fetches the account proof and bytecode of an address
+// and verifies both against the state root.
+//
+// The codeHash of the eth_getProof response must match the code node proven
+// by the account proof, and the eth_getCode bytecode must hash to it.
+//
+// Returns CodeProofResult with Valid=true and the verified Code if
+// verification succeeds.
+func (c *ProofClient) GetAndVerifyCodeProof(
+	ctx context.Context,
+	stateRoot common.Hash,
+	address common.Address,
+	blockRef string,
+) (*CodeProofResult, error) {
+	proof, err := c.GetProof(ctx, address, nil, blockRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch proof: %w", err)
+	}
+
+	code, err := c.GetCode(ctx, address, blockRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch code: %w", err)
+	}
+
+	proofNodes, err := DecodeRLPProofNodes(proof.AccountProof)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode proof nodes: %w", err)
+	}
+
+	result, err := c.verifier.VerifyCodeProof(stateRoot, address, proof.CodeHash, code, proofNodes)
+	if err != nil {
+		return nil, fmt.Errorf("code proof verification error: %w", err)
+	}
 
 	return result, nil
 }
@@ -243,6 +305,73 @@ func (c *ProofClient) GetAndVerifyStorageProof(
 	return result, nil
 }
 
+// GetAndVerifyStorageRoot fetches the account proof of an address along with
+// a storage proof of slot 0, which covers the storage root node, and verifies
+// the storageHash of the response against the state root.
+//
+// Comparing the verified StorageHash of two blocks tells whether any storage
+// slot of the account changed between them.
+//
+// Returns StorageRootResult with Valid=true if verification succeeds.
+func (c *ProofClient) GetAndVerifyStorageRoot(
+	ctx context.Context,
+	stateRoot common.Hash,
+	address common.Address,
+	blockRef string,
+) (*StorageRootResult, error) {
+	proof, err := c.GetProof(ctx, address, []common.Hash{{}}, blockRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch proof: %w", err)
+	}
+
+	proofs, err := proof.decodeProofs()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := c.verifier.VerifyStorageRoot(stateRoot, address, proof.StorageHash, proofs...)
+	if err != nil {
+		return nil, fmt.Errorf("storage root verification error: %w", err)
+	}
+
+	return result, nil
+}
+
+// StorageProofSource returns a source of storage proofs that calls
+// eth_getProof for address at blockRef.
+func (c *ProofClient) StorageProofSource(ctx context.Context, address common.Address, blockRef string) StorageProofSource {
+	return func(slots []common.Hash) ([][][]byte, error) {
+		proof, err := c.GetProof(ctx, address, slots, blockRef)
+		if err != nil {
+			return nil, err
+		}
+
+		byKey := make(map[common.Hash][]string, len(proof.StorageProof))
+		for _, sp := range proof.StorageProof {
+			byKey[common.HexToHash(sp.Key)] = sp.Proofs
+		}
+
+		proofs := make([][][]byte, len(slots))
+		for i, slot := range slots {
+			hexNodes, ok := byKey[slot]
+			if !ok {
+				return nil, fmt.Errorf("storage key %s not found in proof response", slot.Hex())
+			}
+			if proofs[i], err = DecodeRLPProofNodes(hexNodes); err != nil {
+				return nil, fmt.Errorf("failed to decode storage proof nodes for key %s: %w", slot.Hex(), err)
+			}
+		}
+		return proofs, nil
+	}
+}
+
+// NewStorageReader creates a reader of the storage of address that verifies
+// every slot it reads, fetched with eth_getProof at blockRef, against
+// stateRoot.
+func (c *ProofClient) NewStorageReader(ctx context.Context, stateRoot common.Hash, address common.Address, blockRef string) *StorageReader {
+	return NewStorageReader(c.verifier, stateRoot, address, c.StorageProofSource(ctx, address, blockRef))
+}
+
 // VerifiedProofResult contains the complete result of a verified proof request,
 // including both the raw RPC response and verification results.
 type VerifiedProofResult struct {
@@ -252,6 +381,9 @@ type VerifiedProofResult struct {
 	// Account verification result
 	AccountResult *AccountProofResult
 
+	// Verification of the response codeHash against the account proof
+	CodeResult *CodeProofResult
+
 	// Storage verification results (keyed by storage slot)
 	StorageResults map[common.Hash]*StorageProofResult
 
@@ -293,11 +425,22 @@ func (c *ProofClient) GetAndVerifyFullProof(
 	if err != nil {
 		return nil, fmt.Errorf("account proof verification error: %w", err)
 	}
+	checkProvenAccountFields(proof, accountResult)
 	result.AccountResult = accountResult
 	if !accountResult.Valid {
 		result.AllValid = false
 	}
 
+	// The code node is embedded in the account proof, so codeHash is checked too
+	codeResult, err := c.verifier.VerifyCodeProof(stateRoot, address, proof.CodeHash, nil, accountProofNodes)
+	if err != nil {
+		return nil, fmt.Errorf("code proof verification error: %w", err)
+	}
+	result.CodeResult = codeResult
+	if !codeResult.Valid {
+		result.AllValid = false
+	}
+
 	// Verify each storage proof
 	for _, sp := range proof.StorageProof {
 		keyHash := common.HexToHash(sp.Key)
@@ -321,7 +464,42 @@ func (c *ProofClient) GetAndVerifyFullProof(
 	return result, nil
 }
 
+// CheckAccountFields compares the balance and nonce of the response with the
+// account state proven by a valid account proof result, and returns an
+// ErrAccountFieldMismatch error if they differ. An absent account must be
+// reported with a zero balance and nonce.
+func (p *ProofResponse) CheckAccountFields(result *AccountProofResult) error {
+	if !result.Valid {
+		return fmt.Errorf("account proof is not valid: %v", result.Error)
+	}
+
+	balance, nonce := new(big.Int), uint64(0)
+	if result.Account != nil {
+		balance, nonce = result.Account.Balance, result.Account.Nonce
+	}
+	if p.GetBalance().Cmp(balance) != 0 {
+		return fmt.Errorf("%w: balance %s, proven %s", ErrAccountFieldMismatch, p.GetBalance(), balance)
+	}
+	if p.GetNonce() != nonce {
+		return fmt.Errorf("%w: nonce %d, proven %d", ErrAccountFieldMismatch, p.GetNonce(), nonce)
+	}
+	return nil
+}
+
+// checkProvenAccountFields invalidates a valid account result whose response
+// reports other account fields than the proof.
+func checkProvenAccountFields(proof *ProofResponse, result *AccountProofResult) {
+	if !result.Valid {
+		return
+	}
+	if err := proof.CheckAccountFields(result); err != nil {
+		result.Valid = false
+		result.Error = err
+	}
+}
+
 // GetBalance returns the account balance from a proof response.
+// The value is reported by the RPC node; see CheckAccountFields.
 func (p *ProofResponse) GetBalance() *big.Int {
 	if p.Balance == nil {
 		return big.NewInt(0)
@@ -330,15 +508,17 @@ func (p *ProofResponse) GetBalance() *big.Int {
 }
 
 // GetNonce returns the account nonce from a proof response.
+// The value is reported by the RPC node; see CheckAccountFields.
 func (p *ProofResponse) GetNonce() uint64 {
 	return uint64(p.Nonce)
 }
 
 // IsContract returns true if the account has code (is a contract).
-// An empty code hash (keccak256 of empty) indicates an EOA.
+// An empty code hash (keccak256 of empty) indicates an EOA, and a zero code
+// hash an account that does not exist.
+// The code hash is reported by the RPC node; see ProofVerifier.VerifyCodeProof.
 func (p *ProofResponse) IsContract() bool {
-	emptyCodeHash := common.HexToHash("0xc5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470")
-	return p.CodeHash != emptyCodeHash
+	return p.CodeHash != EmptyCodeHash && p.CodeHash != (common.Hash{})
 }
 
 // GetStorageValue returns the storage value for a given key from the proof response.
@@ -355,3 +535,43 @@ func (p *ProofResponse) GetStorageValue(key common.Hash) *big.Int {
 	}
 	return nil
 }
+
+// decodeProofs decodes the account proof followed by the storage proofs
+func (p *ProofResponse) decodeProofs() ([][][]byte, error) {
+	accountProofNodes, err := DecodeRLPProofNodes(p.AccountProof)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode account proof nodes: %w", err)
+	}
+	proofs := [][][]byte{accountProofNodes}
+	for _, sp := range p.StorageProof {
+		proofNodes, err := DecodeRLPProofNodes(sp.Proofs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode storage proof nodes for key %s: %w", sp.Key, err)
+		}
+		proofs = append(proofs, proofNodes)
+	}
+	return proofs, nil
+}
+
+// MultiProof compacts the account and storage proofs of the response into a
+// single rsktrie.MultiProof for stateRoot, which holds the nodes they share
+// once; much smaller to pass on than the response when it has many storage
+// proofs. It proves the keys returned by MultiProofKeys.
+func (p *ProofResponse) MultiProof(stateRoot common.Hash) (*rsktrie.MultiProof, error) {
+	proofs, err := p.decodeProofs()
+	if err != nil {
+		return nil, err
+	}
+	return rsktrie.NewMultiProof(stateRoot[:], proofs...)
+}
+
+// MultiProofKeys returns the trie keys of the account and of each storage
+// proof of the response, in that order.
+func (p *ProofResponse) MultiProofKeys() [][]byte {
+	mapper := rsktrie.NewTrieKeyMapper()
+	keys := [][]byte{mapper.GetAccountKey(p.Address)}
+	for _, sp := range p.StorageProof {
+		keys = append(keys, mapper.GetAccountStorageKey(p.Address, common.HexToHash(sp.Key)))
+	}
+	return keys
+}
@@ -1,15 +1,21 @@
 package rskblocks
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/ethereum-optimism/optimism/op-service/rsk/gorsk/rsktrie"
+
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
@@ -75,6 +81,11 @@ func TestProofResponse_IsContract(t *testing.T) {
 			codeHash:   "0xc10f4e2caad321ec73bc2f9fb53dc69f934417616ae7f04622fb43ecbd8a27b2",
 			isContract: true,
 		},
+		{
+			name:       "Missing account (zero code hash)",
+			codeHash:   "0x0000000000000000000000000000000000000000000000000000000000000000",
+			isContract: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -154,6 +165,335 @@ func TestProofResponse_GetBalance(t *testing.T) {
 	})
 }
 
+func TestProofResponse_CheckAccountFields(t *testing.T) {
+	proven := &AccountProofResult{Valid: true, Account: &AccountState{Nonce: 3, Balance: big.NewInt(500)}}
+
+	t.Run("matching fields", func(t *testing.T) {
+		response := &ProofResponse{Balance: (*hexutil.Big)(big.NewInt(500)), Nonce: 3}
+		if err := response.CheckAccountFields(proven); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+
+	t.Run("lying balance", func(t *testing.T) {
+		response := &ProofResponse{Balance: (*hexutil.Big)(big.NewInt(501)), Nonce: 3}
+		if err := response.CheckAccountFields(proven); !errors.Is(err, ErrAccountFieldMismatch) {
+			t.Errorf("Expected ErrAccountFieldMismatch, got %v", err)
+		}
+	})
+
+	t.Run("lying nonce", func(t *testing.T) {
+		response := &ProofResponse{Balance: (*hexutil.Big)(big.NewInt(500)), Nonce: 4}
+		if err := response.CheckAccountFields(proven); !errors.Is(err, ErrAccountFieldMismatch) {
+			t.Errorf("Expected ErrAccountFieldMismatch, got %v", err)
+		}
+	})
+
+	t.Run("absent account", func(t *testing.T) {
+		absent := &AccountProofResult{Valid: true, Absent: true}
+		if err := (&ProofResponse{}).CheckAccountFields(absent); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		response := &ProofResponse{Balance: (*hexutil.Big)(big.NewInt(1))}
+		if err := response.CheckAccountFields(absent); !errors.Is(err, ErrAccountFieldMismatch) {
+			t.Errorf("Expected ErrAccountFieldMismatch, got %v", err)
+		}
+	})
+}
+
+// TestGetAndVerifyAccountProof_LyingBalance serves a valid proof with a wrong JSON balance
+func TestGetAndVerifyAccountProof_LyingBalance(t *testing.T) {
+	mapper := rsktrie.NewTrieKeyMapper()
+	address := common.HexToAddress("0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826")
+	accountState, _ := rlp.EncodeToBytes(&AccountState{Nonce: 5, Balance: big.NewInt(1000)})
+	trie := rsktrie.NewTrie(nil).Put(mapper.GetAccountKey(address), accountState)
+	proofNodes, _ := trie.GetProof(mapper.GetAccountKey(address))
+	hexNodes := make([]string, len(proofNodes))
+	for i, node := range proofNodes {
+		hexNodes[i] = hexutil.Encode(node)
+	}
+
+	for _, balance := range []string{"0x3e8", "0xde0b6b3a7640000"} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result, _ := json.Marshal(map[string]interface{}{
+				"address":      address,
+				"accountProof": hexNodes,
+				"balance":      balance,
+				"codeHash":     common.Hash{},
+				"nonce":        "0x5",
+				"storageHash":  common.Hash{},
+				"storageProof": []interface{}{},
+			})
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":` + string(result) + `}`))
+		}))
+
+		client, err := NewProofClient(server.URL)
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+		result, err := client.GetAndVerifyAccountProof(context.Background(), common.BytesToHash(trie.GetHash()), address, "latest")
+		client.Close()
+		server.Close()
+		if err != nil {
+			t.Fatalf("GetAndVerifyAccountProof failed: %v", err)
+		}
+
+		honest := balance == "0x3e8"
+		if result.Valid != honest {
+			t.Errorf("Balance %s: expected Valid=%v, got %+v", balance, honest, result)
+		}
+		if !honest && !errors.Is(result.Error, ErrAccountFieldMismatch) {
+			t.Errorf("Balance %s: expected ErrAccountFieldMismatch, got %v", balance, result.Error)
+		}
+	}
+}
+
+func TestGetAndVerifyCodeProof_MockServer(t *testing.T) {
+	mapper := rsktrie.NewTrieKeyMapper()
+	address := common.HexToAddress("0x77045E71a7A2c50903d88e564cD72fab11e82051")
+	code := bytes.Repeat([]byte{0x60, 0x80, 0x60, 0x40, 0x52}, 20)
+	codeHash := common.BytesToHash(rsktrie.Keccak256(code))
+	accountState, _ := rlp.EncodeToBytes(&AccountState{Nonce: 1, Balance: big.NewInt(0)})
+	trie := rsktrie.NewTrie(nil).
+		Put(mapper.GetAccountKey(address), accountState).
+		Put(mapper.GetCodeKey(address), code)
+	proofNodes, _ := trie.GetProof(mapper.GetAccountKey(address))
+	hexNodes := make([]string, len(proofNodes))
+	for i, node := range proofNodes {
+		hexNodes[i] = hexutil.Encode(node)
+	}
+
+	tests := []struct {
+		name      string
+		codeHash  common.Hash
+		code      []byte
+		wantValid bool
+	}{
+		{"honest", codeHash, code, true},
+		{"lying code", codeHash, code[1:], false},
+		{"lying code hash", EmptyCodeHash, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req struct {
+					Method string `json:"method"`
+				}
+				json.NewDecoder(r.Body).Decode(&req)
+
+				var result []byte
+				switch req.Method {
+				case "eth_getProof":
+					result, _ = json.Marshal(map[string]interface{}{
+						"address":      address,
+						"accountProof": hexNodes,
+						"balance":      "0x0",
+						"codeHash":     tt.codeHash,
+						"nonce":        "0x1",
+						"storageHash":  common.Hash{},
+						"storageProof": []interface{}{},
+					})
+				case "eth_getCode":
+					result, _ = json.Marshal(hexutil.Bytes(tt.code))
+				default:
+					t.Errorf("Unexpected method %s", req.Method)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":` + string(result) + `}`))
+			}))
+			defer server.Close()
+
+			client, err := NewProofClient(server.URL)
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+			defer client.Close()
+
+			result, err := client.GetAndVerifyCodeProof(context.Background(), common.BytesToHash(trie.GetHash()), address, "latest")
+			if err != nil {
+				t.Fatalf("GetAndVerifyCodeProof failed: %v", err)
+			}
+			if result.Valid != tt.wantValid {
+				t.Fatalf("Expected Valid=%v, got %+v", tt.wantValid, result)
+			}
+			if tt.wantValid && !bytes.Equal(result.Code, code) {
+				t.Errorf("Expected verified code %x, got %x", code, result.Code)
+			}
+			if !tt.wantValid && !errors.Is(result.Error, ErrCodeHashMismatch) {
+				t.Errorf("Expected ErrCodeHashMismatch, got %v", result.Error)
+			}
+		})
+	}
+}
+
+func TestGetAndVerifyStorageRoot_MockServer(t *testing.T) {
+	mapper := rsktrie.NewTrieKeyMapper()
+	trie := buildStorageTestTrie([]byte{0x01})
+	root, _ := StorageRoot(trie, storageTestContract)
+	encode := func(proofNodes [][]byte) []string {
+		hexNodes := make([]string, len(proofNodes))
+		for i, node := range proofNodes {
+			hexNodes[i] = hexutil.Encode(node)
+		}
+		return hexNodes
+	}
+	accountProof, _ := trie.GetProof(mapper.GetAccountKey(storageTestContract))
+	slotProof, _ := trie.GetProof(mapper.GetAccountStorageKey(storageTestContract, common.Hash{}))
+
+	for _, storageHash := range []common.Hash{root.StorageHash, EmptyStorageHash} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				Params []json.RawMessage `json:"params"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			if len(req.Params) < 2 || string(req.Params[1]) == "[]" {
+				t.Errorf("Expected a storage key to be requested, got params %s", req.Params)
+			}
+
+			result, _ := json.Marshal(map[string]interface{}{
+				"address":      storageTestContract,
+				"accountProof": encode(accountProof),
+				"balance":      "0x0",
+				"codeHash":     EmptyCodeHash,
+				"nonce":        "0x1",
+				"storageHash":  storageHash,
+				"storageProof": []interface{}{map[string]interface{}{
+					"key":   "0x0",
+					"value": "0x2a",
+					"proof": encode(slotProof),
+				}},
+			})
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":` + string(result) + `}`))
+		}))
+
+		client, err := NewProofClient(server.URL)
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+		result, err := client.GetAndVerifyStorageRoot(context.Background(), common.BytesToHash(trie.GetHash()), storageTestContract, "latest")
+		client.Close()
+		server.Close()
+		if err != nil {
+			t.Fatalf("GetAndVerifyStorageRoot failed: %v", err)
+		}
+
+		honest := storageHash == root.StorageHash
+		if result.Valid != honest {
+			t.Errorf("Storage hash %s: expected Valid=%v, got %+v", storageHash.Hex(), honest, result)
+		}
+		if !honest && !errors.Is(result.Error, ErrStorageHashMismatch) {
+			t.Errorf("Storage hash %s: expected ErrStorageHashMismatch, got %v", storageHash.Hex(), result.Error)
+		}
+	}
+}
+
+func TestProofResponse_MultiProof(t *testing.T) {
+	mapper := rsktrie.NewTrieKeyMapper()
+	trie := buildStorageTestTrie([]byte{0x01})
+	stateRoot := common.BytesToHash(trie.GetHash())
+	encode := func(key []byte) []string {
+		proofNodes, _ := trie.GetProof(key)
+		hexNodes := make([]string, len(proofNodes))
+		for i, node := range proofNodes {
+			hexNodes[i] = hexutil.Encode(node)
+		}
+		return hexNodes
+	}
+
+	response := &ProofResponse{
+		Address:      storageTestContract,
+		AccountProof: encode(mapper.GetAccountKey(storageTestContract)),
+	}
+	for _, slot := range []string{"0x0", "0x1", "0x99"} {
+		response.StorageProof = append(response.StorageProof, StorageProof{
+			Key:    slot,
+			Proofs: encode(mapper.GetAccountStorageKey(storageTestContract, common.HexToHash(slot))),
+		})
+	}
+
+	proof, err := response.MultiProof(stateRoot)
+	if err != nil {
+		t.Fatalf("MultiProof failed: %v", err)
+	}
+	result, _ := rsktrie.NewProofVerifier().VerifyMultiProof(stateRoot, response.MultiProofKeys(), proof)
+	if !result.Valid {
+		t.Fatalf("Expected a valid multiproof, got %v", result.Error)
+	}
+
+	want := [][]byte{trie.Get(mapper.GetAccountKey(storageTestContract)), {0x2a}, {0x01}, nil}
+	for i, proven := range result.Keys {
+		if !bytes.Equal(proven.Value, want[i]) {
+			t.Errorf("Key %d: expected %x, got %x", i, want[i], proven.Value)
+		}
+	}
+
+	if _, err := response.MultiProof(common.Hash{0x01}); err == nil {
+		t.Error("Expected an error for another state root")
+	}
+}
+
+func TestProofClient_NewStorageReader(t *testing.T) {
+	s := newTestContractStorage()
+	s.set(slotN(0), slotN(42))
+	setLongBytes(s, slotN(1), bytes.Repeat([]byte("rsk"), 20))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Params []json.RawMessage `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		var keys []common.Hash
+		json.Unmarshal(req.Params[1], &keys)
+
+		// Respond in reverse order, with keys in the short form of RSKj
+		storageProofs := make([]map[string]interface{}, 0, len(keys))
+		for i := len(keys) - 1; i >= 0; i-- {
+			proofNodes, _ := s.trie.GetProof(s.mapper.GetAccountStorageKey(s.address, keys[i]))
+			hexNodes := make([]string, len(proofNodes))
+			for j, node := range proofNodes {
+				hexNodes[j] = hexutil.Encode(node)
+			}
+			storageProofs = append(storageProofs, map[string]interface{}{
+				"key":   hexutil.EncodeBig(new(big.Int).SetBytes(keys[i][:])),
+				"value": "0x0",
+				"proof": hexNodes,
+			})
+		}
+
+		result, _ := json.Marshal(map[string]interface{}{
+			"address":      s.address,
+			"accountProof": []string{},
+			"balance":      "0x0",
+			"codeHash":     EmptyCodeHash,
+			"nonce":        "0x1",
+			"storageHash":  common.Hash{},
+			"storageProof": storageProofs,
+		})
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":` + string(result) + `}`))
+	}))
+	defer server.Close()
+
+	client, err := NewProofClient(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	reader := client.NewStorageReader(context.Background(), common.BytesToHash(s.trie.GetHash()), s.address, "latest")
+	value, err := reader.ReadValue(SlotLocation(slotN(0)), StorageKindUint)
+	if err != nil || value.(*big.Int).Int64() != 42 {
+		t.Errorf("Expected 42, got %v (%v)", value, err)
+	}
+	value, err = reader.ReadValue(SlotLocation(slotN(1)), StorageKindString)
+	if err != nil || value != strings.Repeat("rsk", 20) {
+		t.Errorf("Expected a 60-byte string, got %v (%v)", value, err)
+	}
+}
+
 func TestStorageProof_ProofField(t *testing.T) {
 	// Ensure our struct uses "proof" (singular) matching Ethereum standard
 	sp := StorageProof{
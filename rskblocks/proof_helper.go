@@ -14,53 +14,88 @@
 // Storage key: AccountKey + StoragePrefix(0x00) + SecureKeyPrefix(keccak256(slot)[:10]) + stripLeadingZeros(slot)
 // Code key: AccountKey + CodePrefix(0x80)
 //
+// The value of the code key is the contract bytecode, and its value hash the
+// codeHash of eth_getProof. VerifyCodeProof checks it using the account proof.
+//
 // # Usage Example
 //
 //	verifier := rskblocks.NewProofVerifier()
 //	result, err := verifier.VerifyAccountProof(stateRoot, address, proofNodes)
-//	if result.Valid {
-//	    fmt.Println("Account exists with value:", result.Value)
+//	if result.Valid && !result.Absent {
+//	    fmt.Println("Account balance:", result.Account.Balance)
 //	}
 package rskblocks
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
 
 	"github.com/ethereum-optimism/optimism/op-service/rsk/gorsk/rsktrie"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/rlp"
 )
 
-// ProofVerifier verifies Merkle proofs from eth_getProof for RSK's binary trie
+// EmptyCodeHash is the code hash of accounts without code: keccak256 of no bytes.
+var EmptyCodeHash = common.HexToHash("0xc5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470")
+
+// ErrCodeHashMismatch is returned when a code proof, or the supplied code,
+// does not match the expected code hash.
+var ErrCodeHashMismatch = errors.New("code hash does not match the proven code node")
+
+// ProofVerifier verifies Merkle proofs from eth_getProof for RSK's binary trie.
+//
+// It extends rsktrie.ProofVerifier, whose proof walk it shares, with decoded
+// account states and code proofs. VerifyStorageProof, VerifyStorageValue,
+// VerifyProofValue and VerifyMultiProof are those of rsktrie.ProofVerifier.
 type ProofVerifier struct {
+	*rsktrie.ProofVerifier
 	keyMapper *rsktrie.TrieKeyMapper
 }
 
 // NewProofVerifier creates a new proof verifier for RSK state proofs
 func NewProofVerifier() *ProofVerifier {
 	return &ProofVerifier{
-		keyMapper: rsktrie.NewTrieKeyMapper(),
+		ProofVerifier: rsktrie.NewProofVerifier(),
+		keyMapper:     rsktrie.NewTrieKeyMapper(),
 	}
 }
 
 // AccountProofResult contains the result of account proof verification
 type AccountProofResult struct {
-	Valid   bool           // Whether the proof is valid
-	Address common.Address // The verified address
-	Value   []byte         // RLP-encoded account state (nonce, balance)
-	Error   error          // Error if verification failed
+	Valid     bool            // Whether the proof is valid
+	Address   common.Address  // The verified address
+	Value     []byte          // RLP-encoded account state (nonce, balance)
+	Account   *AccountState   // Decoded Value; nil when Absent
+	Absent    bool            // Whether the proof shows that the account does not exist
+	Exclusion *ExclusionProof // How the path ends when Absent is set
+	Trace     []ProofStep     // The nodes checked, up to a failure if any
+	Error     error           // Error if verification failed
 }
 
 // StorageProofResult contains the result of storage proof verification
-type StorageProofResult struct {
-	Valid      bool        // Whether the proof is valid
-	StorageKey common.Hash // The verified storage key
-	Value      []byte      // The storage value
-	Error      error       // Error if verification failed
+type StorageProofResult = rsktrie.StorageProofResult
+
+// CodeProofResult contains the result of code proof verification
+type CodeProofResult struct {
+	Valid      bool            // Whether the proof is valid and matches the expected code hash
+	Address    common.Address  // The verified address
+	CodeHash   common.Hash     // Proven code hash; EmptyCodeHash when Absent, zero when the account is missing
+	CodeLength uint32          // Proven code length in bytes
+	Code       []byte          // The supplied bytecode, when it matches CodeHash
+	Absent     bool            // Whether the proof shows that the account has no code
+	Exclusion  *ExclusionProof // How the path ends when Absent is set
+	Trace      []ProofStep     // The nodes checked, up to a failure if any
+	Error      error           // Error if verification failed
 }
 
+// ExclusionProof describes how a proof shows that a key is not in the trie:
+// the reason, the key bit where the path ends and the last node on it.
+type ExclusionProof = rsktrie.ExclusionProof
+
+// ProofStep records a node checked while verifying a proof: its hash, the key
+// bits matched against its shared path and the key bit leading to its child.
+type ProofStep = rsktrie.ProofStep
+
 // VerifyAccountProof verifies an account proof against a state root.
 //
 // Parameters:
@@ -69,7 +104,9 @@ type StorageProofResult struct {
 //   - proofNodes: RLP-encoded trie nodes from eth_getProof accountProof field
 //
 // Returns AccountProofResult with Valid=true if the proof is valid.
-// The Value field contains the RLP-encoded account state if the account exists.
+// The Value field contains the RLP-encoded account state if the account exists,
+// and Account its decoded fields; otherwise Absent is set and Exclusion tells
+// where the path ends. A proven value that is not an account state is invalid.
 func (v *ProofVerifier) VerifyAccountProof(
 	stateRoot common.Hash,
 	address common.Address,
@@ -79,186 +116,120 @@ func (v *ProofVerifier) VerifyAccountProof(
 	trieKey := v.keyMapper.GetAccountKey(address)
 
 	// Verify the proof path
-	value, err := v.verifyProof(stateRoot[:], trieKey, proofNodes)
+	walk, err := rsktrie.WalkProof(stateRoot[:], trieKey, proofNodes)
 	if err != nil {
 		return &AccountProofResult{
 			Valid:   false,
 			Address: address,
+			Trace:   walk.Trace,
 			Error:   err,
 		}, nil
 	}
 
-	return &AccountProofResult{
-		Valid:   true,
-		Address: address,
-		Value:   value,
-	}, nil
+	result := &AccountProofResult{
+		Valid:     true,
+		Address:   address,
+		Value:     walk.Value(),
+		Absent:    walk.Exclusion != nil,
+		Exclusion: walk.Exclusion,
+		Trace:     walk.Trace,
+	}
+	if walk.Exclusion == nil {
+		account, err := DecodeAccountState(result.Value)
+		if err != nil {
+			result.Valid = false
+			result.Error = fmt.Errorf("decode account state %x: %w", result.Value, err)
+			return result, nil
+		}
+		result.Account = account
+	}
+	return result, nil
 }
 
-// VerifyStorageProof verifies a storage proof for a contract.
+// VerifyCodeProof verifies that the code node of an account matches codeHash.
 //
-// In RSK, storage is in the same unified trie as accounts.
-// The storage key includes the account key as a prefix.
+// The code of an account is stored under its code key, a child of the account
+// key whose value hash is the code hash. The code node is small enough to be
+// embedded in the account node, so the accountProof of eth_getProof also
+// proves the code hash.
 //
 // Parameters:
 //   - stateRoot: The state root from the block header
-//   - address: The contract address
-//   - storageKey: The storage slot (32 bytes)
-//   - proofNodes: RLP-encoded trie nodes from eth_getProof storageProof[].proofs field
+//   - address: The account address to verify
+//   - codeHash: The expected code hash, e.g. the eth_getProof codeHash field
+//   - code: The bytecode, e.g. from eth_getCode; nil to only verify the hash
+//   - proofNodes: RLP-encoded trie nodes from eth_getProof accountProof field
 //
-// Returns StorageProofResult with Valid=true if the proof is valid.
-func (v *ProofVerifier) VerifyStorageProof(
+// Returns CodeProofResult with Valid=true if the proof is valid and proves
+// codeHash. An account without code has the EmptyCodeHash, and one that does
+// not exist the zero hash, as RSKj's getCodeHashStandard reports them. A
+// supplied code must hash to codeHash too; it is then set as the Code of the
+// result.
+func (v *ProofVerifier) VerifyCodeProof(
 	stateRoot common.Hash,
 	address common.Address,
-	storageKey common.Hash,
+	codeHash common.Hash,
+	code []byte,
 	proofNodes [][]byte,
-) (*StorageProofResult, error) {
-	// In RSK, storage is in the unified trie
-	// Key: accountKey + storagePrefix + secureKey(slot) + slot
-	trieKey := v.keyMapper.GetAccountStorageKey(address, storageKey)
+) (*CodeProofResult, error) {
+	trieKey := v.keyMapper.GetCodeKey(address)
 
-	// Verify the proof path
-	value, err := v.verifyProof(stateRoot[:], trieKey, proofNodes)
+	walk, err := rsktrie.WalkProof(stateRoot[:], trieKey, proofNodes)
 	if err != nil {
-		return &StorageProofResult{
-			Valid:      false,
-			StorageKey: storageKey,
-			Error:      err,
+		return &CodeProofResult{
+			Valid:   false,
+			Address: address,
+			Trace:   walk.Trace,
+			Error:   err,
 		}, nil
 	}
 
-	return &StorageProofResult{
-		Valid:      true,
-		StorageKey: storageKey,
-		Value:      value,
-	}, nil
-}
-
-// VerifyStorageValue verifies a storage proof and checks the expected value
-func (v *ProofVerifier) VerifyStorageValue(
-	stateRoot common.Hash,
-	address common.Address,
-	storageKey common.Hash,
-	expectedValue []byte,
-	proofNodes [][]byte,
-) (bool, error) {
-	result, err := v.VerifyStorageProof(stateRoot, address, storageKey, proofNodes)
-	if err != nil {
-		return false, err
-	}
-	if !result.Valid {
-		return false, result.Error
+	result := &CodeProofResult{
+		Valid:     true,
+		Address:   address,
+		CodeHash:  EmptyCodeHash,
+		Absent:    walk.Exclusion != nil,
+		Exclusion: walk.Exclusion,
+		Trace:     walk.Trace,
 	}
-	return bytes.Equal(result.Value, expectedValue), nil
-}
-
-// verifyProof walks through the proof nodes and verifies the path
-func (v *ProofVerifier) verifyProof(expectedHash []byte, key []byte, proofNodes [][]byte) ([]byte, error) {
-	if len(proofNodes) == 0 {
-		return nil, fmt.Errorf("empty proof")
+	// Long values are not part of proofs, but their hash and length are
+	if node := walk.Node; node != nil {
+		result.CodeHash = common.BytesToHash(node.GetValueHash())
+		result.CodeLength = uint32(node.GetValueLength())
+	} else if !accountOnPath(walk.Trace, len(v.keyMapper.GetAccountKey(address))*8) {
+		result.CodeHash = common.Hash{}
 	}
 
-	// RSK proof nodes are RLP-encoded. The hash is Keccak256 of the serialized (not RLP) content.
-	// Proof order is leaf-to-root (last node is root).
-	type nodeEntry struct {
-		node           *rsktrie.Trie
-		serializedHash []byte
+	if codeHash != result.CodeHash {
+		result.Valid = false
+		result.Error = fmt.Errorf("%w: expected %s, proven %s", ErrCodeHashMismatch, codeHash.Hex(), result.CodeHash.Hex())
+		return result, nil
 	}
-	nodeMap := make(map[string]nodeEntry)
-
-	for i, rlpNode := range proofNodes {
-		// RLP decode to get serialized node
-		var serializedNode []byte
-		if err := rlp.DecodeBytes(rlpNode, &serializedNode); err != nil {
-			return nil, fmt.Errorf("failed to RLP decode proof node %d: %w", i, err)
+	if code != nil {
+		hash := common.BytesToHash(rsktrie.Keccak256(code))
+		if len(code) == 0 && result.CodeHash == (common.Hash{}) {
+			// The account does not exist, so it has no code either
+			hash = common.Hash{}
 		}
-
-		// Hash of serialized content
-		nodeHash := rsktrie.Keccak256(serializedNode)
-
-		// Parse the node
-		node, err := rsktrie.FromMessage(serializedNode, nil)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse proof node %d: %w", i, err)
+		if hash != result.CodeHash || uint32(len(code)) != result.CodeLength {
+			result.Valid = false
+			result.Error = fmt.Errorf("%w: code of %d bytes hashes to %s, proven %s", ErrCodeHashMismatch, len(code), hash.Hex(), result.CodeHash.Hex())
+			return result, nil
 		}
-
-		nodeMap[string(nodeHash)] = nodeEntry{node: node, serializedHash: nodeHash}
-	}
-
-	// Convert key to bit representation for traversal
-	keySlice := rsktrie.TrieKeySliceFromKey(key)
-
-	// Find the root node (should match expectedHash)
-	rootEntry, ok := nodeMap[string(expectedHash)]
-	if !ok {
-		return nil, fmt.Errorf("root hash %x not found in proof nodes", expectedHash)
+		result.Code = code
 	}
-	currentNode := rootEntry.node
-
-	// Walk the path
-	keyPos := 0
-	for {
-		// Check shared path
-		sharedPath := currentNode.GetSharedPath()
-		if sharedPath.Length() > 0 {
-			// Verify shared path matches
-			remaining := keySlice.Length() - keyPos
-			if remaining < sharedPath.Length() {
-				return nil, fmt.Errorf("key too short for shared path at position %d", keyPos)
-			}
-
-			for i := 0; i < sharedPath.Length(); i++ {
-				keyBit := keySlice.Get(keyPos + i)
-				pathBit := sharedPath.Get(i)
-				if keyBit != pathBit {
-					// Key diverges from path - value doesn't exist
-					return nil, nil
-				}
-			}
-			keyPos += sharedPath.Length()
-		}
-
-		// Check if we've consumed the entire key
-		if keyPos >= keySlice.Length() {
-			// Found the node - return its value
-			return currentNode.GetValue(), nil
-		}
-
-		// Get next bit and follow child
-		nextBit := keySlice.Get(keyPos)
-		keyPos++
-
-		var childRef *rsktrie.NodeReference
-		if nextBit == 0 {
-			childRef = currentNode.GetLeft()
-		} else {
-			childRef = currentNode.GetRight()
-		}
-
-		if childRef.IsEmpty() {
-			// No child - value doesn't exist
-			return nil, nil
-		}
-
-		// Get child hash
-		childHash := childRef.GetHash()
-		if childHash == nil {
-			// Embedded node - get directly
-			childNode := childRef.GetNode()
-			if childNode == nil {
-				return nil, fmt.Errorf("missing embedded child node")
-			}
-			currentNode = childNode
-			continue
-		}
+	return result, nil
+}
 
-		// Look up child in proof nodes
-		childEntry, ok := nodeMap[string(childHash)]
-		if !ok {
-			return nil, fmt.Errorf("missing proof node for hash %x", childHash)
+// accountOnPath tells whether the trace of a walk below an account key,
+// accountBits long, goes through the node holding the account
+func accountOnPath(trace []ProofStep, accountBits int) bool {
+	for _, step := range trace {
+		if step.ChildBit == accountBits {
+			return step.HasValue
 		}
-		currentNode = childEntry.node
 	}
+	return false
 }
 
 // DecodeRLPProofNodes decodes hex-encoded RLP proof nodes from eth_getProof response
@@ -1,9 +1,15 @@
 package rskblocks
 
 import (
+	"bytes"
+	"errors"
+	"math/big"
 	"testing"
 
+	"github.com/ethereum-optimism/optimism/op-service/rsk/gorsk/rsktrie"
+
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
 )
 
 func TestDecodeRLPProofNodes(t *testing.T) {
@@ -85,6 +91,217 @@ func TestVerifyStorageProof_EmptyProof(t *testing.T) {
 	}
 }
 
+func TestVerifyStorageProof_AbsentSlot(t *testing.T) {
+	mapper := rsktrie.NewTrieKeyMapper()
+	address := common.HexToAddress("0x77045E71a7A2c50903d88e564cD72fab11e82051")
+	storedSlot := common.HexToHash("0x0")
+	missingSlot := common.HexToHash("0x1")
+
+	trie := rsktrie.NewTrie(rsktrie.NewMemTrieStore()).
+		Put(mapper.GetAccountKey(address), []byte{0x01}).
+		Put(mapper.GetAccountStorageKey(address, storedSlot), []byte{0x2a})
+	stateRoot := common.BytesToHash(trie.GetHash())
+	verifier := NewProofVerifier()
+
+	proofNodes, err := trie.GetProof(mapper.GetAccountStorageKey(address, missingSlot))
+	if err != nil {
+		t.Fatalf("GetProof failed: %v", err)
+	}
+	result, err := verifier.VerifyStorageProof(stateRoot, address, missingSlot, proofNodes)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !result.Valid || !result.Absent || result.Exclusion == nil {
+		t.Fatalf("Expected slot to be proven absent, got %+v", result)
+	}
+
+	proofNodes, err = trie.GetProof(mapper.GetAccountStorageKey(address, storedSlot))
+	if err != nil {
+		t.Fatalf("GetProof failed: %v", err)
+	}
+	result, err = verifier.VerifyStorageProof(stateRoot, address, storedSlot, proofNodes)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !result.Valid || result.Absent || string(result.Value) != "\x2a" {
+		t.Fatalf("Expected slot to be present, got %+v", result)
+	}
+
+	// The account leaf is not on the path of the slot key
+	accountProof, err := trie.GetProof(mapper.GetAccountKey(address))
+	if err != nil {
+		t.Fatalf("GetProof failed: %v", err)
+	}
+	if len(accountProof) > 0 {
+		withExtra := append(append([][]byte{}, proofNodes...), accountProof...)
+		result, err = verifier.VerifyStorageProof(stateRoot, address, storedSlot, withExtra)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.Valid {
+			t.Error("Expected proof with extra nodes to be invalid")
+		}
+	}
+}
+
+func TestVerifyAccountProof_DecodesAccountState(t *testing.T) {
+	mapper := rsktrie.NewTrieKeyMapper()
+	address := common.HexToAddress("0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826")
+	broken := common.HexToAddress("0x77045E71a7A2c50903d88e564cD72fab11e82051")
+
+	accountState, _ := rlp.EncodeToBytes(&AccountState{Nonce: 7, Balance: big.NewInt(1000000)})
+	trie := rsktrie.NewTrie(rsktrie.NewMemTrieStore()).
+		Put(mapper.GetAccountKey(address), accountState).
+		Put(mapper.GetAccountKey(broken), []byte{0x01})
+	stateRoot := common.BytesToHash(trie.GetHash())
+	verifier := NewProofVerifier()
+
+	proofNodes, _ := trie.GetProof(mapper.GetAccountKey(address))
+	result, err := verifier.VerifyAccountProof(stateRoot, address, proofNodes)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !result.Valid || result.Account == nil {
+		t.Fatalf("Expected a decoded account, got %+v", result)
+	}
+	if result.Account.Nonce != 7 || result.Account.Balance.Cmp(big.NewInt(1000000)) != 0 {
+		t.Errorf("Unexpected account state %+v", result.Account)
+	}
+
+	// A proven value that is not an account state
+	proofNodes, _ = trie.GetProof(mapper.GetAccountKey(broken))
+	result, err = verifier.VerifyAccountProof(stateRoot, broken, proofNodes)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Valid || result.Error == nil {
+		t.Errorf("Expected an undecodable account state to be invalid, got %+v", result)
+	}
+}
+
+func TestProofVerifier_SharedWithRsktrie(t *testing.T) {
+	mapper := rsktrie.NewTrieKeyMapper()
+	trie := buildStorageTestTrie([]byte{0x01})
+	stateRoot := common.BytesToHash(trie.GetHash())
+	verifier := NewProofVerifier()
+
+	storageKey := mapper.GetAccountStorageKey(storageTestContract, common.Hash{})
+	proof, _ := trie.GetProof(storageKey)
+
+	if ok, err := verifier.VerifyStorageValue(stateRoot, storageTestContract, common.Hash{}, []byte{0x2a}, proof); !ok || err != nil {
+		t.Errorf("VerifyStorageValue: expected a match, got %v %v", ok, err)
+	}
+	if ok, err := verifier.VerifyProofValue(stateRoot, storageKey, []byte{0x2a}, proof); !ok || err != nil {
+		t.Errorf("VerifyProofValue: expected a match, got %v %v", ok, err)
+	}
+
+	accountProof, _ := trie.GetProof(mapper.GetAccountKey(storageTestContract))
+	account, _ := verifier.VerifyAccountProof(stateRoot, storageTestContract, accountProof)
+	code, _ := verifier.VerifyCodeProof(stateRoot, storageTestContract, EmptyCodeHash, nil, accountProof)
+	if len(account.Trace) != len(accountProof) || len(code.Trace) != len(accountProof) {
+		t.Fatalf("Expected a trace step per account proof node, got %d and %d for %d", len(account.Trace), len(code.Trace), len(accountProof))
+	}
+	if account.Trace[0].Hash != stateRoot {
+		t.Errorf("Expected the trace to start at the state root, got %s", account.Trace[0].Hash.Hex())
+	}
+}
+
+func TestVerifyCodeProof(t *testing.T) {
+	mapper := rsktrie.NewTrieKeyMapper()
+	contract := common.HexToAddress("0x77045E71a7A2c50903d88e564cD72fab11e82051")
+	tiny := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	eoa := common.HexToAddress("0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826")
+	missing := common.HexToAddress("0x2000000000000000000000000000000000000002")
+
+	code := bytes.Repeat([]byte{0x60, 0x80, 0x60, 0x40, 0x52}, 40)
+	tinyCode := []byte{0x60, 0x00, 0x56}
+	accountState, _ := rlp.EncodeToBytes(&AccountState{Nonce: 1, Balance: big.NewInt(0)})
+	trie := rsktrie.NewTrie(rsktrie.NewMemTrieStore()).
+		Put(mapper.GetAccountKey(contract), accountState).
+		Put(mapper.GetCodeKey(contract), code).
+		Put(mapper.GetAccountStorageKey(contract, common.Hash{}), []byte{0x2a}).
+		Put(mapper.GetAccountKey(tiny), accountState).
+		Put(mapper.GetCodeKey(tiny), tinyCode).
+		Put(mapper.GetAccountKey(eoa), accountState)
+	stateRoot := common.BytesToHash(trie.GetHash())
+	verifier := NewProofVerifier()
+
+	accountProof := func(address common.Address) [][]byte {
+		proofNodes, err := trie.GetProof(mapper.GetAccountKey(address))
+		if err != nil {
+			t.Fatalf("GetProof failed: %v", err)
+		}
+		return proofNodes
+	}
+	codeHash := common.BytesToHash(rsktrie.Keccak256(code))
+	tinyCodeHash := common.BytesToHash(rsktrie.Keccak256(tinyCode))
+
+	tests := []struct {
+		name      string
+		address   common.Address
+		codeHash  common.Hash
+		code      []byte
+		wantValid bool
+		absent    bool
+	}{
+		{"contract", contract, codeHash, nil, true, false},
+		{"contract with code", contract, codeHash, code, true, false},
+		{"code shorter than a hash", tiny, tinyCodeHash, tinyCode, true, false},
+		{"account without code", eoa, EmptyCodeHash, nil, true, true},
+		{"missing account", missing, common.Hash{}, []byte{}, true, true},
+		{"missing account with code", missing, common.Hash{}, tinyCode, false, true},
+		{"missing account with empty code hash", missing, EmptyCodeHash, nil, false, true},
+		{"account without code with zero hash", eoa, common.Hash{}, nil, false, true},
+		{"wrong code hash", contract, tinyCodeHash, nil, false, false},
+		{"eoa claimed as contract", eoa, codeHash, nil, false, true},
+		{"wrong code", contract, codeHash, append([]byte{0x00}, code[1:]...), false, false},
+		{"truncated code", tiny, tinyCodeHash, tinyCode[:2], false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The code node is embedded in the account node, so the account proof covers it
+			result, err := verifier.VerifyCodeProof(stateRoot, tt.address, tt.codeHash, tt.code, accountProof(tt.address))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result.Valid != tt.wantValid {
+				t.Fatalf("Expected Valid=%v, got %+v", tt.wantValid, result)
+			}
+			if result.Absent != tt.absent {
+				t.Errorf("Expected Absent=%v, got %v", tt.absent, result.Absent)
+			}
+			if !tt.wantValid && !errors.Is(result.Error, ErrCodeHashMismatch) {
+				t.Errorf("Expected ErrCodeHashMismatch, got %v", result.Error)
+			}
+			if tt.wantValid && !bytes.Equal(result.Code, tt.code) {
+				t.Errorf("Expected Code %x, got %x", tt.code, result.Code)
+			}
+		})
+	}
+
+	result, _ := verifier.VerifyCodeProof(stateRoot, contract, codeHash, nil, accountProof(contract))
+	if result.CodeLength != uint32(len(code)) {
+		t.Errorf("Expected CodeLength %d, got %d", len(code), result.CodeLength)
+	}
+
+	// RSKj lists embedded nodes on the path separately in proofs of the code key
+	codeProof, _ := trie.GetProof(mapper.GetCodeKey(contract))
+	if len(codeProof) != len(accountProof(contract))+1 {
+		t.Fatalf("Expected the code node to be listed in its own proof")
+	}
+	result, _ = verifier.VerifyCodeProof(stateRoot, contract, codeHash, code, codeProof)
+	if !result.Valid {
+		t.Errorf("Expected a code key proof to be valid, got %+v", result)
+	}
+
+	// A proof for another account does not prove the code node
+	result, _ = verifier.VerifyCodeProof(stateRoot, contract, codeHash, nil, accountProof(eoa))
+	if result.Valid || errors.Is(result.Error, ErrCodeHashMismatch) {
+		t.Errorf("Expected a proof error for the wrong account, got %+v", result)
+	}
+}
+
 // TestVerifyAccountProof_RealData tests with actual proof data from RSK regtest
 // This test demonstrates how to use the proof verifier with real data
 func TestVerifyAccountProof_RealData(t *testing.T) {
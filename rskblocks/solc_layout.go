@@ -0,0 +1,419 @@
+package rskblocks
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// StorageLayout is the storageLayout output of solc for a contract, as
+// produced by `solc --storage-layout` or the storageLayout output selection.
+type StorageLayout struct {
+	Storage []StorageLayoutEntry    `json:"storage"`
+	Types   map[string]*StorageType `json:"types"`
+}
+
+// StorageLayoutEntry is a state variable of a contract or a member of a struct
+type StorageLayoutEntry struct {
+	Label  string `json:"label"`
+	Offset int    `json:"offset"`
+	Slot   string `json:"slot"` // Decimal, relative to the struct for members
+	Type   string `json:"type"` // Key of Types
+}
+
+// StorageType describes a type of a storage layout
+type StorageType struct {
+	Encoding      string               `json:"encoding"` // inplace, mapping, dynamic_array or bytes
+	Label         string               `json:"label"`
+	NumberOfBytes string               `json:"numberOfBytes"`
+	Key           string               `json:"key,omitempty"`   // Key type of mappings
+	Value         string               `json:"value,omitempty"` // Value type of mappings
+	Base          string               `json:"base,omitempty"`  // Element type of arrays
+	Members       []StorageLayoutEntry `json:"members,omitempty"`
+}
+
+// StorageVariable is a state variable, or a part of one, resolved to its
+// location in storage.
+type StorageVariable struct {
+	Path     string
+	TypeID   string // Key of StorageLayout.Types
+	Type     *StorageType
+	Location StorageLocation
+}
+
+// staticArrayLength matches the length in the type id of a static array,
+// e.g. t_array(t_uint8)40_storage
+var staticArrayLength = regexp.MustCompile(`\)(\d+)_storage$`)
+
+// ParseStorageLayout parses the storageLayout JSON of solc. It accepts the
+// layout object itself, or a solc output entry holding it as storageLayout.
+func ParseStorageLayout(data []byte) (*StorageLayout, error) {
+	var wrapped struct {
+		StorageLayout *StorageLayout `json:"storageLayout"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err == nil && wrapped.StorageLayout != nil {
+		return wrapped.StorageLayout, nil
+	}
+
+	var layout StorageLayout
+	if err := json.Unmarshal(data, &layout); err != nil {
+		return nil, fmt.Errorf("parse storage layout: %w", err)
+	}
+	if layout.Types == nil {
+		return nil, fmt.Errorf("parse storage layout: no types")
+	}
+	return &layout, nil
+}
+
+// Resolve locates a state variable, or a part of it, in storage. The path
+// uses Solidity syntax: a variable name followed by any number of mapping keys
+// or array indexes in brackets and struct members after dots, e.g.
+// `balances[0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826]`,
+// `users[7].name` or `names["alice"]`. Dynamic arrays also have a `length`.
+//
+// Mapping keys are written as Solidity literals of the key type: decimal or
+// 0x-prefixed hex numbers, true or false, hex for addresses and bytes, and
+// optionally quoted text for strings. Array indexes are not checked against
+// the length of dynamic arrays.
+func (l *StorageLayout) Resolve(path string) (*StorageVariable, error) {
+	name, rest := splitPathStep(path)
+	var entry *StorageLayoutEntry
+	for i := range l.Storage {
+		if l.Storage[i].Label == name {
+			entry = &l.Storage[i]
+			break
+		}
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("no state variable %q", name)
+	}
+
+	v, err := l.member(common.Hash{}, name, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	for rest != "" {
+		switch rest[0] {
+		case '[':
+			end := closingBracket(rest)
+			if end < 0 {
+				return nil, fmt.Errorf("%s: unterminated key in %q", v.Path, rest)
+			}
+			if v, err = l.index(v, rest[1:end]); err != nil {
+				return nil, err
+			}
+			rest = rest[end+1:]
+		case '.':
+			var member string
+			member, rest = splitPathStep(rest[1:])
+			if v, err = l.field(v, member); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%s: unexpected %q", v.Path, rest)
+		}
+	}
+	return v, nil
+}
+
+// Kind returns the kind of value the variable holds, or an error if it is a
+// mapping, array or struct, which have no value of their own.
+func (v *StorageVariable) Kind() (StorageKind, error) {
+	kind, err := v.Type.Kind()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", v.Path, err)
+	}
+	return kind, nil
+}
+
+// Kind returns the kind of value of the type, or an error for mappings,
+// arrays, structs and unsupported types.
+func (t *StorageType) Kind() (StorageKind, error) {
+	label := t.Label
+	switch {
+	case t.Encoding == "bytes" && label == "string":
+		return StorageKindString, nil
+	case t.Encoding == "bytes":
+		return StorageKindBytes, nil
+	case t.Encoding != "inplace" || t.Base != "" || t.Members != nil:
+		return 0, fmt.Errorf("%s is not a value type", label)
+	case strings.HasPrefix(label, "uint"), strings.HasPrefix(label, "enum "):
+		return StorageKindUint, nil
+	case strings.HasPrefix(label, "int"):
+		return StorageKindInt, nil
+	case label == "address", label == "address payable", strings.HasPrefix(label, "contract "):
+		return StorageKindAddress, nil
+	case label == "bool":
+		return StorageKindBool, nil
+	case strings.HasPrefix(label, "bytes"):
+		return StorageKindFixedBytes, nil
+	default:
+		return 0, fmt.Errorf("unsupported type %s", label)
+	}
+}
+
+// ReadVariable reads and decodes the value of a resolved state variable. The
+// Go type of the result depends on its kind; see StorageKind.
+func (r *StorageReader) ReadVariable(v *StorageVariable) (interface{}, error) {
+	kind, err := v.Kind()
+	if err != nil {
+		return nil, err
+	}
+	value, err := r.ReadValue(v.Location, kind)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", v.Path, err)
+	}
+	return value, nil
+}
+
+// member resolves a state variable or struct member relative to slot base
+func (l *StorageLayout) member(base common.Hash, path string, entry *StorageLayoutEntry) (*StorageVariable, error) {
+	typ, err := l.typeOf(entry.Type)
+	if err != nil {
+		return nil, err
+	}
+	size, err := typ.size()
+	if err != nil {
+		return nil, err
+	}
+	slot, ok := new(big.Int).SetString(entry.Slot, 10)
+	if !ok || slot.Sign() < 0 || !slot.IsUint64() {
+		return nil, fmt.Errorf("%s: invalid slot %q", entry.Label, entry.Slot)
+	}
+
+	loc := StorageLocation{Slot: AddSlots(base, slot.Uint64()), Offset: entry.Offset, Size: size}
+	if size > 32 {
+		loc.Size = 32
+	}
+	return &StorageVariable{Path: path, TypeID: entry.Type, Type: typ, Location: loc}, nil
+}
+
+// field resolves a struct member, or the length of a dynamic array
+func (l *StorageLayout) field(v *StorageVariable, name string) (*StorageVariable, error) {
+	if v.Type.Encoding == "dynamic_array" && name == "length" {
+		return &StorageVariable{
+			Path:     v.Path + ".length",
+			Type:     &StorageType{Encoding: "inplace", Label: "uint256", NumberOfBytes: "32"},
+			Location: SlotLocation(v.Location.Slot),
+		}, nil
+	}
+	for i := range v.Type.Members {
+		if v.Type.Members[i].Label == name {
+			return l.member(v.Location.Slot, v.Path+"."+name, &v.Type.Members[i])
+		}
+	}
+	return nil, fmt.Errorf("%s: %s has no member %q", v.Path, v.Type.Label, name)
+}
+
+// index resolves a mapping value or an array element
+func (l *StorageLayout) index(v *StorageVariable, key string) (*StorageVariable, error) {
+	path := v.Path + "[" + key + "]"
+
+	switch v.Type.Encoding {
+	case "mapping":
+		keyType, err := l.typeOf(v.Type.Key)
+		if err != nil {
+			return nil, err
+		}
+		valueType, err := l.typeOf(v.Type.Value)
+		if err != nil {
+			return nil, err
+		}
+		size, err := valueType.size()
+		if err != nil {
+			return nil, err
+		}
+		slot, err := mappingKeySlot(v.Location.Slot, keyType, key)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		loc := SlotLocation(slot)
+		if size < 32 {
+			loc.Size = size
+		}
+		return &StorageVariable{Path: path, TypeID: v.Type.Value, Type: valueType, Location: loc}, nil
+
+	case "dynamic_array", "inplace":
+		if v.Type.Base == "" {
+			return nil, fmt.Errorf("%s: %s cannot be indexed", path, v.Type.Label)
+		}
+		elementType, err := l.typeOf(v.Type.Base)
+		if err != nil {
+			return nil, err
+		}
+		size, err := elementType.size()
+		if err != nil {
+			return nil, err
+		}
+		index, err := strconv.ParseUint(key, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid index: %w", path, err)
+		}
+
+		var loc StorageLocation
+		if v.Type.Encoding == "dynamic_array" {
+			loc = DynamicArrayElementLocation(v.Location.Slot, index, size)
+		} else {
+			if length, ok := staticLength(v.TypeID); ok && index >= length {
+				return nil, fmt.Errorf("%s: index out of bounds for %s", path, v.Type.Label)
+			}
+			loc = ArrayElementLocation(v.Location.Slot, index, size)
+		}
+		return &StorageVariable{Path: path, TypeID: v.Type.Base, Type: elementType, Location: loc}, nil
+
+	default:
+		return nil, fmt.Errorf("%s: %s cannot be indexed", path, v.Type.Label)
+	}
+}
+
+func (l *StorageLayout) typeOf(id string) (*StorageType, error) {
+	typ, ok := l.Types[id]
+	if !ok || typ == nil {
+		return nil, fmt.Errorf("unknown type %q", id)
+	}
+	return typ, nil
+}
+
+// size returns the number of bytes of a type
+func (t *StorageType) size() (int, error) {
+	size, err := strconv.Atoi(t.NumberOfBytes)
+	if err != nil || size < 1 {
+		return 0, fmt.Errorf("type %s: invalid numberOfBytes %q", t.Label, t.NumberOfBytes)
+	}
+	return size, nil
+}
+
+// staticLength returns the length of a static array type
+func staticLength(id string) (uint64, bool) {
+	m := staticArrayLength.FindStringSubmatch(id)
+	if m == nil {
+		return 0, false
+	}
+	length, err := strconv.ParseUint(m[1], 10, 64)
+	return length, err == nil
+}
+
+// mappingKeySlot returns the slot of the mapping value for a key literal
+func mappingKeySlot(base common.Hash, keyType *StorageType, key string) (common.Hash, error) {
+	if keyType.Encoding == "bytes" {
+		if keyType.Label == "string" {
+			if unquoted, err := strconv.Unquote(key); err == nil {
+				key = unquoted
+			}
+			return MappingSlotBytes(base, []byte(key)), nil
+		}
+		data, err := decodeHexLiteral(key)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		return MappingSlotBytes(base, data), nil
+	}
+
+	kind, err := keyType.Kind()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	size, err := keyType.size()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	encoded, err := encodeMappingKey(kind, size, key)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return MappingSlot(base, encoded), nil
+}
+
+// encodeMappingKey ABI-encodes a key literal of a value type to 32 bytes
+func encodeMappingKey(kind StorageKind, size int, key string) (common.Hash, error) {
+	switch kind {
+	case StorageKindUint, StorageKindInt:
+		value, ok := new(big.Int).SetString(key, 0)
+		if !ok {
+			return common.Hash{}, fmt.Errorf("invalid integer key %q", key)
+		}
+		lower, upper := big.NewInt(0), new(big.Int).Lsh(big.NewInt(1), uint(8*size))
+		if kind == StorageKindInt {
+			upper.Rsh(upper, 1)
+			lower.Neg(upper)
+		}
+		if value.Cmp(lower) < 0 || value.Cmp(upper) >= 0 {
+			return common.Hash{}, fmt.Errorf("key %s out of range for %d bytes", key, size)
+		}
+		if value.Sign() < 0 {
+			// Sign-extended two's complement
+			value.Add(value, new(big.Int).Lsh(big.NewInt(1), 256))
+		}
+		return common.BytesToHash(value.Bytes()), nil
+	case StorageKindAddress:
+		if !common.IsHexAddress(key) {
+			return common.Hash{}, fmt.Errorf("invalid address key %q", key)
+		}
+		return common.BytesToHash(common.HexToAddress(key).Bytes()), nil
+	case StorageKindBool:
+		switch key {
+		case "true":
+			return common.BytesToHash([]byte{1}), nil
+		case "false":
+			return common.Hash{}, nil
+		}
+		return common.Hash{}, fmt.Errorf("invalid bool key %q", key)
+	case StorageKindFixedBytes:
+		data, err := decodeHexLiteral(key)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		if len(data) > size {
+			return common.Hash{}, fmt.Errorf("key %s longer than %d bytes", key, size)
+		}
+		// Fixed bytes are left-aligned
+		var encoded common.Hash
+		copy(encoded[:], data)
+		return encoded, nil
+	default:
+		return common.Hash{}, fmt.Errorf("unsupported key kind %v", kind)
+	}
+}
+
+func decodeHexLiteral(s string) ([]byte, error) {
+	if !strings.HasPrefix(s, "0x") && !strings.HasPrefix(s, "0X") {
+		return nil, fmt.Errorf("invalid hex key %q", s)
+	}
+	return hexDecode(s[2:])
+}
+
+// splitPathStep splits a path into its leading name and the rest
+func splitPathStep(path string) (string, string) {
+	end := strings.IndexAny(path, "[.")
+	if end < 0 {
+		return path, ""
+	}
+	return path[:end], path[end:]
+}
+
+// closingBracket returns the index of the bracket closing the key at the
+// start of s, skipping brackets inside quotes, or -1.
+func closingBracket(s string) int {
+	quoted := false
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case '\\':
+			if quoted {
+				i++
+			}
+		case ']':
+			if !quoted {
+				return i
+			}
+		}
+	}
+	return -1
+}
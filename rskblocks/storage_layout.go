@@ -0,0 +1,302 @@
+package rskblocks
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum-optimism/optimism/op-service/rsk/gorsk/rsktrie"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// MaxStorageBytesLength limits the length of string and bytes values read by
+// StorageReader, each 32 bytes of which take a storage proof.
+const MaxStorageBytesLength = 64 * 1024
+
+// ErrStorageEncoding is returned for a storage word that is not a valid
+// encoding of the requested type, e.g. a string length with the wrong form.
+var ErrStorageEncoding = errors.New("invalid storage encoding")
+
+// StorageKind is the kind of a Solidity value stored in contract storage
+type StorageKind int
+
+const (
+	// StorageKindUint is an unsigned integer of 1 to 32 bytes, or an enum; read as *big.Int
+	StorageKindUint StorageKind = iota + 1
+	// StorageKindInt is a signed integer of 1 to 32 bytes; read as *big.Int
+	StorageKindInt
+	// StorageKindAddress is an address or contract; read as common.Address
+	StorageKindAddress
+	// StorageKindBool is a bool; read as bool
+	StorageKindBool
+	// StorageKindFixedBytes is a bytes1 to bytes32; read as []byte
+	StorageKindFixedBytes
+	// StorageKindString is a string; read as string
+	StorageKindString
+	// StorageKindBytes is a dynamic bytes; read as []byte
+	StorageKindBytes
+)
+
+func (k StorageKind) String() string {
+	switch k {
+	case StorageKindUint:
+		return "uint"
+	case StorageKindInt:
+		return "int"
+	case StorageKindAddress:
+		return "address"
+	case StorageKindBool:
+		return "bool"
+	case StorageKindFixedBytes:
+		return "fixed bytes"
+	case StorageKindString:
+		return "string"
+	case StorageKindBytes:
+		return "bytes"
+	default:
+		return fmt.Sprintf("StorageKind(%d)", int(k))
+	}
+}
+
+// StorageLocation is where a value lives in contract storage. Values smaller
+// than 32 bytes may share a slot: as in solc, Offset counts bytes from the
+// low-order (right) end of the slot. String and bytes values start at Slot
+// and take the whole slot.
+type StorageLocation struct {
+	Slot   common.Hash
+	Offset int
+	Size   int
+}
+
+// SlotLocation returns the location of a value that takes a whole slot
+func SlotLocation(slot common.Hash) StorageLocation {
+	return StorageLocation{Slot: slot, Size: 32}
+}
+
+// AddSlots returns slot + n, modulo 2^256
+func AddSlots(slot common.Hash, n uint64) common.Hash {
+	sum := new(big.Int).SetBytes(slot[:])
+	sum.Add(sum, new(big.Int).SetUint64(n))
+	return common.BytesToHash(sum.Bytes())
+}
+
+// MappingSlot returns the slot of the value of a mapping at base for a key of
+// a value type, ABI-encoded to 32 bytes: keccak256(key . base). Nested
+// mappings apply it once per key, the inner mapping's base being the slot of
+// the outer value.
+func MappingSlot(base common.Hash, key common.Hash) common.Hash {
+	return MappingSlotBytes(base, key[:])
+}
+
+// MappingSlotBytes returns the slot of the value of a mapping at base for a
+// string or bytes key, which is not padded: keccak256(key . base).
+func MappingSlotBytes(base common.Hash, key []byte) common.Hash {
+	data := make([]byte, 0, len(key)+common.HashLength)
+	data = append(data, key...)
+	data = append(data, base[:]...)
+	return common.BytesToHash(rsktrie.Keccak256(data))
+}
+
+// ArrayElementLocation returns the location of element index of an array
+// whose elements take elementSize bytes and start at slot start. Elements of
+// up to 16 bytes are packed several to a slot; larger ones, like structs,
+// start a new slot each.
+//
+// The elements of a static array start at the array's slot; for a dynamic
+// array use DynamicArrayElementLocation. elementSize must be positive.
+func ArrayElementLocation(start common.Hash, index uint64, elementSize int) StorageLocation {
+	if elementSize <= 16 {
+		perSlot := uint64(32 / elementSize)
+		return StorageLocation{
+			Slot:   AddSlots(start, index/perSlot),
+			Offset: int(index%perSlot) * elementSize,
+			Size:   elementSize,
+		}
+	}
+
+	slotsPerElement := uint64((elementSize + 31) / 32)
+	size := elementSize
+	if size > 32 {
+		size = 32
+	}
+	return StorageLocation{Slot: AddSlots(start, index*slotsPerElement), Size: size}
+}
+
+// DynamicArrayElementLocation returns the location of element index of a
+// dynamic array at base. The base slot holds the array length, and the
+// elements start at keccak256(base).
+func DynamicArrayElementLocation(base common.Hash, index uint64, elementSize int) StorageLocation {
+	return ArrayElementLocation(dataSlot(base), index, elementSize)
+}
+
+// dataSlot returns the slot where the elements of a dynamic array, or the
+// data of a long string or bytes value, stored at slot start.
+func dataSlot(slot common.Hash) common.Hash {
+	return common.BytesToHash(rsktrie.Keccak256(slot[:]))
+}
+
+// field returns the bytes of a location within a storage word
+func (l StorageLocation) field(word common.Hash) ([]byte, error) {
+	if l.Size < 1 || l.Offset < 0 || l.Offset+l.Size > 32 {
+		return nil, fmt.Errorf("%d bytes at offset %d do not fit in a slot", l.Size, l.Offset)
+	}
+	return word[32-l.Offset-l.Size : 32-l.Offset], nil
+}
+
+// DecodeStorageWord decodes a value type stored at loc from the 32-byte word
+// of its slot. The Go type of the result depends on kind; see StorageKind.
+// String and bytes values may span several slots and are read with
+// StorageReader.ReadBytes instead.
+func DecodeStorageWord(word common.Hash, loc StorageLocation, kind StorageKind) (interface{}, error) {
+	field, err := loc.field(word)
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case StorageKindUint:
+		return new(big.Int).SetBytes(field), nil
+	case StorageKindInt:
+		value := new(big.Int).SetBytes(field)
+		if field[0]&0x80 != 0 {
+			// Two's complement of a loc.Size-byte integer
+			value.Sub(value, new(big.Int).Lsh(big.NewInt(1), uint(8*len(field))))
+		}
+		return value, nil
+	case StorageKindAddress:
+		if len(field) != common.AddressLength {
+			return nil, fmt.Errorf("address of %d bytes", len(field))
+		}
+		return common.BytesToAddress(field), nil
+	case StorageKindBool:
+		if len(field) != 1 || field[0] > 1 {
+			return nil, fmt.Errorf("%w: bool %x", ErrStorageEncoding, field)
+		}
+		return field[0] == 1, nil
+	case StorageKindFixedBytes:
+		return common.CopyBytes(field), nil
+	default:
+		return nil, fmt.Errorf("%v is not a single-slot value type", kind)
+	}
+}
+
+// StorageProofSource returns the storage proof nodes of slots of an account,
+// in the order of slots, e.g. from the storageProof field of eth_getProof.
+type StorageProofSource func(slots []common.Hash) ([][][]byte, error)
+
+// StorageReader reads contract storage through storage proofs, verifying
+// every slot it reads against a state root.
+type StorageReader struct {
+	verifier  *ProofVerifier
+	stateRoot common.Hash
+	address   common.Address
+	proofs    StorageProofSource
+}
+
+// NewStorageReader creates a reader of the storage of address at stateRoot
+// that fetches proofs from source.
+func NewStorageReader(verifier *ProofVerifier, stateRoot common.Hash, address common.Address, source StorageProofSource) *StorageReader {
+	return &StorageReader{
+		verifier:  verifier,
+		stateRoot: stateRoot,
+		address:   address,
+		proofs:    source,
+	}
+}
+
+// ReadSlots returns the verified 32-byte words of slots. Slots that are not
+// stored read as zero.
+func (r *StorageReader) ReadSlots(slots []common.Hash) ([]common.Hash, error) {
+	proofs, err := r.proofs(slots)
+	if err != nil {
+		return nil, fmt.Errorf("fetch storage proofs: %w", err)
+	}
+	if len(proofs) != len(slots) {
+		return nil, fmt.Errorf("got %d storage proofs for %d slots", len(proofs), len(slots))
+	}
+
+	words := make([]common.Hash, len(slots))
+	for i, slot := range slots {
+		result, err := r.verifier.VerifyStorageProof(r.stateRoot, r.address, slot, proofs[i])
+		if err != nil {
+			return nil, err
+		}
+		if !result.Valid {
+			return nil, fmt.Errorf("storage proof of slot %s: %w", slot.Hex(), result.Error)
+		}
+		if len(result.Value) > common.HashLength {
+			return nil, fmt.Errorf("%w: slot %s holds %d bytes", ErrStorageEncoding, slot.Hex(), len(result.Value))
+		}
+		// RSK stores storage words without their leading zeros
+		words[i] = common.BytesToHash(result.Value)
+	}
+	return words, nil
+}
+
+// ReadValue reads and decodes the value of kind stored at loc. The Go type of
+// the result depends on kind; see StorageKind.
+func (r *StorageReader) ReadValue(loc StorageLocation, kind StorageKind) (interface{}, error) {
+	switch kind {
+	case StorageKindString:
+		data, err := r.ReadBytes(loc.Slot)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	case StorageKindBytes:
+		return r.ReadBytes(loc.Slot)
+	}
+
+	words, err := r.ReadSlots([]common.Hash{loc.Slot})
+	if err != nil {
+		return nil, err
+	}
+	return DecodeStorageWord(words[0], loc, kind)
+}
+
+// ReadBytes reads a string or bytes value stored at slot. Values of up to 31
+// bytes are stored in the slot itself with twice their length in the lowest
+// byte. For longer values the slot holds twice the length plus one, and the
+// data fills the slots from keccak256(slot) on.
+func (r *StorageReader) ReadBytes(slot common.Hash) ([]byte, error) {
+	words, err := r.ReadSlots([]common.Hash{slot})
+	if err != nil {
+		return nil, err
+	}
+	word := words[0]
+
+	if word[31]&1 == 0 {
+		length := int(word[31] / 2)
+		if length > 31 {
+			return nil, fmt.Errorf("%w: short value of %d bytes", ErrStorageEncoding, length)
+		}
+		return common.CopyBytes(word[:length]), nil
+	}
+
+	encoded := new(big.Int).SetBytes(word[:])
+	length := new(big.Int).Rsh(encoded, 1)
+	if length.Cmp(big.NewInt(32)) < 0 {
+		return nil, fmt.Errorf("%w: long value of %s bytes", ErrStorageEncoding, length)
+	}
+	if length.Cmp(big.NewInt(MaxStorageBytesLength)) > 0 {
+		return nil, fmt.Errorf("value of %s bytes exceeds %d", length, MaxStorageBytesLength)
+	}
+
+	n := int(length.Int64())
+	start := dataSlot(slot)
+	slots := make([]common.Hash, (n+31)/32)
+	for i := range slots {
+		slots[i] = AddSlots(start, uint64(i))
+	}
+	words, err = r.ReadSlots(slots)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 0, len(words)*32)
+	for _, w := range words {
+		data = append(data, w[:]...)
+	}
+	return data[:n], nil
+}
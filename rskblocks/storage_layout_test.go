@@ -0,0 +1,474 @@
+package rskblocks
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/op-service/rsk/gorsk/rsktrie"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// testContractStorage stores contract storage words the way RSK does and
+// serves their proofs
+type testContractStorage struct {
+	mapper  *rsktrie.TrieKeyMapper
+	trie    *rsktrie.Trie
+	address common.Address
+}
+
+func newTestContractStorage() *testContractStorage {
+	s := &testContractStorage{
+		mapper:  rsktrie.NewTrieKeyMapper(),
+		address: storageTestContract,
+	}
+	s.trie = putContract(rsktrie.NewTrie(rsktrie.NewMemTrieStore()), s.address, nil)
+	return s
+}
+
+func (s *testContractStorage) set(slot common.Hash, word common.Hash) {
+	s.trie = s.trie.Put(s.mapper.GetAccountStorageKey(s.address, slot), common.TrimLeftZeroes(word[:]))
+}
+
+func (s *testContractStorage) reader() *StorageReader {
+	source := func(slots []common.Hash) ([][][]byte, error) {
+		proofs := make([][][]byte, len(slots))
+		for i, slot := range slots {
+			proof, err := s.trie.GetProof(s.mapper.GetAccountStorageKey(s.address, slot))
+			if err != nil {
+				return nil, err
+			}
+			proofs[i] = proof
+		}
+		return proofs, nil
+	}
+	return NewStorageReader(NewProofVerifier(), common.BytesToHash(s.trie.GetHash()), s.address, source)
+}
+
+// keccakSlot hashes the concatenation of 32-byte words
+func keccakSlot(words ...common.Hash) common.Hash {
+	var data []byte
+	for _, w := range words {
+		data = append(data, w[:]...)
+	}
+	return common.BytesToHash(rsktrie.Keccak256(data))
+}
+
+func slotN(n int64) common.Hash {
+	return common.BytesToHash(big.NewInt(n).Bytes())
+}
+
+func TestMappingSlot(t *testing.T) {
+	// data[0] of SimpleStorage, whose mapping is at slot 2 (misc/account-proof-examples.md)
+	want := common.HexToHash("0xac33ff75c19e70fe83507db0d683fd3465c996598dc972688b7ace676c89077b")
+	if got := MappingSlot(slotN(2), slotN(0)); got != want {
+		t.Errorf("Expected %s, got %s", want.Hex(), got.Hex())
+	}
+
+	// Elements of a dynamic array at slot 2 start at keccak256(2)
+	want = common.HexToHash("0x405787fa12a823e0f2b7631cc41b3ba8828b3321ca811111fa75cd3aa3bb5ace")
+	if got := DynamicArrayElementLocation(slotN(2), 0, 32).Slot; got != want {
+		t.Errorf("Expected %s, got %s", want.Hex(), got.Hex())
+	}
+
+	if got, want := MappingSlotBytes(slotN(12), []byte("alice")), common.BytesToHash(rsktrie.Keccak256(append([]byte("alice"), slotN(12).Bytes()...))); got != want {
+		t.Errorf("Expected %s, got %s", want.Hex(), got.Hex())
+	}
+}
+
+func TestArrayElementLocation(t *testing.T) {
+	start := slotN(10)
+	tests := []struct {
+		index       uint64
+		elementSize int
+		want        StorageLocation
+	}{
+		{0, 1, StorageLocation{Slot: slotN(10), Offset: 0, Size: 1}},
+		{33, 1, StorageLocation{Slot: slotN(11), Offset: 1, Size: 1}},
+		{16, 2, StorageLocation{Slot: slotN(11), Offset: 0, Size: 2}},
+		{3, 16, StorageLocation{Slot: slotN(11), Offset: 16, Size: 16}},
+		// 12-byte elements leave 8 bytes of each slot unused
+		{2, 12, StorageLocation{Slot: slotN(11), Offset: 0, Size: 12}},
+		{3, 20, StorageLocation{Slot: slotN(13), Offset: 0, Size: 20}},
+		{2, 96, StorageLocation{Slot: slotN(16), Offset: 0, Size: 32}},
+	}
+	for _, tt := range tests {
+		if got := ArrayElementLocation(start, tt.index, tt.elementSize); got != tt.want {
+			t.Errorf("Element %d of %d bytes: expected %+v, got %+v", tt.index, tt.elementSize, tt.want, got)
+		}
+	}
+
+	max := common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	if got := AddSlots(max, 2); got != slotN(1) {
+		t.Errorf("Expected slot arithmetic to wrap, got %s", got.Hex())
+	}
+}
+
+func TestDecodeStorageWord(t *testing.T) {
+	word := common.HexToHash("0x00fffe010203040506070801cd2a3d9f938e13cd947ec05abc7fe734df8dd826")
+
+	tests := []struct {
+		loc  StorageLocation
+		kind StorageKind
+		want interface{}
+	}{
+		{StorageLocation{Offset: 0, Size: 20}, StorageKindAddress, common.HexToAddress("0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826")},
+		{StorageLocation{Offset: 20, Size: 1}, StorageKindBool, true},
+		{StorageLocation{Offset: 21, Size: 8}, StorageKindUint, big.NewInt(0x0102030405060708)},
+		{StorageLocation{Offset: 29, Size: 2}, StorageKindInt, big.NewInt(-2)},
+		{StorageLocation{Offset: 29, Size: 2}, StorageKindUint, big.NewInt(0xfffe)},
+		{StorageLocation{Offset: 29, Size: 3}, StorageKindInt, big.NewInt(0xfffe)},
+		{StorageLocation{Offset: 28, Size: 4}, StorageKindFixedBytes, []byte{0x00, 0xff, 0xfe, 0x01}},
+	}
+	for _, tt := range tests {
+		got, err := DecodeStorageWord(word, tt.loc, tt.kind)
+		if err != nil {
+			t.Errorf("%v at %+v: unexpected error: %v", tt.kind, tt.loc, err)
+			continue
+		}
+		if !storageValueEqual(got, tt.want) {
+			t.Errorf("%v at %+v: expected %v, got %v", tt.kind, tt.loc, tt.want, got)
+		}
+	}
+
+	if _, err := DecodeStorageWord(word, StorageLocation{Offset: 0, Size: 1}, StorageKindBool); !errors.Is(err, ErrStorageEncoding) {
+		t.Errorf("Expected a bool of 0x26 to be rejected, got %v", err)
+	}
+	if _, err := DecodeStorageWord(word, StorageLocation{Offset: 30, Size: 4}, StorageKindUint); err == nil {
+		t.Error("Expected a field past the slot to be rejected")
+	}
+	if _, err := DecodeStorageWord(word, SlotLocation(common.Hash{}), StorageKindString); err == nil {
+		t.Error("Expected strings to need ReadBytes")
+	}
+}
+
+func storageValueEqual(a, b interface{}) bool {
+	switch want := b.(type) {
+	case *big.Int:
+		got, ok := a.(*big.Int)
+		return ok && got.Cmp(want) == 0
+	case []byte:
+		got, ok := a.([]byte)
+		return ok && bytes.Equal(got, want)
+	default:
+		return a == b
+	}
+}
+
+// testStorageLayout is the solc storage layout of:
+//
+//	contract Layout {
+//	    struct User { string name; uint128 score; uint64 level; address wallet; }
+//	    uint256 total;
+//	    address owner; bool paused; uint64 epoch; int16 delta;
+//	    bytes4 tag;
+//	    mapping(address => uint256) balances;
+//	    mapping(address => mapping(uint256 => bool)) approvals;
+//	    uint16[] readings;
+//	    mapping(uint256 => User) users;
+//	    string shortName;
+//	    string longName;
+//	    bytes blob;
+//	    uint8[40] small;
+//	    mapping(string => uint256) byName;
+//	    mapping(int8 => uint256) signedKeys;
+//	    User[] members;
+//	}
+const testStorageLayout = `{
+  "storage": [
+    {"astId": 10, "contract": "Layout.sol:Layout", "label": "total", "offset": 0, "slot": "0", "type": "t_uint256"},
+    {"astId": 12, "contract": "Layout.sol:Layout", "label": "owner", "offset": 0, "slot": "1", "type": "t_address"},
+    {"astId": 14, "contract": "Layout.sol:Layout", "label": "paused", "offset": 20, "slot": "1", "type": "t_bool"},
+    {"astId": 16, "contract": "Layout.sol:Layout", "label": "epoch", "offset": 21, "slot": "1", "type": "t_uint64"},
+    {"astId": 18, "contract": "Layout.sol:Layout", "label": "delta", "offset": 29, "slot": "1", "type": "t_int16"},
+    {"astId": 20, "contract": "Layout.sol:Layout", "label": "tag", "offset": 0, "slot": "2", "type": "t_bytes4"},
+    {"astId": 24, "contract": "Layout.sol:Layout", "label": "balances", "offset": 0, "slot": "3", "type": "t_mapping(t_address,t_uint256)"},
+    {"astId": 30, "contract": "Layout.sol:Layout", "label": "approvals", "offset": 0, "slot": "4", "type": "t_mapping(t_address,t_mapping(t_uint256,t_bool))"},
+    {"astId": 33, "contract": "Layout.sol:Layout", "label": "readings", "offset": 0, "slot": "5", "type": "t_array(t_uint16)dyn_storage"},
+    {"astId": 38, "contract": "Layout.sol:Layout", "label": "users", "offset": 0, "slot": "6", "type": "t_mapping(t_uint256,t_struct(User)8_storage)"},
+    {"astId": 40, "contract": "Layout.sol:Layout", "label": "shortName", "offset": 0, "slot": "7", "type": "t_string_storage"},
+    {"astId": 42, "contract": "Layout.sol:Layout", "label": "longName", "offset": 0, "slot": "8", "type": "t_string_storage"},
+    {"astId": 44, "contract": "Layout.sol:Layout", "label": "blob", "offset": 0, "slot": "9", "type": "t_bytes_storage"},
+    {"astId": 48, "contract": "Layout.sol:Layout", "label": "small", "offset": 0, "slot": "10", "type": "t_array(t_uint8)40_storage"},
+    {"astId": 52, "contract": "Layout.sol:Layout", "label": "byName", "offset": 0, "slot": "12", "type": "t_mapping(t_string_memory_ptr,t_uint256)"},
+    {"astId": 56, "contract": "Layout.sol:Layout", "label": "signedKeys", "offset": 0, "slot": "13", "type": "t_mapping(t_int8,t_uint256)"},
+    {"astId": 60, "contract": "Layout.sol:Layout", "label": "members", "offset": 0, "slot": "14", "type": "t_array(t_struct(User)8_storage)dyn_storage"}
+  ],
+  "types": {
+    "t_address": {"encoding": "inplace", "label": "address", "numberOfBytes": "20"},
+    "t_array(t_struct(User)8_storage)dyn_storage": {"base": "t_struct(User)8_storage", "encoding": "dynamic_array", "label": "struct Layout.User[]", "numberOfBytes": "32"},
+    "t_array(t_uint16)dyn_storage": {"base": "t_uint16", "encoding": "dynamic_array", "label": "uint16[]", "numberOfBytes": "32"},
+    "t_array(t_uint8)40_storage": {"base": "t_uint8", "encoding": "inplace", "label": "uint8[40]", "numberOfBytes": "64"},
+    "t_bool": {"encoding": "inplace", "label": "bool", "numberOfBytes": "1"},
+    "t_bytes4": {"encoding": "inplace", "label": "bytes4", "numberOfBytes": "4"},
+    "t_bytes_storage": {"encoding": "bytes", "label": "bytes", "numberOfBytes": "32"},
+    "t_int16": {"encoding": "inplace", "label": "int16", "numberOfBytes": "2"},
+    "t_int8": {"encoding": "inplace", "label": "int8", "numberOfBytes": "1"},
+    "t_mapping(t_address,t_mapping(t_uint256,t_bool))": {"encoding": "mapping", "key": "t_address", "label": "mapping(address => mapping(uint256 => bool))", "numberOfBytes": "32", "value": "t_mapping(t_uint256,t_bool)"},
+    "t_mapping(t_address,t_uint256)": {"encoding": "mapping", "key": "t_address", "label": "mapping(address => uint256)", "numberOfBytes": "32", "value": "t_uint256"},
+    "t_mapping(t_int8,t_uint256)": {"encoding": "mapping", "key": "t_int8", "label": "mapping(int8 => uint256)", "numberOfBytes": "32", "value": "t_uint256"},
+    "t_mapping(t_string_memory_ptr,t_uint256)": {"encoding": "mapping", "key": "t_string_memory_ptr", "label": "mapping(string => uint256)", "numberOfBytes": "32", "value": "t_uint256"},
+    "t_mapping(t_uint256,t_bool)": {"encoding": "mapping", "key": "t_uint256", "label": "mapping(uint256 => bool)", "numberOfBytes": "32", "value": "t_bool"},
+    "t_mapping(t_uint256,t_struct(User)8_storage)": {"encoding": "mapping", "key": "t_uint256", "label": "mapping(uint256 => struct Layout.User)", "numberOfBytes": "32", "value": "t_struct(User)8_storage"},
+    "t_string_memory_ptr": {"encoding": "bytes", "label": "string", "numberOfBytes": "32"},
+    "t_string_storage": {"encoding": "bytes", "label": "string", "numberOfBytes": "32"},
+    "t_struct(User)8_storage": {"encoding": "inplace", "label": "struct Layout.User", "numberOfBytes": "96", "members": [
+      {"astId": 1, "contract": "Layout.sol:Layout", "label": "name", "offset": 0, "slot": "0", "type": "t_string_storage"},
+      {"astId": 3, "contract": "Layout.sol:Layout", "label": "score", "offset": 0, "slot": "1", "type": "t_uint128"},
+      {"astId": 5, "contract": "Layout.sol:Layout", "label": "level", "offset": 16, "slot": "1", "type": "t_uint64"},
+      {"astId": 7, "contract": "Layout.sol:Layout", "label": "wallet", "offset": 0, "slot": "2", "type": "t_address"}
+    ]},
+    "t_uint128": {"encoding": "inplace", "label": "uint128", "numberOfBytes": "16"},
+    "t_uint16": {"encoding": "inplace", "label": "uint16", "numberOfBytes": "2"},
+    "t_uint256": {"encoding": "inplace", "label": "uint256", "numberOfBytes": "32"},
+    "t_uint64": {"encoding": "inplace", "label": "uint64", "numberOfBytes": "8"},
+    "t_uint8": {"encoding": "inplace", "label": "uint8", "numberOfBytes": "1"}
+  }
+}`
+
+// word builds a storage word from fields placed at solc offsets
+func word(fields ...interface{}) common.Hash {
+	var w common.Hash
+	for i := 0; i < len(fields); i += 2 {
+		data := fields[i+1].([]byte)
+		offset := fields[i].(int)
+		copy(w[32-offset-len(data):], data)
+	}
+	return w
+}
+
+func shortBytesWord(data []byte) common.Hash {
+	var w common.Hash
+	copy(w[:], data)
+	w[31] = byte(2 * len(data))
+	return w
+}
+
+// setLongBytes stores a string or bytes value of more than 31 bytes
+func setLongBytes(s *testContractStorage, slot common.Hash, data []byte) {
+	s.set(slot, slotN(int64(2*len(data)+1)))
+	start := keccakSlot(slot)
+	for i := 0; i*32 < len(data); i++ {
+		var w common.Hash
+		copy(w[:], data[i*32:])
+		s.set(AddSlots(start, uint64(i)), w)
+	}
+}
+
+func TestStorageLayoutReadVariables(t *testing.T) {
+	layout, err := ParseStorageLayout([]byte(testStorageLayout))
+	if err != nil {
+		t.Fatalf("ParseStorageLayout failed: %v", err)
+	}
+
+	owner := common.HexToAddress("0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826")
+	wallet := common.HexToAddress("0x1234567890123456789012345678901234567890")
+	ownerKey := common.BytesToHash(owner.Bytes())
+	longName := strings.Repeat("Rootstock storage ", 4)[:70]
+	blob := bytes.Repeat([]byte{0xab}, 33)
+
+	s := newTestContractStorage()
+	s.set(slotN(0), slotN(12345))
+	s.set(slotN(1), word(0, owner.Bytes(), 20, []byte{1}, 21, big.NewInt(0x0102030405060708).Bytes(), 29, []byte{0xff, 0xfe}))
+	s.set(slotN(2), word(0, []byte{0xde, 0xad, 0xbe, 0xef}))
+	s.set(keccakSlot(ownerKey, slotN(3)), common.BytesToHash(big.NewInt(1e18).Bytes()))
+	s.set(keccakSlot(slotN(7), keccakSlot(ownerKey, slotN(4))), slotN(1))
+
+	s.set(slotN(5), slotN(17))
+	readings := keccakSlot(slotN(5))
+	var first common.Hash
+	for i := 0; i < 16; i++ {
+		copy(first[32-2*(i+1):], big.NewInt(int64(10*(i+1))).FillBytes(make([]byte, 2)))
+	}
+	s.set(readings, first)
+	s.set(AddSlots(readings, 1), word(0, []byte{0x00, 0xaa}))
+
+	user := keccakSlot(slotN(42), slotN(6))
+	s.set(user, shortBytesWord([]byte("alice")))
+	s.set(AddSlots(user, 1), word(0, big.NewInt(1000).Bytes(), 16, []byte{3}))
+	s.set(AddSlots(user, 2), word(0, wallet.Bytes()))
+
+	s.set(slotN(7), shortBytesWord([]byte("rootstock")))
+	setLongBytes(s, slotN(8), []byte(longName))
+	setLongBytes(s, slotN(9), blob)
+	s.set(slotN(11), word(1, []byte{99}))
+	s.set(common.BytesToHash(rsktrie.Keccak256(append([]byte("alice"), slotN(12).Bytes()...))), slotN(5))
+	s.set(keccakSlot(common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"), slotN(13)), slotN(77))
+
+	s.set(slotN(14), slotN(2))
+	member := AddSlots(keccakSlot(slotN(14)), 3)
+	setLongBytes(s, member, []byte(longName))
+	s.set(AddSlots(member, 2), word(0, wallet.Bytes()))
+
+	reader := s.reader()
+	tests := []struct {
+		path string
+		want interface{}
+	}{
+		{"total", big.NewInt(12345)},
+		{"owner", owner},
+		{"paused", true},
+		{"epoch", big.NewInt(0x0102030405060708)},
+		{"delta", big.NewInt(-2)},
+		{"tag", []byte{0xde, 0xad, 0xbe, 0xef}},
+		{"balances[0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826]", big.NewInt(1e18)},
+		{"balances[0x1234567890123456789012345678901234567890]", big.NewInt(0)},
+		{"approvals[0xcd2a3d9f938e13cd947ec05abc7fe734df8dd826][7]", true},
+		{"approvals[0xcd2a3d9f938e13cd947ec05abc7fe734df8dd826][0x8]", false},
+		{"readings.length", big.NewInt(17)},
+		{"readings[0]", big.NewInt(10)},
+		{"readings[15]", big.NewInt(160)},
+		{"readings[16]", big.NewInt(0xaa)},
+		{"users[42].name", "alice"},
+		{"users[42].score", big.NewInt(1000)},
+		{"users[42].level", big.NewInt(3)},
+		{"users[0x2a].wallet", wallet},
+		{"users[43].name", ""},
+		{"shortName", "rootstock"},
+		{"longName", longName},
+		{"blob", blob},
+		{"small[0]", big.NewInt(0)},
+		{"small[33]", big.NewInt(99)},
+		{`byName["alice"]`, big.NewInt(5)},
+		{"byName[alice]", big.NewInt(5)},
+		{"signedKeys[-1]", big.NewInt(77)},
+		{"members.length", big.NewInt(2)},
+		{"members[1].name", longName},
+		{"members[1].wallet", wallet},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			v, err := layout.Resolve(tt.path)
+			if err != nil {
+				t.Fatalf("Resolve failed: %v", err)
+			}
+			got, err := reader.ReadVariable(v)
+			if err != nil {
+				t.Fatalf("ReadVariable failed: %v", err)
+			}
+			if !storageValueEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestStorageLayoutResolveErrors(t *testing.T) {
+	layout, err := ParseStorageLayout([]byte(`{"storageLayout": ` + testStorageLayout + `}`))
+	if err != nil {
+		t.Fatalf("ParseStorageLayout of a solc output entry failed: %v", err)
+	}
+
+	for _, path := range []string{
+		"missing",
+		"total[0]",
+		"balances[0x1234]",
+		"balances[0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826",
+		"approvals[0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826][yes]",
+		"small[40]",
+		"readings[-1]",
+		"users[1].age",
+		"signedKeys[128]",
+		"total.length",
+		"owner x",
+	} {
+		if v, err := layout.Resolve(path); err == nil {
+			t.Errorf("Expected %q not to resolve, got %+v", path, v)
+		}
+	}
+
+	reader := newTestContractStorage().reader()
+	for _, path := range []string{"balances", "users[1]", "readings", "small"} {
+		v, err := layout.Resolve(path)
+		if err != nil {
+			t.Fatalf("Resolve %q failed: %v", path, err)
+		}
+		if _, err := reader.ReadVariable(v); err == nil {
+			t.Errorf("Expected %q to have no value", path)
+		}
+	}
+}
+
+func TestStorageReaderRejectsBadProofs(t *testing.T) {
+	s := newTestContractStorage()
+	s.set(slotN(0), slotN(42))
+	honest := s.reader()
+
+	// A reader for another state root cannot verify the proofs
+	lying := NewStorageReader(NewProofVerifier(), common.Hash{0x01}, s.address, honest.proofs)
+	if _, err := lying.ReadValue(SlotLocation(slotN(0)), StorageKindUint); err == nil {
+		t.Error("Expected proofs for another state root to be rejected")
+	}
+
+	short := NewStorageReader(NewProofVerifier(), honest.stateRoot, s.address, func(slots []common.Hash) ([][][]byte, error) {
+		return nil, nil
+	})
+	if _, err := short.ReadSlots([]common.Hash{slotN(0)}); err == nil {
+		t.Error("Expected missing proofs to be rejected")
+	}
+}
+
+func TestStorageReaderSlotZeroMatchesRSKj(t *testing.T) {
+	// The SimpleStorage contract after its constructor, whose storageHash and
+	// slot 0 leaf node were returned by an RSKj node (misc/account-proof-examples.md)
+	storageHash := common.HexToHash("0x4ac668a682701c5e73038c48163ed1dfb8e75d8f90cf0ad54cea2285a32a5e98")
+	slotZeroLeaf, err := DecodeRLPProofNodes([]string{"0x8f50ff56a437b365522d8aa3580c002a"})
+	if err != nil {
+		t.Fatalf("DecodeRLPProofNodes failed: %v", err)
+	}
+
+	s := newTestContractStorage()
+	s.set(slotN(0), slotN(42))
+	s.set(slotN(1), common.BytesToHash(storageTestEOA.Bytes()))
+	s.set(MappingSlot(slotN(2), slotN(0)), slotN(100))
+	s.set(MappingSlot(slotN(2), slotN(1)), slotN(200))
+
+	root, err := StorageRoot(s.trie, s.address)
+	if err != nil {
+		t.Fatalf("StorageRoot failed: %v", err)
+	}
+	if root.StorageHash != storageHash {
+		t.Errorf("Expected storage hash %s, got %s", storageHash.Hex(), root.StorageHash.Hex())
+	}
+	proof, err := s.trie.GetProof(s.mapper.GetAccountStorageKey(s.address, slotN(0)))
+	if err != nil {
+		t.Fatalf("GetProof failed: %v", err)
+	}
+	if !bytes.Equal(proof[0], slotZeroLeaf[0]) {
+		t.Errorf("Slot 0 leaf differs from RSKj's\n  Expected: %x\n  Computed: %x", slotZeroLeaf[0], proof[0])
+	}
+
+	words, err := s.reader().ReadSlots([]common.Hash{slotN(0)})
+	if err != nil {
+		t.Fatalf("ReadSlots failed: %v", err)
+	}
+	if words[0] != slotN(42) {
+		t.Errorf("Expected slot 0 to hold 42, got %s", words[0].Hex())
+	}
+}
+
+func TestStorageReaderBytesEncoding(t *testing.T) {
+	s := newTestContractStorage()
+	s.set(slotN(0), word(0, []byte{64}))                      // Short form claiming 32 bytes
+	s.set(slotN(1), slotN(2*31+1))                            // Long form of 31 bytes
+	s.set(slotN(2), slotN(2*(MaxStorageBytesLength+1)+1))     // Too long to read
+	setLongBytes(s, slotN(3), bytes.Repeat([]byte{0x01}, 64)) // Exactly two data slots
+	reader := s.reader()
+
+	for _, slot := range []int64{0, 1} {
+		if _, err := reader.ReadBytes(slotN(slot)); !errors.Is(err, ErrStorageEncoding) {
+			t.Errorf("Slot %d: expected ErrStorageEncoding, got %v", slot, err)
+		}
+	}
+	if _, err := reader.ReadBytes(slotN(2)); err == nil {
+		t.Error("Expected an oversized value to be rejected")
+	}
+	data, err := reader.ReadBytes(slotN(3))
+	if err != nil || !bytes.Equal(data, bytes.Repeat([]byte{0x01}, 64)) {
+		t.Errorf("Expected 64 bytes of 0x01, got %x (%v)", data, err)
+	}
+}
@@ -0,0 +1,106 @@
+package rskblocks
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum-optimism/optimism/op-service/rsk/gorsk/rsktrie"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// EmptyStorageHash is the storageHash of accounts without a storage root node:
+// the hash of an empty trie.
+var EmptyStorageHash = common.BytesToHash(rsktrie.EmptyHash)
+
+// ErrStorageHashMismatch is returned when the storage root proven for an
+// account differs from the expected storage hash.
+var ErrStorageHashMismatch = errors.New("storage hash does not match the proven storage root")
+
+// StorageRootResult contains the result of storage root verification
+type StorageRootResult struct {
+	Valid       bool           // Whether the storage root was proven and matches the expected hash
+	Address     common.Address // The verified address
+	StorageHash common.Hash    // Proven storage root; EmptyStorageHash without a storage root node
+	IsContract  bool           // Whether the account has a storage root node, which RSK creates for every contract
+	HasStorage  bool           // Whether at least one storage slot is set
+	Error       error          // Error if verification failed
+}
+
+// StorageRoot computes the storage root of an account in the unified trie.
+//
+// RSK has no per-account storage trie. As in RSKj, the storage root is the
+// hash of the node at the account storage prefix key, whose subtree holds all
+// storage slots of the account, or EmptyStorageHash if there is no such node.
+// Any change of a storage slot changes it.
+//
+// The trie may be partial, e.g. built by rsktrie.NewPartialTrie; a
+// *rsktrie.MissingNodeError is returned if the storage root node is not
+// available.
+func StorageRoot(trie *rsktrie.Trie, address common.Address) (*StorageRootResult, error) {
+	prefix := rsktrie.NewTrieKeyMapper().GetAccountStoragePrefixKey(address)
+	node, err := trie.TryFind(rsktrie.TrieKeySliceFromKey(prefix))
+	if err != nil {
+		return nil, fmt.Errorf("storage root of %s: %w", address.Hex(), err)
+	}
+
+	result := &StorageRootResult{
+		Valid:       true,
+		Address:     address,
+		StorageHash: EmptyStorageHash,
+	}
+	if node != nil {
+		result.StorageHash = common.BytesToHash(node.GetHash())
+		result.IsContract = node.GetValueLength() > 0
+		result.HasStorage = !node.IsTerminal()
+	}
+	return result, nil
+}
+
+// VerifyStorageRoot verifies the storage root of an account against a state
+// root and checks it against storageHash, e.g. the eth_getProof storageHash
+// field.
+//
+// Parameters:
+//   - stateRoot: The state root from the block header
+//   - address: The account address to verify
+//   - storageHash: The expected storage root
+//   - proofs: RLP-encoded trie nodes from the eth_getProof accountProof and
+//     storageProof[].proofs fields
+//
+// The proofs must cover the storage root node. Unless it is embedded in the
+// account node, which only happens for contracts without storage, this takes
+// a storage proof of any slot of the account.
+//
+// Returns StorageRootResult with Valid=true if the storage root is proven and
+// equals storageHash.
+func (v *ProofVerifier) VerifyStorageRoot(
+	stateRoot common.Hash,
+	address common.Address,
+	storageHash common.Hash,
+	proofs ...[][]byte,
+) (*StorageRootResult, error) {
+	trie, err := rsktrie.NewPartialTrie(stateRoot[:], proofs...)
+	if err != nil {
+		return &StorageRootResult{
+			Valid:   false,
+			Address: address,
+			Error:   err,
+		}, nil
+	}
+
+	result, err := StorageRoot(trie, address)
+	if err != nil {
+		return &StorageRootResult{
+			Valid:   false,
+			Address: address,
+			Error:   err,
+		}, nil
+	}
+
+	if result.StorageHash != storageHash {
+		result.Valid = false
+		result.Error = fmt.Errorf("%w: expected %s, proven %s", ErrStorageHashMismatch, storageHash.Hex(), result.StorageHash.Hex())
+	}
+	return result, nil
+}
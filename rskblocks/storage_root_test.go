@@ -0,0 +1,184 @@
+package rskblocks
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/op-service/rsk/gorsk/rsktrie"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	storageTestContract = common.HexToAddress("0x77045E71a7A2c50903d88e564cD72fab11e82051")
+	storageTestEmpty    = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	storageTestEOA      = common.HexToAddress("0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826")
+	storageTestMissing  = common.HexToAddress("0x2000000000000000000000000000000000000002")
+)
+
+// putContract adds a contract with its storage root marker and slots, as RSKj stores them
+func putContract(trie *rsktrie.Trie, address common.Address, slots map[common.Hash][]byte) *rsktrie.Trie {
+	mapper := rsktrie.NewTrieKeyMapper()
+	accountState, _ := rlp.EncodeToBytes(&AccountState{Nonce: 1, Balance: big.NewInt(0)})
+	trie = trie.Put(mapper.GetAccountKey(address), accountState).
+		Put(mapper.GetAccountStoragePrefixKey(address), []byte{0x01})
+	for slot, value := range slots {
+		trie = trie.Put(mapper.GetAccountStorageKey(address, slot), value)
+	}
+	return trie
+}
+
+func buildStorageTestTrie(slotOne []byte) *rsktrie.Trie {
+	mapper := rsktrie.NewTrieKeyMapper()
+	accountState, _ := rlp.EncodeToBytes(&AccountState{Nonce: 3, Balance: big.NewInt(100)})
+	trie := rsktrie.NewTrie(rsktrie.NewMemTrieStore())
+	trie = putContract(trie, storageTestContract, map[common.Hash][]byte{
+		common.HexToHash("0x00"): {0x2a},
+		common.HexToHash("0x01"): slotOne,
+	})
+	trie = putContract(trie, storageTestEmpty, nil)
+	return trie.Put(mapper.GetAccountKey(storageTestEOA), accountState)
+}
+
+func TestStorageRoot(t *testing.T) {
+	trie := buildStorageTestTrie([]byte{0x01})
+	mapper := rsktrie.NewTrieKeyMapper()
+
+	tests := []struct {
+		name       string
+		address    common.Address
+		isContract bool
+		hasStorage bool
+	}{
+		{"contract with storage", storageTestContract, true, true},
+		{"contract without storage", storageTestEmpty, true, false},
+		{"account without code", storageTestEOA, false, false},
+		{"missing account", storageTestMissing, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := StorageRoot(trie, tt.address)
+			if err != nil {
+				t.Fatalf("StorageRoot failed: %v", err)
+			}
+			if result.IsContract != tt.isContract || result.HasStorage != tt.hasStorage {
+				t.Errorf("Expected IsContract=%v HasStorage=%v, got %+v", tt.isContract, tt.hasStorage, result)
+			}
+
+			want := EmptyStorageHash
+			if node := trie.Find(rsktrie.TrieKeySliceFromKey(mapper.GetAccountStoragePrefixKey(tt.address))); node != nil {
+				want = common.BytesToHash(node.GetHash())
+			}
+			if result.StorageHash != want {
+				t.Errorf("Expected storage root %s, got %s", want.Hex(), result.StorageHash.Hex())
+			}
+		})
+	}
+}
+
+func TestStorageRoot_IndependentOfOtherAccounts(t *testing.T) {
+	slots := map[common.Hash][]byte{common.HexToHash("0x05"): {0x07}}
+	alone := putContract(rsktrie.NewTrie(nil), storageTestContract, slots)
+	crowded := putContract(buildStorageTestTrie([]byte{0x01}), storageTestContract, map[common.Hash][]byte{
+		common.HexToHash("0x00"): nil,
+		common.HexToHash("0x01"): nil,
+	})
+	crowded = putContract(crowded, storageTestContract, slots)
+
+	a, _ := StorageRoot(alone, storageTestContract)
+	b, _ := StorageRoot(crowded, storageTestContract)
+	if a.StorageHash != b.StorageHash {
+		t.Errorf("Expected equal storage roots for equal storage, got %s and %s", a.StorageHash.Hex(), b.StorageHash.Hex())
+	}
+}
+
+func TestStorageRoot_ChangesWithStorage(t *testing.T) {
+	before := buildStorageTestTrie([]byte{0x01})
+	after := buildStorageTestTrie([]byte{0x02})
+
+	for _, address := range []common.Address{storageTestContract, storageTestEmpty} {
+		a, _ := StorageRoot(before, address)
+		b, _ := StorageRoot(after, address)
+		changed := address == storageTestContract
+		if (a.StorageHash != b.StorageHash) != changed {
+			t.Errorf("%s: expected storage changed=%v, roots %s and %s", address.Hex(), changed, a.StorageHash.Hex(), b.StorageHash.Hex())
+		}
+	}
+}
+
+func TestVerifyStorageRoot(t *testing.T) {
+	trie := buildStorageTestTrie([]byte{0x01})
+	stateRoot := common.BytesToHash(trie.GetHash())
+	mapper := rsktrie.NewTrieKeyMapper()
+	verifier := NewProofVerifier()
+
+	accountProof := func(address common.Address) [][]byte {
+		proofNodes, _ := trie.GetProof(mapper.GetAccountKey(address))
+		return proofNodes
+	}
+	storageProof := func(address common.Address, slot string) [][]byte {
+		proofNodes, _ := trie.GetProof(mapper.GetAccountStorageKey(address, common.HexToHash(slot)))
+		return proofNodes
+	}
+	storageRoot := func(address common.Address) common.Hash {
+		result, _ := StorageRoot(trie, address)
+		return result.StorageHash
+	}
+
+	t.Run("contract with storage", func(t *testing.T) {
+		for _, slot := range []string{"0x00", "0x01", "0x99"} {
+			result, err := verifier.VerifyStorageRoot(stateRoot, storageTestContract, storageRoot(storageTestContract),
+				accountProof(storageTestContract), storageProof(storageTestContract, slot))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !result.Valid || !result.HasStorage {
+				t.Errorf("Slot %s: expected a valid storage root with storage, got %+v", slot, result)
+			}
+		}
+	})
+
+	t.Run("contract without storage", func(t *testing.T) {
+		// The storage root node is embedded in the account node
+		result, _ := verifier.VerifyStorageRoot(stateRoot, storageTestEmpty, storageRoot(storageTestEmpty), accountProof(storageTestEmpty))
+		if !result.Valid || !result.IsContract || result.HasStorage {
+			t.Errorf("Expected a valid storage root without storage, got %+v", result)
+		}
+	})
+
+	t.Run("accounts without storage root", func(t *testing.T) {
+		for _, address := range []common.Address{storageTestEOA, storageTestMissing} {
+			result, _ := verifier.VerifyStorageRoot(stateRoot, address, EmptyStorageHash, accountProof(address))
+			if !result.Valid || result.IsContract {
+				t.Errorf("%s: expected a valid empty storage root, got %+v", address.Hex(), result)
+			}
+		}
+	})
+
+	t.Run("storage root not covered", func(t *testing.T) {
+		result, _ := verifier.VerifyStorageRoot(stateRoot, storageTestContract, storageRoot(storageTestContract), accountProof(storageTestContract))
+		var missing *rsktrie.MissingNodeError
+		if result.Valid || !errors.As(result.Error, &missing) {
+			t.Errorf("Expected a MissingNodeError, got %+v", result)
+		}
+	})
+
+	t.Run("wrong storage hash", func(t *testing.T) {
+		result, _ := verifier.VerifyStorageRoot(stateRoot, storageTestContract, EmptyStorageHash,
+			accountProof(storageTestContract), storageProof(storageTestContract, "0x00"))
+		if result.Valid || !errors.Is(result.Error, ErrStorageHashMismatch) {
+			t.Errorf("Expected ErrStorageHashMismatch, got %+v", result)
+		}
+	})
+
+	t.Run("wrong state root", func(t *testing.T) {
+		result, _ := verifier.VerifyStorageRoot(common.Hash{0x01}, storageTestContract, storageRoot(storageTestContract),
+			accountProof(storageTestContract), storageProof(storageTestContract, "0x00"))
+		if result.Valid || result.Error == nil {
+			t.Errorf("Expected an invalid result, got %+v", result)
+		}
+	})
+}
@@ -2,6 +2,8 @@ package rskblocks
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
 	"math/big"
 	"sync/atomic"
@@ -14,6 +16,10 @@ import (
 // Transaction represents an RSK transaction.
 type Transaction struct {
 	data txdata
+	// raw is the encoding the transaction was decoded from. RSKj keeps the
+	// wire form of fields like a zero gas price, which cannot be told from
+	// data, so EncodeRLP writes it back unchanged.
+	raw []byte
 	// caches
 	hash atomic.Value
 	size atomic.Value
@@ -87,10 +93,15 @@ func NewSignedTransaction(nonce uint64, to *common.Address, amount *big.Int, gas
 }
 
 // EncodeRLP implements rlp.Encoder
-// This uses RSK's custom encoding for internal transactions (like REMASC)
-// or standard Ethereum encoding for external signed transactions.
-// The detection is based on whether the transaction has a signature.
+// A decoded transaction is written as it was decoded. Otherwise this uses
+// RSK's custom encoding for internal transactions (like REMASC) or standard
+// Ethereum encoding for external signed transactions. The detection is based
+// on whether the transaction has a signature.
 func (tx *Transaction) EncodeRLP(w io.Writer) error {
+	if tx.raw != nil {
+		_, err := w.Write(tx.raw)
+		return err
+	}
 	// If this is a signed external transaction, use standard Ethereum encoding
 	// REMASC and other internal RSK transactions have V=0, R=0, S=0
 	if tx.isSignedExternal() {
@@ -252,14 +263,77 @@ func (tx *Transaction) GetEncodedRLP() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-// DecodeRLP implements rlp.Decoder
+// txRLP is the wire form of a transaction. RSKj encodes some zero values,
+// like the gas price of REMASC transactions, as a single 0x00 byte, which is
+// not a canonical RLP integer; the fields are thus decoded as bytes.
+type txRLP struct {
+	AccountNonce []byte
+	Price        []byte
+	GasLimit     []byte
+	Recipient    []byte
+	Amount       []byte
+	Payload      []byte
+	V            []byte
+	R            []byte
+	S            []byte
+}
+
+// DecodeRLP implements rlp.Decoder. The encoding is kept for EncodeRLP and Hash.
 func (tx *Transaction) DecodeRLP(s *rlp.Stream) error {
-	_, size, _ := s.Kind()
-	err := s.Decode(&tx.data)
-	if err == nil {
-		tx.size.Store(common.StorageSize(rlp.ListSize(size)))
+	raw, err := s.Raw()
+	if err != nil {
+		return err
+	}
+	var dec txRLP
+	if err := rlp.DecodeBytes(raw, &dec); err != nil {
+		return err
+	}
+
+	nonce, err := rskUint64(dec.AccountNonce)
+	if err != nil {
+		return fmt.Errorf("transaction nonce: %w", err)
+	}
+	gasLimit, err := rskUint64(dec.GasLimit)
+	if err != nil {
+		return fmt.Errorf("transaction gas limit: %w", err)
+	}
+	var to *common.Address
+	switch len(dec.Recipient) {
+	case 0:
+	case common.AddressLength:
+		addr := common.BytesToAddress(dec.Recipient)
+		to = &addr
+	default:
+		return fmt.Errorf("transaction recipient of %d bytes", len(dec.Recipient))
+	}
+
+	tx.data = txdata{
+		AccountNonce: nonce,
+		Price:        new(big.Int).SetBytes(dec.Price),
+		GasLimit:     gasLimit,
+		Recipient:    to,
+		Amount:       new(big.Int).SetBytes(dec.Amount),
+		Payload:      dec.Payload,
+		V:            new(big.Int).SetBytes(dec.V),
+		R:            new(big.Int).SetBytes(dec.R),
+		S:            new(big.Int).SetBytes(dec.S),
+	}
+	tx.raw = raw
+	tx.size.Store(common.StorageSize(len(raw)))
+	return nil
+}
+
+// rskUint64 decodes a big-endian integer that may have leading zero bytes
+func rskUint64(b []byte) (uint64, error) {
+	b = bytes.TrimLeft(b, "\x00")
+	if len(b) > 8 {
+		return 0, errors.New("integer does not fit in 64 bits")
+	}
+	var u uint64
+	for _, x := range b {
+		u = u<<8 | uint64(x)
 	}
-	return err
+	return u, nil
 }
 
 func (tx *Transaction) Hash() common.Hash {
@@ -22,6 +22,10 @@ const (
 	RlpEncodedUnsignedTx = "eb8085e8d4a510008227109413978aee95f38490e9769c39b2773ed763d9cd5f872386f26fc1000080808080"
 )
 
+// RlpEncodedZeroGasPriceTx is testTransactionFromSignedRLP with a zero gas
+// price, which RSKj encodes with encodeCoinNonNullZero as 0x00 rather than 0x80
+const RlpEncodedZeroGasPriceTx = "f86680008227109413978aee95f38490e9769c39b2773ed763d9cd5f872386f26fc10000801ba0eab47c1a49bf2fe5d40e01d313900e19ca485867d462fe06e139e3a536c6d4f4a014a569d327dcda4b29f74f93c0e9729d2f49ad726e703f9cd90dbb0fbf6649f1"
+
 func decodeHexTx(s string) []byte {
 	b, err := hex.DecodeString(s)
 	if err != nil {
@@ -69,6 +73,29 @@ func TestTransactionVectors(t *testing.T) {
 	}
 }
 
+func TestZeroGasPriceSignedTransaction(t *testing.T) {
+	encoded := decodeHexTx(RlpEncodedZeroGasPriceTx)
+	var tx Transaction
+	if err := rlp.DecodeBytes(encoded, &tx); err != nil {
+		t.Fatalf("Failed to decode tx: %v", err)
+	}
+	if tx.GasPrice().Sign() != 0 || !tx.isSignedExternal() {
+		t.Fatalf("Expected a signed transaction with zero gas price, got gas price %s", tx.GasPrice())
+	}
+
+	// The 0x00 gas price is kept, so the hash is that of the wire encoding
+	reencoded, err := rlp.EncodeToBytes(&tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reencoded, encoded) {
+		t.Errorf("Encoding mismatch.\nExpected: %x\nGot:      %x", encoded, reencoded)
+	}
+	if want := keccak256Hash(encoded); tx.Hash() != want {
+		t.Errorf("Expected hash %s, got %s", want.Hex(), tx.Hash().Hex())
+	}
+}
+
 func TestTransactionRLP(t *testing.T) {
 	addr := common.HexToAddress("0xdaea98642337cd3c956116809f48703b4207f2")
 
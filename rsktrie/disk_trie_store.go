@@ -0,0 +1,168 @@
+package rsktrie
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+var (
+	// diskNodePrefix namespaces serialized trie nodes, keyed by node hash
+	diskNodePrefix = []byte("rsktrie-node-")
+	// diskValuePrefix namespaces long values, keyed by value hash
+	diskValuePrefix = []byte("rsktrie-value-")
+)
+
+// DiskTrieStore is a persistent TrieStore backed by a go-ethereum key-value
+// database (e.g. pebble or leveldb).
+//
+// Nodes are stored in their serialized ToMessage form and decoded with
+// FromMessage on Retrieve. Writes from Save are collected in a batch, which
+// is written out whenever it grows past ethdb.IdealBatchSize and on Commit.
+// Batched writes are visible to Retrieve before they are written. A node is
+// marked as saved only once its batch was written, and a batch that fails to
+// be written is kept, so Commit can be retried without losing nodes. A batch
+// that failed to take a write is not written until Commit rebuilds it from
+// the pending writes.
+// Retrieve and RetrieveValue may be called concurrently with each other, but
+// not with Save or Commit.
+type DiskTrieStore struct {
+	db    ethdb.KeyValueStore
+	batch ethdb.Batch
+	// pending holds the writes of batch, which cannot be read back from it
+	// and rebuilt from it after a failed put
+	pending map[string][]byte
+	// unsaved are the nodes written by batch
+	unsaved []*Trie
+	// err is the first error adding a write to batch
+	err error
+	// writeErr is the error of the last failed batch write
+	writeErr error
+}
+
+// NewDiskTrieStore creates a trie store on top of the given database.
+func NewDiskTrieStore(db ethdb.KeyValueStore) *DiskTrieStore {
+	return &DiskTrieStore{
+		db:      db,
+		batch:   db.NewBatch(),
+		pending: make(map[string][]byte),
+	}
+}
+
+// Save adds the serialized node, and its long value if any, to the batch.
+func (s *DiskTrieStore) Save(t *Trie) {
+	if t == nil {
+		return
+	}
+	s.put(diskNodeKey(t.GetHash()), t.ToMessage())
+
+	if value, _, _ := t.lazyFields(); t.HasLongValue() && value != nil {
+		s.put(diskValueKey(t.GetValueHash()), value)
+	}
+	s.unsaved = append(s.unsaved, t)
+
+	// After a failed write the batch grows until Commit retries it
+	if s.batch.ValueSize() >= ethdb.IdealBatchSize && s.writeErr == nil {
+		s.writeErr = s.write()
+	}
+}
+
+func (s *DiskTrieStore) put(key, value []byte) {
+	if err := s.batch.Put(key, value); err != nil && s.err == nil {
+		s.err = err
+	}
+	s.pending[string(key)] = value
+}
+
+// write writes the batch to the database and marks its nodes as saved. On
+// failure the batch is kept for the next attempt. A batch missing a write is
+// not written.
+func (s *DiskTrieStore) write() error {
+	if s.err != nil {
+		return s.err
+	}
+	if err := s.batch.Write(); err != nil {
+		return fmt.Errorf("write trie batch: %w", err)
+	}
+	for _, t := range s.unsaved {
+		t.saved = true
+	}
+	s.reset()
+	return nil
+}
+
+// reset empties the batch and clears its errors
+func (s *DiskTrieStore) reset() {
+	s.batch.Reset()
+	s.pending = make(map[string][]byte)
+	s.unsaved = nil
+	s.err = nil
+	s.writeErr = nil
+}
+
+// Commit writes all pending nodes and values to the database. It returns the
+// first error found while batching, or the error writing the batch.
+func (s *DiskTrieStore) Commit() error {
+	if s.err != nil {
+		// The batch misses a write, so it is rebuilt
+		s.batch.Reset()
+		s.err = nil
+		for key, value := range s.pending {
+			s.put([]byte(key), value)
+		}
+	}
+	s.writeErr = s.write()
+	return s.writeErr
+}
+
+// Retrieve loads and decodes the node with the given hash, or returns nil if it is not stored.
+func (s *DiskTrieStore) Retrieve(hash []byte) *Trie {
+	if hash == nil {
+		return nil
+	}
+	message := s.get(diskNodeKey(hash))
+	if message == nil {
+		return nil
+	}
+
+	node, err := FromMessage(message, s)
+	if err != nil {
+		log.Printf("Broken database: cannot decode node %x: %v", hash, err)
+		return nil
+	}
+	node.saved = true
+	return node
+}
+
+// RetrieveValue loads the long value with the given hash, or returns nil if it is not stored.
+func (s *DiskTrieStore) RetrieveValue(hash []byte) []byte {
+	if hash == nil {
+		return nil
+	}
+	return s.get(diskValueKey(hash))
+}
+
+func (s *DiskTrieStore) get(key []byte) []byte {
+	if val, ok := s.pending[string(key)]; ok {
+		dst := make([]byte, len(val))
+		copy(dst, val)
+		return dst
+	}
+	if ok, err := s.db.Has(key); err != nil || !ok {
+		return nil
+	}
+	val, err := s.db.Get(key)
+	if err != nil {
+		return nil
+	}
+	return val
+}
+
+func diskNodeKey(hash []byte) []byte {
+	return append(append([]byte{}, diskNodePrefix...), hash...)
+}
+
+func diskValueKey(hash []byte) []byte {
+	return append(append([]byte{}, diskValuePrefix...), hash...)
+}
@@ -0,0 +1,251 @@
+package rsktrie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+)
+
+func TestDiskTrieStoreSaveCommitAndReopen(t *testing.T) {
+	db := memorydb.New()
+	store := NewDiskTrieStore(db)
+
+	trie := NewTrie(store)
+	for k := 0; k < 100; k++ {
+		trie = trie.Put([]byte(fmt.Sprintf("key%d", k)), makeValue(k+1))
+	}
+	rootHash := trie.GetHash()
+
+	trie.Save(store)
+	if err := store.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	// A new store on the same database only sees committed data
+	reopened, err := NewTrieFromStore(NewDiskTrieStore(db), rootHash)
+	if err != nil {
+		t.Fatalf("NewTrieFromStore failed: %v", err)
+	}
+	if !bytes.Equal(reopened.GetHash(), rootHash) {
+		t.Errorf("Root hash mismatch: got %x, want %x", reopened.GetHash(), rootHash)
+	}
+	for k := 0; k < 100; k++ {
+		got, err := reopened.TryGet([]byte(fmt.Sprintf("key%d", k)))
+		if err != nil {
+			t.Fatalf("TryGet failed: %v", err)
+		}
+		if !bytes.Equal(got, makeValue(k+1)) {
+			t.Errorf("Value mismatch for key%d", k)
+		}
+	}
+}
+
+func TestDiskTrieStoreRetrievesPendingWrites(t *testing.T) {
+	db := memorydb.New()
+	store := NewDiskTrieStore(db)
+
+	trie := NewTrie(store).Put([]byte("foo"), makeValue(100)).Put([]byte("bar"), []byte("baz"))
+	trie.Save(store)
+
+	if db.Len() != 0 {
+		t.Errorf("Expected no writes before commit, got %d", db.Len())
+	}
+
+	node := store.Retrieve(trie.GetHash())
+	if node == nil {
+		t.Fatal("Expected pending node to be retrievable")
+	}
+	if !bytes.Equal(node.Get([]byte("foo")), makeValue(100)) {
+		t.Error("Long value mismatch")
+	}
+	if !node.WasSaved() {
+		t.Error("Expected retrieved node to be marked as saved")
+	}
+}
+
+func TestDiskTrieStoreUsesSeparateValueNamespace(t *testing.T) {
+	db := memorydb.New()
+	store := NewDiskTrieStore(db)
+
+	value := makeValue(100)
+	trie := NewTrie(store).Put([]byte("foo"), value)
+	trie.Save(store)
+	if err := store.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	if store.Retrieve(Keccak256(value)) != nil {
+		t.Error("Expected value hash not to resolve to a node")
+	}
+	if !bytes.Equal(store.RetrieveValue(Keccak256(value)), value) {
+		t.Error("Expected long value in the value namespace")
+	}
+	if store.RetrieveValue(trie.GetHash()) != nil {
+		t.Error("Expected node hash not to resolve to a value")
+	}
+}
+
+func TestDiskTrieStoreWritesLargeBatches(t *testing.T) {
+	db := memorydb.New()
+	store := NewDiskTrieStore(db)
+
+	trie := NewTrie(store)
+	for k := 0; k < 400; k++ {
+		trie = trie.Put([]byte(fmt.Sprintf("key%d", k)), makeValue(1000+k))
+	}
+	rootHash := trie.GetHash()
+	trie.Save(store)
+
+	if db.Len() == 0 {
+		t.Error("Expected full batches to be written before commit")
+	}
+	if size := store.batch.ValueSize(); size >= ethdb.IdealBatchSize {
+		t.Errorf("Expected the pending batch below %d bytes, got %d", ethdb.IdealBatchSize, size)
+	}
+	if err := store.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	reopened, err := NewTrieFromStore(NewDiskTrieStore(db), rootHash)
+	if err != nil {
+		t.Fatalf("NewTrieFromStore failed: %v", err)
+	}
+	for k := 0; k < 400; k++ {
+		got, err := reopened.TryGet([]byte(fmt.Sprintf("key%d", k)))
+		if err != nil {
+			t.Fatalf("TryGet failed: %v", err)
+		}
+		if !bytes.Equal(got, makeValue(1000+k)) {
+			t.Errorf("Value mismatch for key%d", k)
+		}
+	}
+}
+
+// failingBatchDB fails batch writes while fail is set, and the next failPuts
+// batch puts
+type failingBatchDB struct {
+	*memorydb.Database
+	fail     bool
+	failPuts int
+}
+
+func (db *failingBatchDB) NewBatch() ethdb.Batch {
+	return &failingBatch{Batch: db.Database.NewBatch(), db: db}
+}
+
+type failingBatch struct {
+	ethdb.Batch
+	db *failingBatchDB
+}
+
+func (b *failingBatch) Put(key, value []byte) error {
+	if b.db.failPuts > 0 {
+		b.db.failPuts--
+		return errors.New("out of memory")
+	}
+	return b.Batch.Put(key, value)
+}
+
+func (b *failingBatch) Write() error {
+	if b.db.fail {
+		return errors.New("disk full")
+	}
+	return b.Batch.Write()
+}
+
+func TestDiskTrieStoreRetriesFailedCommit(t *testing.T) {
+	db := &failingBatchDB{Database: memorydb.New(), fail: true}
+	store := NewDiskTrieStore(db)
+
+	trie := NewTrie(store)
+	for k := 0; k < 20; k++ {
+		trie = trie.Put([]byte(fmt.Sprintf("key%d", k)), makeValue(k+1))
+	}
+	rootHash := trie.GetHash()
+	trie.Save(store)
+
+	if err := store.Commit(); err == nil {
+		t.Fatal("Expected Commit to fail")
+	}
+	if trie.WasSaved() {
+		t.Error("Expected nodes not to be marked as saved after a failed commit")
+	}
+
+	db.fail = false
+	trie.Save(store)
+	if err := store.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if !trie.WasSaved() {
+		t.Error("Expected nodes to be marked as saved after commit")
+	}
+
+	reopened, err := NewTrieFromStore(NewDiskTrieStore(db), rootHash)
+	if err != nil {
+		t.Fatalf("NewTrieFromStore failed: %v", err)
+	}
+	for k := 0; k < 20; k++ {
+		got, err := reopened.TryGet([]byte(fmt.Sprintf("key%d", k)))
+		if err != nil {
+			t.Fatalf("TryGet failed: %v", err)
+		}
+		if !bytes.Equal(got, makeValue(k+1)) {
+			t.Errorf("Value mismatch for key%d", k)
+		}
+	}
+}
+
+func TestDiskTrieStoreRetriesFailedPuts(t *testing.T) {
+	db := &failingBatchDB{Database: memorydb.New(), failPuts: 1}
+	store := NewDiskTrieStore(db)
+
+	// Enough data for full batches, which are not written after a failed put
+	trie := NewTrie(store)
+	for k := 0; k < 400; k++ {
+		trie = trie.Put([]byte(fmt.Sprintf("key%d", k)), makeValue(1000+k))
+	}
+	rootHash := trie.GetHash()
+	trie.Save(store)
+
+	if db.Len() != 0 {
+		t.Errorf("Expected no writes after a failed put, got %d", db.Len())
+	}
+	if trie.WasSaved() {
+		t.Error("Expected nodes not to be marked as saved after a failed put")
+	}
+
+	// Commit rebuilds the batch, failing again
+	db.failPuts = 1
+	if err := store.Commit(); err == nil {
+		t.Fatal("Expected Commit to fail")
+	}
+	if trie.WasSaved() {
+		t.Error("Expected nodes not to be marked as saved after a failed commit")
+	}
+
+	db.failPuts = 0
+	if err := store.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if !trie.WasSaved() {
+		t.Error("Expected nodes to be marked as saved after commit")
+	}
+
+	reopened, err := NewTrieFromStore(NewDiskTrieStore(db), rootHash)
+	if err != nil {
+		t.Fatalf("NewTrieFromStore failed: %v", err)
+	}
+	for k := 0; k < 400; k++ {
+		got, err := reopened.TryGet([]byte(fmt.Sprintf("key%d", k)))
+		if err != nil {
+			t.Fatalf("TryGet failed: %v", err)
+		}
+		if !bytes.Equal(got, makeValue(1000+k)) {
+			t.Errorf("Value mismatch for key%d", k)
+		}
+	}
+}
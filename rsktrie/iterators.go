@@ -1,6 +1,7 @@
 package rsktrie
 
 import (
+	"bytes"
 	"container/list"
 )
 
@@ -178,3 +179,188 @@ func (it *PostOrderIterator) pushLeftmostNodeRecord(nodeKey *TrieKeySlice, node
 		it.pushLeftmostNodeRecord(leftNodeKey, leftNode)
 	}
 }
+
+// KeyValue is a full trie key and its value.
+type KeyValue struct {
+	Key   []byte
+	Value []byte
+}
+
+// rangeFrame is a subtree waiting to be visited. path holds the key bits
+// above the subtree's root node, which is only loaded when the frame is visited.
+type rangeFrame struct {
+	ref  *NodeReference
+	node *Trie
+	path []byte
+}
+
+// RangeIterator yields the (key, value) pairs of a trie with start <= key < end,
+// in key order. Valueless nodes are skipped. It seeks directly to start and
+// only loads the subtrees that can hold keys in the range.
+//
+// Loading a missing node or long value stops the iteration; Err reports why.
+type RangeIterator struct {
+	visiting *list.List // Stack of *rangeFrame
+	end      []byte
+	next     *KeyValue
+	err      error
+}
+
+// NewRangeIterator iterates over the keys in [start, end). A nil start begins
+// at the first key and a nil end runs to the last one.
+func NewRangeIterator(root *Trie, start, end []byte) *RangeIterator {
+	it := &RangeIterator{visiting: list.New(), end: end}
+	if root != nil && !root.IsEmptyTrie() {
+		it.seek(&rangeFrame{node: root, path: []byte{}}, TrieKeySliceFromKey(start).Expand())
+	}
+	it.advance()
+	return it
+}
+
+// NewPrefixIterator iterates over the keys that start with prefix.
+func NewPrefixIterator(root *Trie, prefix []byte) *RangeIterator {
+	return NewRangeIterator(root, prefix, prefixEnd(prefix))
+}
+
+func (it *RangeIterator) HasNext() bool {
+	return it.next != nil
+}
+
+func (it *RangeIterator) Next() *KeyValue {
+	kv := it.next
+	if kv != nil {
+		it.advance()
+	}
+	return kv
+}
+
+// Err returns the error that stopped the iteration early, if any.
+func (it *RangeIterator) Err() error {
+	return it.err
+}
+
+// seek pushes the subtrees below frame holding keys >= start, so that the
+// smallest of them is on top of the stack.
+func (it *RangeIterator) seek(frame *rangeFrame, start []byte) {
+	node, path := it.load(frame)
+	if node == nil {
+		return
+	}
+
+	common := len(path)
+	if len(start) < common {
+		common = len(start)
+	}
+	if cmp := bytes.Compare(path[:common], start[:common]); cmp != 0 {
+		if cmp > 0 {
+			it.visiting.PushFront(&rangeFrame{node: node, path: frame.path})
+		}
+		return
+	}
+	if len(path) >= len(start) {
+		// Every key below node starts with start
+		it.visiting.PushFront(&rangeFrame{node: node, path: frame.path})
+		return
+	}
+
+	// node's own key is a proper prefix of start, so it sorts before it
+	bit := start[len(path)]
+	if bit == 0 {
+		if right := childFrame(node, path, 1); right != nil {
+			it.visiting.PushFront(right)
+		}
+	}
+	if child := childFrame(node, path, bit); child != nil {
+		it.seek(child, start)
+	}
+}
+
+// advance finds the next value in range, or clears next when done.
+func (it *RangeIterator) advance() {
+	it.next = nil
+	for it.err == nil && it.visiting.Len() > 0 {
+		frame := it.visiting.Remove(it.visiting.Front()).(*rangeFrame)
+
+		// All keys below frame start with its path, and frames come in key
+		// order, so nothing is left in range once a path reaches end
+		if it.end != nil && bytes.Compare(PathEncoderEncode(frame.path), it.end) >= 0 {
+			it.visiting.Init()
+			return
+		}
+
+		node, path := it.load(frame)
+		if node == nil {
+			return
+		}
+
+		// Push right then left (LIFO stack)
+		if right := childFrame(node, path, 1); right != nil {
+			it.visiting.PushFront(right)
+		}
+		if left := childFrame(node, path, 0); left != nil {
+			it.visiting.PushFront(left)
+		}
+
+		if node.valueLength == 0 {
+			continue
+		}
+		key := PathEncoderEncode(path)
+		if it.end != nil && bytes.Compare(key, it.end) >= 0 {
+			it.visiting.Init()
+			return
+		}
+		value, err := node.TryGetValue()
+		if err != nil {
+			it.err = err
+			return
+		}
+		it.next = &KeyValue{Key: key, Value: value}
+		return
+	}
+}
+
+// load returns the frame's node and the full key bits of that node.
+func (it *RangeIterator) load(frame *rangeFrame) (*Trie, []byte) {
+	node := frame.node
+	if node == nil {
+		var err error
+		if node, err = frame.ref.TryGetNode(); err != nil {
+			it.err = err
+			return nil, nil
+		}
+	}
+
+	path := make([]byte, 0, len(frame.path)+node.sharedPath.Length())
+	path = append(path, frame.path...)
+	path = append(path, node.sharedPath.Expand()...)
+	return node, path
+}
+
+// childFrame returns the frame for the child of node along bit, or nil if there is none.
+func childFrame(node *Trie, path []byte, bit byte) *rangeFrame {
+	ref := node.left
+	if bit == 1 {
+		ref = node.right
+	}
+	if ref.IsEmpty() {
+		return nil
+	}
+
+	childPath := make([]byte, 0, len(path)+1)
+	childPath = append(childPath, path...)
+	childPath = append(childPath, bit)
+	return &rangeFrame{ref: ref, path: childPath}
+}
+
+// prefixEnd returns the smallest key greater than every key starting with
+// prefix, or nil if there is none.
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
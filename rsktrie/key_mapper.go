@@ -1,6 +1,10 @@
 package rsktrie
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+
 	"github.com/ethereum/go-ethereum/common"
 )
 
@@ -16,6 +20,15 @@ var (
 	CodePrefix    = []byte{0x80} // MSB 1 for branching
 )
 
+var (
+	// ErrUnknownTrieKey is returned by ParseKey for keys that do not have the
+	// layout of any account, code or storage key.
+	ErrUnknownTrieKey = errors.New("unknown trie key layout")
+	// ErrSecurePrefixMismatch is returned by ParseKey when a secure key prefix
+	// is not the Keccak256 prefix of the address or storage slot that follows it.
+	ErrSecurePrefixMismatch = errors.New("secure key prefix mismatch")
+)
+
 // TrieKeyMapper generates trie keys for accounts and storage in RSK's unified trie
 type TrieKeyMapper struct{}
 
@@ -68,19 +81,115 @@ func (m *TrieKeyMapper) GetAccountStorageKey(addr common.Address, storageKey com
 	return result
 }
 
+// TrieKeyType classifies a key of the unified trie.
+type TrieKeyType int
+
+const (
+	// TrieKeyAccount is the key of an account state
+	TrieKeyAccount TrieKeyType = iota + 1
+	// TrieKeyCode is the key of a contract's code
+	TrieKeyCode
+	// TrieKeyStorageRoot is the storage prefix key of a contract, whose node
+	// roots its storage slots
+	TrieKeyStorageRoot
+	// TrieKeyStorageSlot is the key of a single storage slot
+	TrieKeyStorageSlot
+)
+
+func (k TrieKeyType) String() string {
+	switch k {
+	case TrieKeyAccount:
+		return "account"
+	case TrieKeyCode:
+		return "code"
+	case TrieKeyStorageRoot:
+		return "storage root"
+	case TrieKeyStorageSlot:
+		return "storage slot"
+	default:
+		return fmt.Sprintf("TrieKeyType(%d)", int(k))
+	}
+}
+
+// ParsedTrieKey is a unified trie key decoded by ParseKey.
+type ParsedTrieKey struct {
+	Type    TrieKeyType
+	Address common.Address
+	// StrippedSlot holds the slot bytes stored in a storage slot key, which
+	// have their leading zeros removed
+	StrippedSlot []byte
+}
+
+// Slot returns the storage slot of a TrieKeyStorageSlot key.
+func (k *ParsedTrieKey) Slot() common.Hash {
+	return common.BytesToHash(k.StrippedSlot)
+}
+
+// ParseKey is the inverse of the key builders above: it classifies a full
+// trie key, e.g. one returned by an iterator or Diff, and extracts its
+// address and storage slot. Every secure prefix in the key is checked
+// against the data it hashes.
+func (m *TrieKeyMapper) ParseKey(key []byte) (*ParsedTrieKey, error) {
+	accountKeyLen := len(DomainPrefix) + SecureAccountKey
+	if len(key) < accountKeyLen || !bytes.HasPrefix(key, DomainPrefix) {
+		return nil, fmt.Errorf("%w: %x", ErrUnknownTrieKey, key)
+	}
+
+	address := key[len(DomainPrefix)+SecureKeySize : accountKeyLen]
+	if err := m.checkSecurePrefix(key[len(DomainPrefix):], address); err != nil {
+		return nil, fmt.Errorf("address %x: %w", address, err)
+	}
+	parsed := &ParsedTrieKey{Address: common.BytesToAddress(address)}
+
+	rest := key[accountKeyLen:]
+	switch {
+	case len(rest) == 0:
+		parsed.Type = TrieKeyAccount
+	case bytes.Equal(rest, CodePrefix):
+		parsed.Type = TrieKeyCode
+	case bytes.Equal(rest, StoragePrefix):
+		parsed.Type = TrieKeyStorageRoot
+	case bytes.HasPrefix(rest, StoragePrefix) && len(rest) >= len(StoragePrefix)+SecureKeySize:
+		secureSlot := rest[len(StoragePrefix):]
+		// Slot zero is stored as a single zero byte, any other slot without
+		// its leading zeros
+		stripped := secureSlot[SecureKeySize:]
+		if len(stripped) == 0 || len(stripped) > common.HashLength || (len(stripped) > 1 && stripped[0] == 0) {
+			return nil, fmt.Errorf("%w: storage slot %x", ErrUnknownTrieKey, stripped)
+		}
+		slot := common.BytesToHash(stripped)
+		if err := m.checkSecurePrefix(secureSlot, slot.Bytes()); err != nil {
+			return nil, fmt.Errorf("storage slot %x: %w", stripped, err)
+		}
+		parsed.Type = TrieKeyStorageSlot
+		parsed.StrippedSlot = stripped
+	default:
+		return nil, fmt.Errorf("%w: %x", ErrUnknownTrieKey, key)
+	}
+	return parsed, nil
+}
+
+// checkSecurePrefix checks that key starts with the secure prefix of data.
+func (m *TrieKeyMapper) checkSecurePrefix(key, data []byte) error {
+	if !bytes.Equal(key[:SecureKeySize], m.SecureKeyPrefix(data)) {
+		return fmt.Errorf("%w: got %x, want %x", ErrSecurePrefixMismatch, key[:SecureKeySize], m.SecureKeyPrefix(data))
+	}
+	return nil
+}
+
 // SecureKeyPrefix returns the first 10 bytes of keccak256(key)
 func (m *TrieKeyMapper) SecureKeyPrefix(key []byte) []byte {
 	hash := Keccak256(key)
 	return hash[:SecureKeySize]
 }
 
-// stripLeadingZeros removes leading zero bytes from a byte slice
+// stripLeadingZeros removes leading zero bytes from a byte slice. As in RSKj's
+// ByteUtil.stripLeadingZeroes, an all-zero slice keeps a single zero byte.
 func stripLeadingZeros(data []byte) []byte {
 	for i := 0; i < len(data); i++ {
 		if data[i] != 0 {
 			return data[i:]
 		}
 	}
-	// If all zeros, return empty slice (or single zero byte depending on RSK behavior)
-	return []byte{}
+	return []byte{0x00}
 }
@@ -0,0 +1,117 @@
+package rsktrie
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestParseKeyRoundTrip(t *testing.T) {
+	mapper := NewTrieKeyMapper()
+	addr := common.HexToAddress("0x77045E71a7A2c50903d88e564cD72fab11e82051")
+	slot := common.HexToHash("0x0000000000000000000000000000000000000000000000000000000000ab00cd")
+
+	tests := []struct {
+		name string
+		key  []byte
+		want TrieKeyType
+	}{
+		{"account", mapper.GetAccountKey(addr), TrieKeyAccount},
+		{"code", mapper.GetCodeKey(addr), TrieKeyCode},
+		{"storage root", mapper.GetAccountStoragePrefixKey(addr), TrieKeyStorageRoot},
+		{"storage slot", mapper.GetAccountStorageKey(addr, slot), TrieKeyStorageSlot},
+		{"zero storage slot", mapper.GetAccountStorageKey(addr, common.Hash{}), TrieKeyStorageSlot},
+	}
+	for _, tt := range tests {
+		parsed, err := mapper.ParseKey(tt.key)
+		if err != nil {
+			t.Errorf("%s: ParseKey failed: %v", tt.name, err)
+			continue
+		}
+		if parsed.Type != tt.want {
+			t.Errorf("%s: expected type %v, got %v", tt.name, tt.want, parsed.Type)
+		}
+		if parsed.Address != addr {
+			t.Errorf("%s: expected address %x, got %x", tt.name, addr, parsed.Address)
+		}
+	}
+
+	parsed, _ := mapper.ParseKey(mapper.GetAccountStorageKey(addr, slot))
+	if parsed.Slot() != slot {
+		t.Errorf("Expected slot %x, got %x", slot, parsed.Slot())
+	}
+	if !bytes.Equal(parsed.StrippedSlot, []byte{0xab, 0x00, 0xcd}) {
+		t.Errorf("Expected stripped slot abcd, got %x", parsed.StrippedSlot)
+	}
+
+	parsed, _ = mapper.ParseKey(mapper.GetAccountStorageKey(addr, common.Hash{}))
+	if parsed.Slot() != (common.Hash{}) || !bytes.Equal(parsed.StrippedSlot, []byte{0x00}) {
+		t.Errorf("Expected slot zero stored as 00, got %x", parsed.StrippedSlot)
+	}
+}
+
+func TestParseKeyRejectsInvalidKeys(t *testing.T) {
+	mapper := NewTrieKeyMapper()
+	addr := common.HexToAddress("0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826")
+	slot := common.HexToHash("0x05")
+
+	badAddress := mapper.GetAccountKey(addr)
+	badAddress[len(badAddress)-1] ^= 0x01
+	badSlot := mapper.GetAccountStorageKey(addr, slot)
+	badSlot[len(badSlot)-1] = 0x06
+	paddedSlot := append(mapper.GetAccountStoragePrefixKey(addr), mapper.SecureKeyPrefix(slot.Bytes())...)
+	paddedSlot = append(paddedSlot, 0x00, 0x05)
+	emptySlot := append(mapper.GetAccountStoragePrefixKey(addr), mapper.SecureKeyPrefix(common.Hash{}.Bytes())...)
+
+	tests := []struct {
+		name string
+		key  []byte
+		want error
+	}{
+		{"empty", nil, ErrUnknownTrieKey},
+		{"short", mapper.GetAccountKey(addr)[:20], ErrUnknownTrieKey},
+		{"wrong domain", append([]byte{0x01}, mapper.GetAccountKey(addr)[1:]...), ErrUnknownTrieKey},
+		{"unknown suffix", append(mapper.GetAccountKey(addr), 0x42), ErrUnknownTrieKey},
+		{"truncated slot prefix", append(mapper.GetAccountStoragePrefixKey(addr), 0x01, 0x02), ErrUnknownTrieKey},
+		{"slot not stripped", paddedSlot, ErrUnknownTrieKey},
+		{"empty slot", emptySlot, ErrUnknownTrieKey},
+		{"address prefix mismatch", badAddress, ErrSecurePrefixMismatch},
+		{"slot prefix mismatch", badSlot, ErrSecurePrefixMismatch},
+	}
+	for _, tt := range tests {
+		if _, err := mapper.ParseKey(tt.key); !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestParseKeysOfTrieWalk(t *testing.T) {
+	mapper := NewTrieKeyMapper()
+	addr := common.HexToAddress("0x77045E71a7A2c50903d88e564cD72fab11e82051")
+
+	trie := NewTrie(NewMemTrieStore())
+	trie = trie.Put(mapper.GetAccountKey(addr), []byte{0x01})
+	trie = trie.Put(mapper.GetCodeKey(addr), []byte{0x60, 0x80})
+	trie = trie.Put(mapper.GetAccountStoragePrefixKey(addr), []byte{0x01})
+	for slot := 0; slot < 10; slot++ {
+		trie = trie.Put(mapper.GetAccountStorageKey(addr, common.BytesToHash([]byte{byte(slot)})), []byte{byte(slot + 1)})
+	}
+
+	counts := make(map[TrieKeyType]int)
+	for it := trie.GetPrefixIterator(DomainPrefix); it.HasNext(); {
+		kv := it.Next()
+		parsed, err := mapper.ParseKey(kv.Key)
+		if err != nil {
+			t.Fatalf("ParseKey(%x) failed: %v", kv.Key, err)
+		}
+		if parsed.Type == TrieKeyStorageSlot && parsed.Slot() != common.BytesToHash([]byte{kv.Value[0] - 1}) {
+			t.Errorf("Slot %x does not match its value %x", parsed.Slot(), kv.Value)
+		}
+		counts[parsed.Type]++
+	}
+	if counts[TrieKeyAccount] != 1 || counts[TrieKeyCode] != 1 || counts[TrieKeyStorageRoot] != 1 || counts[TrieKeyStorageSlot] != 10 {
+		t.Errorf("Unexpected key types: %v", counts)
+	}
+}
@@ -0,0 +1,181 @@
+package rsktrie
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// MultiProof proves the values, or the absence, of several keys against one
+// trie root. In the unified trie the paths of related keys, like an account
+// and its storage slots, share most of their upper nodes; a MultiProof holds
+// each of them once, where a proof per key repeats them.
+//
+// Nodes are serialized messages, not RLP-wrapped one by one as in GetProof,
+// in pre-order from the root. Nodes embedded in their parent are left out,
+// since the parent's message already contains them.
+type MultiProof struct {
+	Nodes [][]byte
+}
+
+// GetMultiProof returns a MultiProof for keys. Like GetProof, it proves the
+// absence of keys that are not in the trie.
+func (t *Trie) GetMultiProof(keys ...[]byte) (*MultiProof, error) {
+	nodes := make(map[string]*Trie)
+	for _, key := range keys {
+		path, err := t.GetNodes(key)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range path {
+			nodes[string(node.GetHash())] = node
+		}
+	}
+	return collectMultiProof(t, nodes), nil
+}
+
+// NewMultiProof compacts proofs for the same root, e.g. the accountProof and
+// storageProof[].proof fields of an eth_getProof response, into a MultiProof.
+// Proof nodes are RLP-wrapped as in GetProof. Nodes that are not reachable
+// from the root are dropped.
+func NewMultiProof(rootHash []byte, proofs ...[][]byte) (*MultiProof, error) {
+	nodes := make(map[string]*Trie)
+	for i, proof := range proofs {
+		for j, rlpNode := range proof {
+			var serialized []byte
+			if err := rlp.DecodeBytes(rlpNode, &serialized); err != nil {
+				return nil, fmt.Errorf("proof %d: RLP decode proof node %d: %w", i, j, err)
+			}
+			hash := Keccak256(serialized)
+			if _, ok := nodes[string(hash)]; ok {
+				continue
+			}
+			node, err := FromMessageStrict(serialized, nil)
+			if err != nil {
+				return nil, fmt.Errorf("proof %d: parse proof node %d: %w", i, j, err)
+			}
+			nodes[string(hash)] = node
+		}
+	}
+
+	root, ok := nodes[string(rootHash)]
+	if !ok {
+		return nil, fmt.Errorf("root hash %x not found in proof nodes", rootHash)
+	}
+	return collectMultiProof(root, nodes), nil
+}
+
+// collectMultiProof lists root and the nodes it references by hash that are
+// in nodes, in pre-order. Equal subtrees at different positions are listed once.
+func collectMultiProof(root *Trie, nodes map[string]*Trie) *MultiProof {
+	proof := &MultiProof{}
+	listed := make(map[string]bool)
+
+	var visit func(node *Trie)
+	visit = func(node *Trie) {
+		proof.Nodes = append(proof.Nodes, node.ToMessage())
+		for _, child := range []*NodeReference{node.left, node.right} {
+			if child.IsEmpty() || child.IsEmbeddable() {
+				continue
+			}
+			hash := string(child.GetHash())
+			if next, ok := nodes[hash]; ok && !listed[hash] {
+				listed[hash] = true
+				visit(next)
+			}
+		}
+	}
+	listed[string(root.GetHash())] = true
+	visit(root)
+	return proof
+}
+
+// Encode serializes the proof as an RLP list of node messages
+func (p *MultiProof) Encode() ([]byte, error) {
+	return rlp.EncodeToBytes(p.Nodes)
+}
+
+// DecodeMultiProof decodes a proof serialized by Encode
+func DecodeMultiProof(data []byte) (*MultiProof, error) {
+	var nodes [][]byte
+	if err := rlp.DecodeBytes(data, &nodes); err != nil {
+		return nil, fmt.Errorf("RLP decode multiproof: %w", err)
+	}
+	return &MultiProof{Nodes: nodes}, nil
+}
+
+// KeyProof is the proven value, or absence, of one key of a MultiProof
+type KeyProof struct {
+	Key       []byte
+	Value     []byte
+	Absent    bool // The proof shows that the key is not in the trie
+	Exclusion *ExclusionProof
+	Trace     []ProofStep
+}
+
+// MultiProofResult contains the result of multiproof verification
+type MultiProofResult struct {
+	Valid bool
+	Keys  []*KeyProof // One per verified key, in the order of the keys
+	Error error
+}
+
+// VerifyMultiProof verifies a MultiProof for keys against a state root.
+// The proof nodes are decoded once and every key is walked through them; all
+// of them must be on the path of some key.
+//
+// Use TrieKeyMapper for the keys of accounts, code and storage slots.
+func (v *ProofVerifier) VerifyMultiProof(
+	stateRoot common.Hash,
+	keys [][]byte,
+	proof *MultiProof,
+) (*MultiProofResult, error) {
+	proven, err := verifyMultiProof(stateRoot[:], keys, proof)
+	if err != nil {
+		return &MultiProofResult{
+			Valid: false,
+			Error: err,
+		}, nil
+	}
+
+	return &MultiProofResult{
+		Valid: true,
+		Keys:  proven,
+	}, nil
+}
+
+func verifyMultiProof(rootHash []byte, keys [][]byte, proof *MultiProof) ([]*KeyProof, error) {
+	if len(proof.Nodes) == 0 {
+		return nil, fmt.Errorf("empty proof")
+	}
+
+	nodes := make(proofNodeSet, len(proof.Nodes))
+	for i, serialized := range proof.Nodes {
+		if err := nodes.add(i, serialized); err != nil {
+			return nil, err
+		}
+	}
+
+	used := make(map[string]bool)
+	proven := make([]*KeyProof, len(keys))
+	for i, key := range keys {
+		walk, err := nodes.walk(rootHash, key, used)
+		if err != nil {
+			return nil, fmt.Errorf("key %x: %w", key, err)
+		}
+		proven[i] = &KeyProof{
+			Key:       key,
+			Value:     walk.Value(),
+			Absent:    walk.Exclusion != nil,
+			Exclusion: walk.Exclusion,
+			Trace:     walk.Trace,
+		}
+	}
+
+	// Nodes on no key's path are not bound to the keys by the root hash
+	if len(used) != len(nodes) {
+		return nil, fmt.Errorf("proof contains %d nodes not on the path of any key", len(nodes)-len(used))
+	}
+	return proven, nil
+}
@@ -0,0 +1,196 @@
+package rsktrie
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var multiProofContract = common.HexToAddress("0x77045E71a7A2c50903d88e564cD72fab11e82051")
+
+func multiProofAccount(i int) common.Address {
+	return common.BytesToAddress([]byte{0xac, byte(i)})
+}
+
+func multiProofSlot(i int) common.Hash {
+	return common.BytesToHash([]byte{byte(i)})
+}
+
+// buildMultiProofTestTrie holds 40 accounts and a contract with 20 storage slots
+func buildMultiProofTestTrie() *Trie {
+	mapper := NewTrieKeyMapper()
+	trie := NewTrie(NewMemTrieStore())
+	for i := 0; i < 40; i++ {
+		trie = trie.Put(mapper.GetAccountKey(multiProofAccount(i)), makeValue(i%10+5))
+	}
+	trie = trie.Put(mapper.GetAccountKey(multiProofContract), makeValue(12)).
+		Put(mapper.GetAccountStoragePrefixKey(multiProofContract), []byte{0x01}).
+		Put(mapper.GetCodeKey(multiProofContract), makeValue(100))
+	for i := 0; i < 20; i++ {
+		trie = trie.Put(mapper.GetAccountStorageKey(multiProofContract, multiProofSlot(i)), []byte{byte(i + 1)})
+	}
+	return trie
+}
+
+// contractKeys returns the keys of the contract account, slots 0 to 19 and
+// the absent slot 99
+func contractKeys() [][]byte {
+	mapper := NewTrieKeyMapper()
+	keys := [][]byte{mapper.GetAccountKey(multiProofContract)}
+	for i := 0; i < 20; i++ {
+		keys = append(keys, mapper.GetAccountStorageKey(multiProofContract, multiProofSlot(i)))
+	}
+	return append(keys, mapper.GetAccountStorageKey(multiProofContract, multiProofSlot(99)))
+}
+
+func TestMultiProofRoundTrip(t *testing.T) {
+	trie := buildMultiProofTestTrie()
+	mapper := NewTrieKeyMapper()
+	verifier := NewProofVerifier()
+
+	accounts := [][]byte{mapper.GetAccountKey(common.HexToAddress("0x1234"))}
+	for i := 0; i < 40; i += 3 {
+		accounts = append(accounts, mapper.GetAccountKey(multiProofAccount(i)))
+	}
+
+	tests := []struct {
+		name string
+		keys [][]byte
+	}{
+		{"account and storage", contractKeys()},
+		{"many accounts", accounts},
+		{"single key", accounts[1:2]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proof, err := trie.GetMultiProof(tt.keys...)
+			if err != nil {
+				t.Fatalf("GetMultiProof failed: %v", err)
+			}
+			encoded, err := proof.Encode()
+			if err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			decoded, err := DecodeMultiProof(encoded)
+			if err != nil {
+				t.Fatalf("DecodeMultiProof failed: %v", err)
+			}
+
+			result, err := verifier.VerifyMultiProof(common.BytesToHash(trie.GetHash()), tt.keys, decoded)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !result.Valid {
+				t.Fatalf("Expected a valid proof, got %v", result.Error)
+			}
+			for i, key := range tt.keys {
+				proven := result.Keys[i]
+				if !bytes.Equal(proven.Key, key) {
+					t.Fatalf("Key %d: results out of order", i)
+				}
+				want := trie.Get(key)
+				if !bytes.Equal(proven.Value, want) || proven.Absent != (want == nil) {
+					t.Errorf("Key %d: got value %x absent=%v, want %x", i, proven.Value, proven.Absent, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMultiProofIsSmallerThanSeparateProofs(t *testing.T) {
+	trie := buildMultiProofTestTrie()
+	keys := contractKeys()
+
+	separate := 0
+	for _, key := range keys {
+		proof, err := trie.GetProof(key)
+		if err != nil {
+			t.Fatalf("GetProof failed: %v", err)
+		}
+		for _, node := range proof {
+			separate += len(node)
+		}
+	}
+
+	proof, _ := trie.GetMultiProof(keys...)
+	encoded, _ := proof.Encode()
+	if 3*len(encoded) > separate {
+		t.Errorf("Expected the multiproof to be under a third of %d bytes, got %d", separate, len(encoded))
+	}
+}
+
+func TestNewMultiProofCompactsProofs(t *testing.T) {
+	trie := buildMultiProofTestTrie()
+	keys := contractKeys()
+
+	var proofs [][][]byte
+	for _, key := range keys {
+		proof, err := trie.GetProof(key)
+		if err != nil {
+			t.Fatalf("GetProof failed: %v", err)
+		}
+		proofs = append(proofs, proof)
+	}
+
+	compacted, err := NewMultiProof(trie.GetHash(), proofs...)
+	if err != nil {
+		t.Fatalf("NewMultiProof failed: %v", err)
+	}
+	generated, _ := trie.GetMultiProof(keys...)
+	if !reflect.DeepEqual(compacted.Nodes, generated.Nodes) {
+		t.Errorf("Expected the compacted proofs to equal the generated multiproof: %d and %d nodes", len(compacted.Nodes), len(generated.Nodes))
+	}
+
+	if _, err := NewMultiProof(Keccak256([]byte("other")), proofs...); err == nil {
+		t.Error("Expected an error for a root that is not in the proofs")
+	}
+}
+
+func TestVerifyMultiProofRejectsBadProofs(t *testing.T) {
+	trie := buildMultiProofTestTrie()
+	stateRoot := common.BytesToHash(trie.GetHash())
+	verifier := NewProofVerifier()
+	keys := contractKeys()
+	proof, _ := trie.GetMultiProof(keys...)
+	other, _ := trie.GetMultiProof(NewTrieKeyMapper().GetAccountKey(multiProofAccount(7)))
+
+	withNodes := func(nodes ...[]byte) *MultiProof {
+		return &MultiProof{Nodes: nodes}
+	}
+	withExtra := func(node []byte) *MultiProof {
+		return withNodes(append(append([][]byte{}, proof.Nodes...), node)...)
+	}
+	tampered := append([]byte{}, proof.Nodes[len(proof.Nodes)-1]...)
+	tampered[len(tampered)-1] ^= 0x01
+
+	tests := []struct {
+		name      string
+		stateRoot common.Hash
+		keys      [][]byte
+		proof     *MultiProof
+	}{
+		{"empty proof", stateRoot, keys, withNodes()},
+		{"wrong state root", common.Hash{0x01}, keys, proof},
+		{"missing node", stateRoot, keys, withNodes(proof.Nodes[:len(proof.Nodes)-1]...)},
+		{"tampered node", stateRoot, keys, withNodes(append(proof.Nodes[:len(proof.Nodes)-1:len(proof.Nodes)-1], tampered)...)},
+		{"duplicate node", stateRoot, keys, withExtra(proof.Nodes[1])},
+		{"node of another key", stateRoot, keys, withExtra(other.Nodes[len(other.Nodes)-1])},
+		{"unused nodes", stateRoot, keys[:1], proof},
+		{"key not covered", stateRoot, append(append([][]byte{}, keys...), NewTrieKeyMapper().GetAccountKey(multiProofAccount(7))), proof},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := verifier.VerifyMultiProof(tt.stateRoot, tt.keys, tt.proof)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result.Valid || result.Error == nil {
+				t.Errorf("Expected an invalid result, got %+v", result)
+			}
+		})
+	}
+}
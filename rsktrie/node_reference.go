@@ -2,11 +2,16 @@ package rsktrie
 
 import (
 	"bytes"
+	"fmt"
 	"log"
+	"sync"
 )
 
 type NodeReference struct {
-	store    TrieStore
+	store TrieStore
+
+	// mu guards the node and hash, which are filled in on first access
+	mu       sync.Mutex
 	lazyNode *Trie
 	lazyHash []byte
 }
@@ -26,41 +31,104 @@ func NodeReferenceEmpty() *NodeReference {
 }
 
 func (n *NodeReference) IsEmpty() bool {
-	return n.lazyHash == nil && n.lazyNode == nil
+	node, hash := n.loaded()
+	return hash == nil && node == nil
+}
+
+// loaded returns the node and hash known so far, without computing or retrieving anything.
+func (n *NodeReference) loaded() (*Trie, []byte) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.lazyNode, n.lazyHash
+}
+
+// isHashOnly reports whether the reference only holds the hash of its node,
+// e.g. a child that was deserialized by hash and not retrieved yet.
+func (n *NodeReference) isHashOnly() bool {
+	node, hash := n.loaded()
+	return node == nil && hash != nil
 }
 
 // GetHash returns the hash. Calculates if missing.
 func (n *NodeReference) GetHash() []byte {
-	if n.lazyHash != nil {
-		return n.lazyHash
+	node, hash := n.loaded()
+	if hash != nil || node == nil {
+		return hash
 	}
 
-	if n.lazyNode == nil {
-		return nil
+	hash = node.GetHash()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.lazyHash == nil {
+		n.lazyHash = hash
 	}
-
-	n.lazyHash = n.lazyNode.GetHash()
 	return n.lazyHash
 }
 
+// MissingNodeError is returned when a referenced node is not available in the
+// trie store, e.g. a subtree that was left out of a partial trie.
+type MissingNodeError struct {
+	Hash []byte
+}
+
+func (e *MissingNodeError) Error() string {
+	return fmt.Sprintf("missing trie node %x", e.Hash)
+}
+
 // GetNode returns the node. Retrieves from store if missing.
 func (n *NodeReference) GetNode() *Trie {
-	if n.lazyNode != nil {
-		return n.lazyNode
+	node, err := n.TryGetNode()
+	if err != nil {
+		log.Printf("Broken database: %v", err)
+		return nil
 	}
+	return node
+}
 
-	if n.lazyHash == nil {
-		return nil
+// TryGetNode is like GetNode but returns a *MissingNodeError when the node
+// cannot be retrieved. An empty reference yields a nil node and no error.
+func (n *NodeReference) TryGetNode() (*Trie, error) {
+	node, hash := n.loaded()
+	if node != nil || hash == nil {
+		return node, nil
+	}
+
+	if n.store != nil {
+		node = n.store.Retrieve(hash)
+	}
+	if node == nil {
+		return nil, &MissingNodeError{Hash: hash}
 	}
 
-	n.lazyNode = n.store.Retrieve(n.lazyHash)
+	// Keep the first node loaded so that concurrent readers share its caches
+	n.mu.Lock()
+	defer n.mu.Unlock()
 	if n.lazyNode == nil {
-		log.Printf("Broken database: missing node for hash %x", n.lazyHash)
-		// panic("Broken database") // OR return nil
-		return nil
+		n.lazyNode = node
+	}
+	return n.lazyNode, nil
+}
+
+// save persists the referenced node if it is held in memory. Unless the node
+// is embedded in its parent, it is then released and only its hash is kept.
+func (n *NodeReference) save(store TrieStore) {
+	node, _ := n.loaded()
+	if node == nil {
+		// Empty, or only known by hash and thus already in a store
+		return
 	}
 
-	return n.lazyNode
+	node.save(store)
+	if node.IsEmbeddable() {
+		return
+	}
+
+	hash := node.GetHash()
+	n.mu.Lock()
+	n.lazyHash = hash
+	n.lazyNode = nil
+	n.mu.Unlock()
+	n.store = store
 }
 
 func (n *NodeReference) SerializeInto(buf *bytes.Buffer) {
@@ -79,15 +147,30 @@ func (n *NodeReference) SerializeInto(buf *bytes.Buffer) {
 	}
 }
 
+// serializedLength returns the number of bytes SerializeInto writes.
+func (n *NodeReference) serializedLength() int {
+	if n.IsEmpty() {
+		return 0
+	}
+	if n.IsEmbeddable() {
+		node, _ := n.loaded()
+		length := node.GetMessageLength()
+		return NewVarInt(uint64(length)).Size + length
+	}
+	return 32
+}
+
 func (n *NodeReference) GetSerialized() []byte {
-	return n.lazyNode.ToMessage()
+	node, _ := n.loaded()
+	return node.ToMessage()
 }
 
 func (n *NodeReference) IsEmbeddable() bool {
-	if n.lazyNode == nil {
+	node, _ := n.loaded()
+	if node == nil {
 		return false
 	}
-	return n.lazyNode.IsEmbeddable()
+	return node.IsEmbeddable()
 }
 
 func (n *NodeReference) ReferenceSize() int {
@@ -0,0 +1,49 @@
+package rsktrie
+
+import "sync"
+
+// DefaultParallelHashThreshold is a children size, in bytes, from which
+// GetHashParallel hashes the two subtrees of a node on separate goroutines.
+// Below it, starting a goroutine costs more than it saves.
+const DefaultParallelHashThreshold = 64 * 1024
+
+// GetHashParallel returns the same hash as GetHash, but the two subtrees of
+// every node whose children size is at least threshold bytes are hashed
+// concurrently. It pays off for large tries built or changed in memory, such
+// as the receipts trie of a big block; subtrees that are only referenced by
+// hash, or were hashed before, are not visited.
+func (t *Trie) GetHashParallel(threshold uint64) []byte {
+	t.hashSubtrees(threshold)
+	return t.GetHash()
+}
+
+// hashSubtrees fills the hash caches below the large nodes of an in-memory
+// trie, so that GetHash finds them ready.
+func (t *Trie) hashSubtrees(threshold uint64) {
+	t.mu.Lock()
+	hashed := t.hash != nil
+	t.mu.Unlock()
+	if hashed || t.IsTerminal() || t.GetChildrenSize().Value < threshold {
+		return
+	}
+
+	left, _ := t.left.loaded()
+	right, _ := t.right.loaded()
+	switch {
+	case left != nil && right != nil:
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			left.hashSubtrees(threshold)
+			left.GetHash()
+		}()
+		right.hashSubtrees(threshold)
+		right.GetHash()
+		wg.Wait()
+	case left != nil:
+		left.hashSubtrees(threshold)
+	case right != nil:
+		right.hashSubtrees(threshold)
+	}
+}
@@ -0,0 +1,70 @@
+package rsktrie
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGetHashParallelMatchesGetHash(t *testing.T) {
+	reference, _ := buildKeyedTestTrie(2000, 80)
+	expected := reference.GetHash()
+
+	for _, threshold := range []uint64{0, 1024, DefaultParallelHashThreshold, 1 << 40} {
+		trie, _ := buildKeyedTestTrie(2000, 80)
+		if hash := trie.GetHashParallel(threshold); !bytes.Equal(hash, expected) {
+			t.Errorf("Threshold %d: hash mismatch. Got %x, want %x", threshold, hash, expected)
+		}
+		// The result is cached like a GetHash result
+		if !bytes.Equal(trie.GetHash(), expected) {
+			t.Errorf("Threshold %d: cached hash mismatch", threshold)
+		}
+	}
+}
+
+func TestGetHashParallelAfterUpdate(t *testing.T) {
+	trie, _ := buildKeyedTestTrie(2000, 80)
+	trie.GetHashParallel(0)
+
+	updated := trie.Put([]byte("key1000"), makeValue(100)).Delete([]byte("key7"))
+	expected := updated.GetHash()
+
+	again := trie.Put([]byte("key1000"), makeValue(100)).Delete([]byte("key7"))
+	if hash := again.GetHashParallel(0); !bytes.Equal(hash, expected) {
+		t.Errorf("Hash mismatch after update. Got %x, want %x", hash, expected)
+	}
+}
+
+func TestGetHashParallelDoesNotLoadStoredSubtrees(t *testing.T) {
+	built, _ := buildKeyedTestTrie(2000, 80)
+	store := &countingTrieStore{MemTrieStore: NewMemTrieStore()}
+	built.Save(store)
+
+	root, err := FromMessage(built.ToMessage(), store)
+	if err != nil {
+		t.Fatalf("FromMessage failed: %v", err)
+	}
+	if hash := root.GetHashParallel(0); !bytes.Equal(hash, built.GetHash()) {
+		t.Errorf("Hash mismatch. Got %x, want %x", hash, built.GetHash())
+	}
+	if store.retrieved != 0 {
+		t.Errorf("Expected no nodes to be loaded, got %d", store.retrieved)
+	}
+}
+
+func BenchmarkGetHash(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		trie, _ := buildKeyedTestTrie(2000, 80)
+		b.StartTimer()
+		trie.GetHash()
+	}
+}
+
+func BenchmarkGetHashParallel(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		trie, _ := buildKeyedTestTrie(2000, 80)
+		b.StartTimer()
+		trie.GetHashParallel(DefaultParallelHashThreshold / 16)
+	}
+}
@@ -0,0 +1,44 @@
+package rsktrie
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// NewPartialTrie builds a trie with the given root from one or more proofs
+// (RLP-wrapped serialized nodes, as returned by eth_getProof or GetProof).
+// Proofs for the same root can be mixed in any order.
+//
+// Subtrees that no proof covers stay hash-only references. Get, Put and Delete
+// work for covered keys and the root hash can be recomputed after updates;
+// use TryGet, TryPut and TryDelete to get a *MissingNodeError instead of a
+// wrong result when a key needs an uncovered subtree.
+func NewPartialTrie(rootHash []byte, proofs ...[][]byte) (*Trie, error) {
+	store := NewMemTrieStore()
+	for i, proof := range proofs {
+		if err := AddProofNodes(store, proof); err != nil {
+			return nil, fmt.Errorf("proof %d: %w", i, err)
+		}
+	}
+	return NewTrieFromStore(store, rootHash)
+}
+
+// AddProofNodes decodes RLP-wrapped proof nodes into store. Nodes are decoded
+// with FromMessageStrict, so each one serializes back to the bytes it was
+// decoded from and is stored under the hash its parent references.
+func AddProofNodes(store *MemTrieStore, proof [][]byte) error {
+	for i, rlpNode := range proof {
+		var serialized []byte
+		if err := rlp.DecodeBytes(rlpNode, &serialized); err != nil {
+			return fmt.Errorf("RLP decode proof node %d: %w", i, err)
+		}
+
+		node, err := FromMessageStrict(serialized, store)
+		if err != nil {
+			return fmt.Errorf("parse proof node %d: %w", i, err)
+		}
+		store.Save(node)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package rsktrie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func proofsFor(t *testing.T, trie *Trie, keys ...string) [][][]byte {
+	t.Helper()
+	var proofs [][][]byte
+	for _, key := range keys {
+		proof, err := trie.GetProof([]byte(key))
+		if err != nil {
+			t.Fatalf("GetProof failed: %v", err)
+		}
+		proofs = append(proofs, proof)
+	}
+	return proofs
+}
+
+func TestPartialTrieGetCoveredKeys(t *testing.T) {
+	full, values := buildKeyedTestTrie(200, 30)
+	covered := []string{"key3", "key42", "key150", "key199"}
+
+	partial, err := NewPartialTrie(full.GetHash(), proofsFor(t, full, covered...)...)
+	if err != nil {
+		t.Fatalf("NewPartialTrie failed: %v", err)
+	}
+	if !bytes.Equal(partial.GetHash(), full.GetHash()) {
+		t.Fatalf("Root hash mismatch")
+	}
+
+	for _, key := range covered {
+		got, err := partial.TryGet([]byte(key))
+		if err != nil {
+			t.Fatalf("TryGet(%s) failed: %v", key, err)
+		}
+		if !bytes.Equal(got, values[key]) {
+			t.Errorf("TryGet(%s): got %x, want %x", key, got, values[key])
+		}
+	}
+
+	_, err = partial.TryGet([]byte("key77"))
+	var missing *MissingNodeError
+	if !errors.As(err, &missing) {
+		t.Errorf("Expected a MissingNodeError for an uncovered key, got %v", err)
+	}
+	if _, err := partial.TryPut([]byte("key77"), []byte("x")); !errors.As(err, &missing) {
+		t.Errorf("Expected TryPut on an uncovered key to fail, got %v", err)
+	}
+}
+
+func TestPartialTrieUpdatesMatchFullTrie(t *testing.T) {
+	full, _ := buildKeyedTestTrie(200, 30)
+	rng := rand.New(rand.NewSource(11))
+
+	// Keys to update, including absent ones covered by exclusion proofs
+	var keys []string
+	for i := 0; i < 40; i++ {
+		keys = append(keys, fmt.Sprintf("key%d", rng.Intn(260)))
+	}
+	partial, err := NewPartialTrie(full.GetHash(), proofsFor(t, full, keys...)...)
+	if err != nil {
+		t.Fatalf("NewPartialTrie failed: %v", err)
+	}
+
+	applied := 0
+	for i := 0; i < 200; i++ {
+		key := []byte(keys[rng.Intn(len(keys))])
+		var value []byte
+		if rng.Intn(3) > 0 {
+			value = append(makeValue(rng.Intn(60)+1), byte(i))
+		}
+
+		updated, err := partial.TryPut(key, value)
+		if err != nil {
+			// Deletes may need a sibling that no proof covers
+			var missing *MissingNodeError
+			if !errors.As(err, &missing) || value != nil {
+				t.Fatalf("TryPut(%s) failed: %v", key, err)
+			}
+			continue
+		}
+		partial = updated
+		full = full.Put(key, value)
+		applied++
+
+		if !bytes.Equal(partial.GetHash(), full.GetHash()) {
+			t.Fatalf("Root hash mismatch after update %d of %s", i, key)
+		}
+	}
+	if applied < 100 {
+		t.Errorf("Expected most updates to apply, applied %d", applied)
+	}
+}
+
+func TestPartialTrieDeleteWithCoveredSibling(t *testing.T) {
+	sibling := "key2 with a key long enough for its node not to be embedded"
+	full := NewTrie(nil).Put([]byte("key1"), []byte("one")).Put([]byte(sibling), []byte("two")).Put([]byte("other"), []byte("x"))
+
+	// Only key1 is covered; deleting it merges its parent with the sibling
+	// node, which is referenced by hash and thus missing
+	partial, err := NewPartialTrie(full.GetHash(), proofsFor(t, full, "key1")...)
+	if err != nil {
+		t.Fatalf("NewPartialTrie failed: %v", err)
+	}
+	var missing *MissingNodeError
+	if _, err := partial.TryDelete([]byte("key1")); !errors.As(err, &missing) {
+		t.Fatalf("Expected a MissingNodeError, got %v", err)
+	}
+
+	partial, err = NewPartialTrie(full.GetHash(), proofsFor(t, full, "key1", sibling)...)
+	if err != nil {
+		t.Fatalf("NewPartialTrie failed: %v", err)
+	}
+	updated, err := partial.TryDelete([]byte("key1"))
+	if err != nil {
+		t.Fatalf("TryDelete failed: %v", err)
+	}
+	if !bytes.Equal(updated.GetHash(), full.Delete([]byte("key1")).GetHash()) {
+		t.Error("Root hash mismatch after delete")
+	}
+}
+
+func TestPartialTrieRejectsBadProofNode(t *testing.T) {
+	full, _ := buildKeyedTestTrie(200, 30)
+	proof := proofsFor(t, full, "key1")[0]
+
+	if _, err := NewPartialTrie(full.GetHash(), [][]byte{{0xc0}}); err == nil {
+		t.Error("Expected an error for a non-bytes RLP node")
+	}
+	if _, err := NewPartialTrie(Keccak256([]byte("other")), proof); err == nil {
+		t.Error("Expected an error for a root that is not in the proofs")
+	}
+
+	// A leaf with its shared path length needlessly encoded as a VarInt
+	nonCanonical, _ := rlp.EncodeToBytes([]byte{0x50, 0xff, 0x08, 0x01, 0x2a})
+	if err := AddProofNodes(NewMemTrieStore(), [][]byte{nonCanonical}); !errors.Is(err, ErrMalformedNode) {
+		t.Errorf("Expected ErrMalformedNode for a non-canonical node, got %v", err)
+	}
+}
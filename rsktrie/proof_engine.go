@@ -0,0 +1,198 @@
+package rsktrie
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// ProofStep records one node of a proof walk: the hash the node was checked
+// against, the key bits matched against its shared path and the bit that
+// selected the next node.
+type ProofStep struct {
+	// Hash is the hash of the node: the root hash for the first step, else
+	// the hash its parent references.
+	Hash common.Hash
+	// Embedded tells that the node was read from its parent's message rather
+	// than from the proof nodes.
+	Embedded bool
+	// KeyBit is the position, in key bits, where the node's shared path starts
+	KeyBit int
+	// SharedPathBits is the number of shared path bits that matched the key
+	SharedPathBits int
+	// HasValue tells that the node holds a value
+	HasValue bool
+	// ChildBit is the position of the key bit that selected a child of the
+	// node, or -1 if the key ends at the node or within its shared path. The
+	// child is the next step, unless it is empty and the key absent.
+	ChildBit int
+	// Child is the value of that bit: 0 for the left child, 1 for the right one
+	Child byte
+}
+
+// ProofWalk is the outcome of walking a key through a proof
+type ProofWalk struct {
+	// Node is the node holding the value of the key; nil when the key is absent.
+	// Long values are not part of proofs, so only their hash and length are known.
+	Node      *Trie
+	Exclusion *ExclusionProof // How the path ends when the key is absent
+	Trace     []ProofStep     // The nodes visited from the root on
+}
+
+// Value returns the proven value of the key: nil when the key is absent, or
+// when its value is long and thus not part of the proof.
+func (w *ProofWalk) Value() []byte {
+	if w.Node == nil {
+		return nil
+	}
+	return w.Node.GetValue()
+}
+
+// WalkProof verifies the proof of key against rootHash and returns where the
+// key leads: to the node holding its value, or to an ExclusionProof.
+//
+// proofNodes are RLP-wrapped serialized nodes, as returned by GetProof and
+// eth_getProof, in any order. Every node must be on the path of the key, so
+// that nothing in the proof escapes the root hash commitment. Embedded nodes
+// may be listed, as RSKj does, or left to be read from their parent.
+//
+// On an error the returned walk holds the trace up to the failure, which is
+// empty if the proof nodes could not be decoded.
+func WalkProof(rootHash []byte, key []byte, proofNodes [][]byte) (*ProofWalk, error) {
+	if len(proofNodes) == 0 {
+		return &ProofWalk{}, fmt.Errorf("empty proof")
+	}
+
+	// RSK proof nodes are RLP-encoded. The hash is Keccak256 of the serialized (not RLP) content.
+	nodes := make(proofNodeSet)
+	for i, rlpNode := range proofNodes {
+		// RLP decode to get serialized node
+		var serializedNode []byte
+		if err := rlp.DecodeBytes(rlpNode, &serializedNode); err != nil {
+			return &ProofWalk{}, fmt.Errorf("failed to RLP decode proof node %d: %w", i, err)
+		}
+		if err := nodes.add(i, serializedNode); err != nil {
+			return &ProofWalk{}, err
+		}
+	}
+
+	used := make(map[string]bool)
+	walk, err := nodes.walk(rootHash, key, used)
+	if err != nil {
+		return walk, err
+	}
+
+	// Proof nodes that are not on the path are not covered by the root hash
+	// commitment for this key, so they are rejected rather than ignored.
+	if len(used) != len(nodes) {
+		return walk, fmt.Errorf("proof contains %d nodes not on the path of key %x", len(nodes)-len(used), key)
+	}
+	return walk, nil
+}
+
+// proofNodeSet holds decoded proof nodes by the hash of their serialization
+type proofNodeSet map[string]*Trie
+
+// add decodes the i-th proof node, which must not be in the set yet
+func (s proofNodeSet) add(i int, serializedNode []byte) error {
+	nodeHash := Keccak256(serializedNode)
+	if _, ok := s[string(nodeHash)]; ok {
+		return fmt.Errorf("duplicate proof node %d with hash %x", i, nodeHash)
+	}
+
+	node, err := FromMessageStrict(serializedNode, nil)
+	if err != nil {
+		return fmt.Errorf("failed to parse proof node %d: %w", i, err)
+	}
+	s[string(nodeHash)] = node
+	return nil
+}
+
+// walk follows key down from the node with hash rootHash, recording each node
+// in the trace of the returned walk. The hashes of the visited proof nodes are
+// added to used. Children embedded in their parent that are not in the set are
+// read from the parent's message, which binds them to the root as well.
+func (s proofNodeSet) walk(rootHash []byte, key []byte, used map[string]bool) (*ProofWalk, error) {
+	walk := &ProofWalk{}
+
+	// Convert key to bit representation for traversal
+	keySlice := TrieKeySliceFromKey(key)
+
+	// Find the root node (should match rootHash)
+	currentNode, ok := s[string(rootHash)]
+	if !ok {
+		return walk, fmt.Errorf("root hash %x not found in proof nodes", rootHash)
+	}
+	used[string(rootHash)] = true
+	walk.Trace = append(walk.Trace, ProofStep{Hash: common.BytesToHash(rootHash), ChildBit: -1})
+
+	exclude := func(reason ExclusionReason, bit int) (*ProofWalk, error) {
+		walk.Exclusion = &ExclusionProof{
+			Reason:          reason,
+			DivergenceBit:   bit,
+			TerminatingNode: walk.Trace[len(walk.Trace)-1].Hash,
+		}
+		return walk, nil
+	}
+
+	// Walk the path
+	keyPos := 0
+	for {
+		step := &walk.Trace[len(walk.Trace)-1]
+		step.KeyBit = keyPos
+		step.HasValue = currentNode.valueLength > 0
+
+		// Check shared path
+		sharedPath := currentNode.sharedPath
+		remaining := keySlice.Length() - keyPos
+		for i := 0; i < sharedPath.Length(); i++ {
+			if i == remaining {
+				// Key ends inside the path - value doesn't exist
+				return exclude(ExclusionKeyEndsInSharedPath, keyPos+i)
+			}
+			if keySlice.Get(keyPos+i) != sharedPath.Get(i) {
+				// Key diverges from path - value doesn't exist
+				return exclude(ExclusionSharedPathDivergence, keyPos+i)
+			}
+			step.SharedPathBits++
+		}
+		keyPos += sharedPath.Length()
+
+		// Check if we've consumed the entire key
+		if keyPos >= keySlice.Length() {
+			if currentNode.valueLength == 0 {
+				return exclude(ExclusionNoValue, keyPos)
+			}
+			walk.Node = currentNode
+			return walk, nil
+		}
+
+		// Get next bit and follow child
+		nextBit := keySlice.Get(keyPos)
+		step.ChildBit, step.Child = keyPos, nextBit
+		keyPos++
+
+		childRef := currentNode.childRef(nextBit)
+		if childRef.IsEmpty() {
+			// No child - value doesn't exist
+			return exclude(ExclusionEmptyChild, keyPos-1)
+		}
+
+		// Look up child in proof nodes
+		childHash := childRef.GetHash()
+		next := ProofStep{Hash: common.BytesToHash(childHash), ChildBit: -1}
+		if childNode, ok := s[string(childHash)]; ok {
+			used[string(childHash)] = true
+			currentNode = childNode
+		} else if childRef.IsEmbeddable() {
+			// An embedded node is part of its parent's message, e.g. the code
+			// node below the last node of an account proof
+			next.Embedded = true
+			currentNode = childRef.GetNode()
+		} else {
+			return walk, fmt.Errorf("missing proof node for hash %x", childHash)
+		}
+		walk.Trace = append(walk.Trace, next)
+	}
+}
@@ -0,0 +1,74 @@
+package rsktrie
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// GetProof returns the Merkle proof for key in the format returned by RSKj's
+// eth_getProof (PR-1519): every node on the path, RLP-wrapped around its
+// serialized message, ordered leaf-to-root (the last node is this trie's root).
+//
+// For keys that are not in the trie the proof ends at the node where the key
+// diverges from the shared path or reaches an empty child, which proves its
+// absence.
+func (t *Trie) GetProof(key []byte) ([][]byte, error) {
+	nodes, err := t.GetNodes(key)
+	if err != nil {
+		return nil, err
+	}
+
+	proof := make([][]byte, len(nodes))
+	for i, node := range nodes {
+		encoded, err := rlp.EncodeToBytes(node.ToMessage())
+		if err != nil {
+			return nil, fmt.Errorf("RLP encode proof node %d: %w", i, err)
+		}
+		proof[i] = encoded
+	}
+	return proof, nil
+}
+
+// GetNodes returns the nodes on the path to key, ordered leaf-to-root.
+// Embedded nodes are included, as RSKj does.
+func (t *Trie) GetNodes(key []byte) ([]*Trie, error) {
+	var path []*Trie
+	node := t
+	keySlice := TrieKeySliceFromKey(key)
+
+	for {
+		path = append(path, node)
+
+		sharedPath := node.sharedPath
+		if sharedPath.Length() > keySlice.Length() {
+			break
+		}
+		common := keySlice.CommonPath(sharedPath)
+		if common.Length() < sharedPath.Length() || common.Length() == keySlice.Length() {
+			break
+		}
+
+		implicitByte := keySlice.Get(common.Length())
+		childRef := node.left
+		if implicitByte == 1 {
+			childRef = node.right
+		}
+		if childRef.IsEmpty() {
+			break
+		}
+
+		child, err := childRef.TryGetNode()
+		if err != nil {
+			return nil, fmt.Errorf("path to key %x: %w", key, err)
+		}
+		node = child
+		keySlice = keySlice.Slice(common.Length()+1, keySlice.Length())
+	}
+
+	// Leaf-to-root order
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path, nil
+}
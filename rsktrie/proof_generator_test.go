@@ -0,0 +1,115 @@
+package rsktrie
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func TestGetProofIsOrderedLeafToRoot(t *testing.T) {
+	trie, _ := buildKeyedTestTrie(100, 32)
+
+	proof, err := trie.GetProof([]byte("key42"))
+	if err != nil {
+		t.Fatalf("GetProof failed: %v", err)
+	}
+	if len(proof) < 2 {
+		t.Fatalf("Expected several proof nodes, got %d", len(proof))
+	}
+
+	var root []byte
+	if err := rlp.DecodeBytes(proof[len(proof)-1], &root); err != nil {
+		t.Fatalf("RLP decode failed: %v", err)
+	}
+	if !bytes.Equal(Keccak256(root), trie.GetHash()) {
+		t.Error("Expected last proof node to be the root")
+	}
+
+	var leaf []byte
+	if err := rlp.DecodeBytes(proof[0], &leaf); err != nil {
+		t.Fatalf("RLP decode failed: %v", err)
+	}
+	leafNode, err := FromMessage(leaf, nil)
+	if err != nil {
+		t.Fatalf("FromMessage failed: %v", err)
+	}
+	if !bytes.Equal(leafNode.GetValue(), makeValue(42%32+1)) {
+		t.Error("Expected first proof node to hold the value")
+	}
+}
+
+func TestGetProofRoundTripsThroughVerifier(t *testing.T) {
+	trie, _ := buildKeyedTestTrie(100, 32)
+	verifier := NewProofVerifier()
+	root := common.BytesToHash(trie.GetHash())
+
+	for k := 0; k < 100; k++ {
+		key := []byte(fmt.Sprintf("key%d", k))
+		proof, err := trie.GetProof(key)
+		if err != nil {
+			t.Fatalf("GetProof failed: %v", err)
+		}
+
+		ok, err := verifier.VerifyProofValue(root, key, makeValue(k%32+1), proof)
+		if err != nil {
+			t.Fatalf("Verification failed for %s: %v", key, err)
+		}
+		if !ok {
+			t.Errorf("Value mismatch for %s", key)
+		}
+	}
+}
+
+func TestGetProofForMissingKey(t *testing.T) {
+	trie, _ := buildKeyedTestTrie(100, 32)
+	verifier := NewProofVerifier()
+
+	for _, key := range [][]byte{[]byte("key100"), []byte("kez1"), []byte("aaaa")} {
+		proof, err := trie.GetProof(key)
+		if err != nil {
+			t.Fatalf("GetProof failed: %v", err)
+		}
+
+		value, exclusion, err := verifier.verifyProof(trie.GetHash(), key, proof)
+		if err != nil {
+			t.Fatalf("Verification failed for %s: %v", key, err)
+		}
+		if value != nil || exclusion == nil {
+			t.Errorf("Expected %s to be proven absent, got value %x", key, value)
+		}
+	}
+}
+
+func TestGetProofForAccountKey(t *testing.T) {
+	mapper := NewTrieKeyMapper()
+	addresses := []common.Address{
+		common.HexToAddress("0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"),
+		common.HexToAddress("0x77045E71a7A2c50903d88e564cD72fab11e82051"),
+		common.HexToAddress("0x0000000000000000000000000000000001000008"),
+	}
+
+	trie := NewTrie(NewMemTrieStore())
+	for i, addr := range addresses {
+		trie = trie.Put(mapper.GetAccountKey(addr), []byte{byte(i + 1)})
+	}
+	trie = trie.Put(mapper.GetAccountStorageKey(addresses[1], common.Hash{}), []byte{0x2a})
+
+	verifier := NewProofVerifier()
+	root := common.BytesToHash(trie.GetHash())
+	for i, addr := range addresses {
+		proof, err := trie.GetProof(mapper.GetAccountKey(addr))
+		if err != nil {
+			t.Fatalf("GetProof failed: %v", err)
+		}
+		result, err := verifier.VerifyAccountProof(root, addr, proof)
+		if err != nil || !result.Valid {
+			t.Fatalf("Account proof invalid for %s: %v %v", addr.Hex(), err, result.Error)
+		}
+		if !bytes.Equal(result.Value, []byte{byte(i + 1)}) {
+			t.Errorf("Account value mismatch for %s", addr.Hex())
+		}
+	}
+}
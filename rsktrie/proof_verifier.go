@@ -5,7 +5,6 @@ import (
 	"fmt"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/rlp"
 )
 
 // ProofVerifier verifies Merkle proofs from eth_getProof for RSK's binary trie
@@ -22,18 +21,62 @@ func NewProofVerifier() *ProofVerifier {
 
 // AccountProofResult contains the result of account proof verification
 type AccountProofResult struct {
-	Valid   bool
-	Address common.Address
-	Value   []byte // RLP-encoded account state
-	Error   error
+	Valid     bool            // Whether the proof is valid
+	Address   common.Address  // The verified address
+	Value     []byte          // RLP-encoded account state
+	Absent    bool            // Whether the proof shows that the account does not exist
+	Exclusion *ExclusionProof // How the path ends when Absent is set
+	Trace     []ProofStep     // The nodes checked, up to a failure if any
+	Error     error           // Error if verification failed
 }
 
 // StorageProofResult contains the result of storage proof verification
 type StorageProofResult struct {
-	Valid      bool
-	StorageKey common.Hash
-	Value      []byte
-	Error      error
+	Valid      bool            // Whether the proof is valid
+	StorageKey common.Hash     // The verified storage key
+	Value      []byte          // The storage value
+	Absent     bool            // Whether the proof shows that the slot is not stored
+	Exclusion  *ExclusionProof // How the path ends when Absent is set
+	Trace      []ProofStep     // The nodes checked, up to a failure if any
+	Error      error           // Error if verification failed
+}
+
+// ExclusionReason tells how a proof path ends for a key that is not in the trie
+type ExclusionReason int
+
+const (
+	// ExclusionSharedPathDivergence means the key differs from a node's shared path
+	ExclusionSharedPathDivergence ExclusionReason = iota + 1
+	// ExclusionKeyEndsInSharedPath means the key ends inside a node's shared path
+	ExclusionKeyEndsInSharedPath
+	// ExclusionEmptyChild means the next key bit leads to an empty child
+	ExclusionEmptyChild
+	// ExclusionNoValue means the key ends at a node without a value
+	ExclusionNoValue
+)
+
+func (r ExclusionReason) String() string {
+	switch r {
+	case ExclusionSharedPathDivergence:
+		return "shared path divergence"
+	case ExclusionKeyEndsInSharedPath:
+		return "key ends in shared path"
+	case ExclusionEmptyChild:
+		return "empty child"
+	case ExclusionNoValue:
+		return "node has no value"
+	default:
+		return fmt.Sprintf("ExclusionReason(%d)", int(r))
+	}
+}
+
+// ExclusionProof describes how a proof shows that a key is not in the trie
+type ExclusionProof struct {
+	Reason ExclusionReason
+	// DivergenceBit is the position, in key bits, where the key leaves the trie
+	DivergenceBit int
+	// TerminatingNode is the hash of the last node on the key's path
+	TerminatingNode common.Hash
 }
 
 // VerifyAccountProof verifies an account proof against a state root
@@ -48,19 +91,23 @@ func (v *ProofVerifier) VerifyAccountProof(
 	trieKey := v.keyMapper.GetAccountKey(address)
 
 	// Verify the proof path
-	value, err := v.verifyProof(stateRoot[:], trieKey, proofNodes)
+	walk, err := WalkProof(stateRoot[:], trieKey, proofNodes)
 	if err != nil {
 		return &AccountProofResult{
 			Valid:   false,
 			Address: address,
+			Trace:   walk.Trace,
 			Error:   err,
 		}, nil
 	}
 
 	return &AccountProofResult{
-		Valid:   true,
-		Address: address,
-		Value:   value,
+		Valid:     true,
+		Address:   address,
+		Value:     walk.Value(),
+		Absent:    walk.Exclusion != nil,
+		Exclusion: walk.Exclusion,
+		Trace:     walk.Trace,
 	}, nil
 }
 
@@ -78,11 +125,12 @@ func (v *ProofVerifier) VerifyStorageProof(
 	trieKey := v.keyMapper.GetAccountStorageKey(address, storageKey)
 
 	// Verify the proof path
-	value, err := v.verifyProof(stateRoot[:], trieKey, proofNodes)
+	walk, err := WalkProof(stateRoot[:], trieKey, proofNodes)
 	if err != nil {
 		return &StorageProofResult{
 			Valid:      false,
 			StorageKey: storageKey,
+			Trace:      walk.Trace,
 			Error:      err,
 		}, nil
 	}
@@ -90,119 +138,38 @@ func (v *ProofVerifier) VerifyStorageProof(
 	return &StorageProofResult{
 		Valid:      true,
 		StorageKey: storageKey,
-		Value:      value,
+		Value:      walk.Value(),
+		Absent:     walk.Exclusion != nil,
+		Exclusion:  walk.Exclusion,
+		Trace:      walk.Trace,
 	}, nil
 }
 
-// verifyProof walks through the proof nodes and verifies the path
-func (v *ProofVerifier) verifyProof(expectedHash []byte, key []byte, proofNodes [][]byte) ([]byte, error) {
-	if len(proofNodes) == 0 {
-		return nil, fmt.Errorf("empty proof")
-	}
-
-	// RSK proof nodes are RLP-encoded. The hash is Keccak256 of the serialized (not RLP) content.
-	// Proof order is leaf-to-root (last node is root).
-	// Build map using hash of the RLP-decoded (serialized) content
-
-	type nodeEntry struct {
-		node           *Trie
-		serializedHash []byte
+// VerifyStorageValue verifies a storage proof and checks the expected value
+func (v *ProofVerifier) VerifyStorageValue(
+	stateRoot common.Hash,
+	address common.Address,
+	storageKey common.Hash,
+	expectedValue []byte,
+	proofNodes [][]byte,
+) (bool, error) {
+	result, err := v.VerifyStorageProof(stateRoot, address, storageKey, proofNodes)
+	if err != nil {
+		return false, err
 	}
-	nodeMap := make(map[string]nodeEntry)
-
-	for i, rlpNode := range proofNodes {
-		// RLP decode to get serialized node
-		var serializedNode []byte
-		if err := rlp.DecodeBytes(rlpNode, &serializedNode); err != nil {
-			return nil, fmt.Errorf("failed to RLP decode proof node %d: %w", i, err)
-		}
-
-		// Hash of serialized content
-		nodeHash := Keccak256(serializedNode)
-
-		// Parse the node
-		node, err := FromMessage(serializedNode, nil)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse proof node %d: %w", i, err)
-		}
-
-		nodeMap[string(nodeHash)] = nodeEntry{node: node, serializedHash: nodeHash}
+	if !result.Valid {
+		return false, result.Error
 	}
+	return bytes.Equal(result.Value, expectedValue), nil
+}
 
-	// Convert key to bit representation for traversal
-	keySlice := TrieKeySliceFromKey(key)
-
-	// Find the root node (should match expectedHash)
-	rootEntry, ok := nodeMap[string(expectedHash)]
-	if !ok {
-		return nil, fmt.Errorf("root hash %x not found in proof nodes", expectedHash)
-	}
-	currentNode := rootEntry.node
-
-	// Walk the path
-	keyPos := 0
-	for {
-		// Check shared path
-		sharedPath := currentNode.sharedPath
-		if sharedPath.Length() > 0 {
-			// Verify shared path matches
-			remaining := keySlice.Length() - keyPos
-			if remaining < sharedPath.Length() {
-				return nil, fmt.Errorf("key too short for shared path at position %d", keyPos)
-			}
-
-			for i := 0; i < sharedPath.Length(); i++ {
-				keyBit := keySlice.Get(keyPos + i)
-				pathBit := sharedPath.Get(i)
-				if keyBit != pathBit {
-					// Key diverges from path - value doesn't exist
-					return nil, nil
-				}
-			}
-			keyPos += sharedPath.Length()
-		}
-
-		// Check if we've consumed the entire key
-		if keyPos >= keySlice.Length() {
-			// Found the node - return its value
-			return currentNode.GetValue(), nil
-		}
-
-		// Get next bit and follow child
-		nextBit := keySlice.Get(keyPos)
-		keyPos++
-
-		var childRef *NodeReference
-		if nextBit == 0 {
-			childRef = currentNode.left
-		} else {
-			childRef = currentNode.right
-		}
-
-		if childRef.IsEmpty() {
-			// No child - value doesn't exist
-			return nil, nil
-		}
-
-		// Get child hash
-		childHash := childRef.GetHash()
-		if childHash == nil {
-			// Embedded node - get directly
-			childNode := childRef.GetNode()
-			if childNode == nil {
-				return nil, fmt.Errorf("missing embedded child node")
-			}
-			currentNode = childNode
-			continue
-		}
-
-		// Look up child in proof nodes
-		childEntry, ok := nodeMap[string(childHash)]
-		if !ok {
-			return nil, fmt.Errorf("missing proof node for hash %x", childHash)
-		}
-		currentNode = childEntry.node
+// verifyProof returns the value of key, or an ExclusionProof if it is absent
+func (v *ProofVerifier) verifyProof(expectedHash []byte, key []byte, proofNodes [][]byte) ([]byte, *ExclusionProof, error) {
+	walk, err := WalkProof(expectedHash, key, proofNodes)
+	if err != nil {
+		return nil, nil, err
 	}
+	return walk.Value(), walk.Exclusion, nil
 }
 
 // VerifyProofValue is a convenience function that verifies a proof and checks the expected value
@@ -213,7 +180,7 @@ func (v *ProofVerifier) VerifyProofValue(
 	proofNodes [][]byte,
 ) (bool, error) {
 
-	value, err := v.verifyProof(stateRoot[:], key, proofNodes)
+	value, _, err := v.verifyProof(stateRoot[:], key, proofNodes)
 	if err != nil {
 		return false, err
 	}
@@ -0,0 +1,185 @@
+package rsktrie
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func TestVerifyProofExclusionReasons(t *testing.T) {
+	tests := []struct {
+		name   string
+		keys   []string
+		key    string
+		reason ExclusionReason
+		bit    int
+	}{
+		{"shared path divergence", []string{"key1", "key2"}, "kex1", ExclusionSharedPathDivergence, 23},
+		{"key ends in shared path", []string{"key1", "key2"}, "key", ExclusionKeyEndsInSharedPath, 24},
+		{"empty child", []string{"a", "a\x00"}, "a\x80", ExclusionEmptyChild, 8},
+		{"no value", []string{"a\x00", "a\x80"}, "a", ExclusionNoValue, 8},
+	}
+
+	verifier := NewProofVerifier()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trie := NewTrie(NewMemTrieStore())
+			for _, k := range tt.keys {
+				trie = trie.Put([]byte(k), []byte("value"))
+			}
+
+			proof, err := trie.GetProof([]byte(tt.key))
+			if err != nil {
+				t.Fatalf("GetProof failed: %v", err)
+			}
+			value, exclusion, err := verifier.verifyProof(trie.GetHash(), []byte(tt.key), proof)
+			if err != nil {
+				t.Fatalf("verifyProof failed: %v", err)
+			}
+			if value != nil {
+				t.Fatalf("Expected no value, got %x", value)
+			}
+			if exclusion == nil {
+				t.Fatal("Expected an exclusion proof")
+			}
+			if exclusion.Reason != tt.reason {
+				t.Errorf("Reason: got %v, want %v", exclusion.Reason, tt.reason)
+			}
+			if exclusion.DivergenceBit != tt.bit {
+				t.Errorf("DivergenceBit: got %d, want %d", exclusion.DivergenceBit, tt.bit)
+			}
+
+			var leaf []byte
+			if err := rlp.DecodeBytes(proof[0], &leaf); err != nil {
+				t.Fatalf("RLP decode failed: %v", err)
+			}
+			if exclusion.TerminatingNode != common.BytesToHash(Keccak256(leaf)) {
+				t.Errorf("TerminatingNode: got %x, want first proof node", exclusion.TerminatingNode)
+			}
+		})
+	}
+}
+
+func TestVerifyAccountProofReportsAbsentAccount(t *testing.T) {
+	mapper := NewTrieKeyMapper()
+	present := common.HexToAddress("0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826")
+	missing := common.HexToAddress("0x77045E71a7A2c50903d88e564cD72fab11e82051")
+
+	trie := NewTrie(NewMemTrieStore()).
+		Put(mapper.GetAccountKey(present), []byte{0x01}).
+		Put(mapper.GetAccountKey(common.HexToAddress("0x0000000000000000000000000000000001000008")), []byte{0x02})
+	root := common.BytesToHash(trie.GetHash())
+	verifier := NewProofVerifier()
+
+	proof, _ := trie.GetProof(mapper.GetAccountKey(missing))
+	result, err := verifier.VerifyAccountProof(root, missing, proof)
+	if err != nil || !result.Valid {
+		t.Fatalf("Expected valid exclusion proof: %v %v", err, result.Error)
+	}
+	if !result.Absent || result.Exclusion == nil || result.Value != nil {
+		t.Errorf("Expected account to be proven absent, got %+v", result)
+	}
+
+	proof, _ = trie.GetProof(mapper.GetAccountKey(present))
+	result, err = verifier.VerifyAccountProof(root, present, proof)
+	if err != nil || !result.Valid {
+		t.Fatalf("Expected valid inclusion proof: %v %v", err, result.Error)
+	}
+	if result.Absent || result.Exclusion != nil || !bytes.Equal(result.Value, []byte{0x01}) {
+		t.Errorf("Expected account to be present, got %+v", result)
+	}
+}
+
+func TestWalkProofTrace(t *testing.T) {
+	trie, _ := buildKeyedTestTrie(100, 32)
+	key := []byte("key42")
+	proof, _ := trie.GetProof(key)
+
+	walk, err := WalkProof(trie.GetHash(), key, proof)
+	if err != nil {
+		t.Fatalf("WalkProof failed: %v", err)
+	}
+	if len(walk.Trace) != len(proof) {
+		t.Fatalf("Expected a step per proof node, got %d steps for %d nodes", len(walk.Trace), len(proof))
+	}
+
+	keyBit := 0
+	for i, step := range walk.Trace {
+		// Steps go root-to-leaf, proof nodes leaf-to-root
+		var serialized []byte
+		rlp.DecodeBytes(proof[len(proof)-1-i], &serialized)
+		if step.Hash != common.BytesToHash(Keccak256(serialized)) {
+			t.Errorf("Step %d: hash %x is not that of proof node %d", i, step.Hash, len(proof)-1-i)
+		}
+		if step.KeyBit != keyBit {
+			t.Errorf("Step %d: expected key bit %d, got %d", i, keyBit, step.KeyBit)
+		}
+		keyBit += step.SharedPathBits
+		if i == len(walk.Trace)-1 {
+			if step.ChildBit != -1 || keyBit != 8*len(key) {
+				t.Errorf("Expected the walk to end at the last step with the key, got %+v", step)
+			}
+			break
+		}
+		if step.ChildBit != keyBit || step.Child != TrieKeySliceFromKey(key).Get(keyBit) {
+			t.Errorf("Step %d: expected key bit %d to select the child, got %+v", i, keyBit, step)
+		}
+		keyBit++
+	}
+
+	// The embedded leaf is read from its parent when not listed
+	walk, err = WalkProof(trie.GetHash(), key, proof[1:])
+	if err != nil || !walk.Trace[len(walk.Trace)-1].Embedded {
+		t.Errorf("Expected the last step to be embedded, got %v", err)
+	}
+
+	// A failed walk reports the steps up to the missing node
+	walk, err = WalkProof(trie.GetHash(), key, proof[len(proof)-1:])
+	if err == nil || len(walk.Trace) != 1 || walk.Trace[0].ChildBit < 0 {
+		t.Errorf("Expected the trace to stop at the root, got %v and %+v", err, walk.Trace)
+	}
+}
+
+func TestVerifyProofRejectsUnusedNodes(t *testing.T) {
+	trie, _ := buildKeyedTestTrie(100, 32)
+	verifier := NewProofVerifier()
+
+	proof, err := trie.GetProof([]byte("key42"))
+	if err != nil {
+		t.Fatalf("GetProof failed: %v", err)
+	}
+	other, err := trie.GetProof([]byte("key7"))
+	if err != nil {
+		t.Fatalf("GetProof failed: %v", err)
+	}
+
+	withExtra := append(append([][]byte{}, proof...), other[0])
+	if _, _, err := verifier.verifyProof(trie.GetHash(), []byte("key42"), withExtra); err == nil {
+		t.Error("Expected proof with an extra node to be rejected")
+	}
+
+	withDuplicate := append(append([][]byte{}, proof...), proof[0])
+	if _, _, err := verifier.verifyProof(trie.GetHash(), []byte("key42"), withDuplicate); err == nil {
+		t.Error("Expected proof with a duplicate node to be rejected")
+	}
+
+	// A full inclusion proof is unused for an absent key that ends higher up
+	missing, err := trie.GetProof([]byte("kez"))
+	if err != nil {
+		t.Fatalf("GetProof failed: %v", err)
+	}
+	if _, _, err := verifier.verifyProof(trie.GetHash(), []byte("kez"), append(missing, proof[0])); err == nil {
+		t.Error("Expected exclusion proof with an extra node to be rejected")
+	}
+
+	// The leaf is embedded in its parent's message, so it may be left out,
+	// but a node referenced by hash may not
+	if _, _, err := verifier.verifyProof(trie.GetHash(), []byte("key42"), proof[1:]); err != nil {
+		t.Errorf("Expected proof without its embedded leaf to verify, got %v", err)
+	}
+	if _, _, err := verifier.verifyProof(trie.GetHash(), []byte("key42"), proof[2:]); err == nil {
+		t.Error("Expected proof without the parent of its leaf to be rejected")
+	}
+}
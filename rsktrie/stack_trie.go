@@ -0,0 +1,181 @@
+package rsktrie
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnsortedKey is returned by StackTrie.Update for a key that does not sort
+// after the previous one.
+var ErrUnsortedKey = errors.New("stack trie keys must be strictly increasing")
+
+// StackTrie computes the root of a trie from entries inserted in increasing
+// key order, e.g. the transactions or receipts of a block keyed by their
+// index. It returns the same hash as Trie.GetHash for the same entries.
+//
+// Only the nodes on the path to the last key are kept open. Nodes to its left
+// can no longer change, so as soon as a key leaves them they are hashed,
+// handed to the store if there is one, and cut from their children.
+type StackTrie struct {
+	store   TrieStore
+	stack   []*stackFrame
+	lastKey []byte
+	root    *Trie
+}
+
+// stackFrame is an open node on the path to the last inserted key. Its shared
+// path is key[from:to], in expanded bits.
+type stackFrame struct {
+	key      []byte
+	from, to int
+	value    []byte
+	children [2]*Trie
+	// openBit is the implicit bit of the child leading to the next frame
+	openBit byte
+}
+
+// NewStackTrie creates an empty stack trie. If store is not nil, every
+// finished node and long value is saved to it, so that the trie can be
+// reopened with NewTrieFromStore once hashed.
+func NewStackTrie(store TrieStore) *StackTrie {
+	return &StackTrie{store: store}
+}
+
+// Update inserts a key, which must sort after every key inserted before. As
+// with Trie.Put, an empty value is no entry at all. The value is referenced,
+// not copied.
+func (s *StackTrie) Update(key, value []byte) error {
+	if s.root != nil {
+		return errors.New("stack trie was already hashed")
+	}
+	if len(value) == 0 {
+		return nil
+	}
+
+	bits := TrieKeySliceFromKey(key).Expand()
+	if err := s.insert(bits, value); err != nil {
+		return fmt.Errorf("%w: %x after %x", err, key, s.lastKey)
+	}
+	s.lastKey = key
+	return nil
+}
+
+func (s *StackTrie) insert(bits []byte, value []byte) error {
+	if len(s.stack) == 0 {
+		s.stack = append(s.stack, &stackFrame{key: bits, to: len(bits), value: value})
+		return nil
+	}
+
+	pos := 0
+	for i, f := range s.stack {
+		c := commonBits(f.key[f.from:f.to], bits[pos:])
+		if c < f.to-f.from {
+			// Diverges inside the shared path, to the right of the last key
+			if pos+c == len(bits) || bits[pos+c] == 0 {
+				return ErrUnsortedKey
+			}
+			child := &stackFrame{key: f.key, from: f.from + c + 1, to: f.to, value: f.value, children: f.children, openBit: f.openBit}
+			left := s.seal(append([]*stackFrame{child}, s.stack[i+1:]...))
+			*f = stackFrame{key: f.key, from: f.from, to: f.from + c, children: [2]*Trie{left, nil}, openBit: 1}
+			s.push(i, bits, pos+c+1, value)
+			return nil
+		}
+
+		pos += c
+		if pos == len(bits) {
+			// Equal to the last key or one of its prefixes
+			return ErrUnsortedKey
+		}
+		bit := bits[pos]
+
+		switch {
+		case i == len(s.stack)-1:
+			// The last key is a prefix of this one
+			f.openBit = bit
+			s.push(i, bits, pos+1, value)
+			return nil
+		case bit < f.openBit:
+			return ErrUnsortedKey
+		case bit > f.openBit:
+			f.children[0] = s.seal(s.stack[i+1:])
+			f.openBit = 1
+			s.push(i, bits, pos+1, value)
+			return nil
+		}
+		pos++
+	}
+	panic("the last stack frame always ends the walk")
+}
+
+// push replaces the frames below frame i with a new leaf for bits[from:].
+func (s *StackTrie) push(i int, bits []byte, from int, value []byte) {
+	s.stack = append(s.stack[:i+1], &stackFrame{key: bits, from: from, to: len(bits), value: value})
+}
+
+// seal finishes a chain of frames bottom-up and returns the node of the first one.
+func (s *StackTrie) seal(frames []*stackFrame) *Trie {
+	var node *Trie
+	for i := len(frames) - 1; i >= 0; i-- {
+		f := frames[i]
+		if node != nil {
+			f.children[f.openBit] = node
+		}
+		node = s.sealNode(f)
+	}
+	return node
+}
+
+func (s *StackTrie) sealNode(f *stackFrame) *Trie {
+	ref := func(child *Trie) *NodeReference {
+		if child == nil {
+			return NodeReferenceEmpty()
+		}
+		return NewNodeReference(s.store, child, nil)
+	}
+	sharedPath := NewTrieKeySlice(f.key, f.from, f.to)
+	node := NewTrieFull(s.store, sharedPath, f.value, ref(f.children[0]), ref(f.children[1]), Uint24(len(f.value)), nil, nil)
+
+	// Caches the serialization and children size, which is all the parent reads
+	node.GetHash()
+
+	// The node is not shared yet, so its children can be swapped for hash
+	// references that let them be freed. As in NodeReference.save, embedded
+	// children are kept: they are only stored inside this node.
+	node.left = s.hashReference(node.left)
+	node.right = s.hashReference(node.right)
+
+	if s.store != nil {
+		s.store.Save(node)
+	}
+	return node
+}
+
+func (s *StackTrie) hashReference(ref *NodeReference) *NodeReference {
+	if ref.IsEmpty() || ref.IsEmbeddable() {
+		return ref
+	}
+	return NewNodeReference(s.store, nil, ref.GetHash())
+}
+
+// Hash finishes the trie and returns its root hash. No more keys can be
+// inserted afterwards.
+func (s *StackTrie) Hash() []byte {
+	if s.root == nil {
+		if len(s.stack) == 0 {
+			s.root = NewTrie(s.store)
+		} else {
+			s.root = s.seal(s.stack)
+			s.stack = nil
+		}
+	}
+	return s.root.GetHash()
+}
+
+// commonBits returns the length of the common prefix of two expanded keys.
+func commonBits(a, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
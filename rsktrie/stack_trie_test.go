@@ -0,0 +1,160 @@
+package rsktrie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// stackTrieEntries returns random entries sorted by key, with keys of mixed
+// lengths that are often prefixes of each other.
+func stackTrieEntries(rng *rand.Rand, n int) ([][]byte, [][]byte) {
+	unique := make(map[string]bool)
+	var keys [][]byte
+	for len(keys) < n {
+		key := make([]byte, rng.Intn(4)+1)
+		for i := range key {
+			key[i] = byte(rng.Intn(4)) // A small alphabet to share long prefixes
+		}
+		if !unique[string(key)] {
+			unique[string(key)] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+
+	values := make([][]byte, n)
+	for i := range values {
+		values[i] = makeValue(rng.Intn(60) + 1)
+	}
+	return keys, values
+}
+
+func TestStackTrieMatchesTrie(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	for _, n := range []int{0, 1, 2, 3, 10, 50, 200} {
+		keys, values := stackTrieEntries(rng, n)
+
+		trie := NewTrie(nil)
+		st := NewStackTrie(nil)
+		for i, key := range keys {
+			trie = trie.Put(key, values[i])
+			if err := st.Update(key, values[i]); err != nil {
+				t.Fatalf("%d entries: Update(%x) failed: %v", n, key, err)
+			}
+		}
+		if got, want := st.Hash(), trie.GetHash(); !bytes.Equal(got, want) {
+			t.Errorf("%d entries: root mismatch. Got %x, want %x", n, got, want)
+		}
+	}
+}
+
+func TestStackTrieIndexKeys(t *testing.T) {
+	// Block item keys: big-endian indexes of the same length share long prefixes
+	trie := NewTrie(nil)
+	st := NewStackTrie(nil)
+	for i := 0; i < 1000; i++ {
+		key := []byte{byte(i >> 8), byte(i)}
+		value := []byte(fmt.Sprintf("receipt with a value long enough to be stored by hash %d", i))
+		trie = trie.Put(key, value)
+		if err := st.Update(key, value); err != nil {
+			t.Fatalf("Update(%x) failed: %v", key, err)
+		}
+	}
+	if got, want := st.Hash(), trie.GetHash(); !bytes.Equal(got, want) {
+		t.Errorf("Root mismatch. Got %x, want %x", got, want)
+	}
+}
+
+func TestStackTrieSavesNodes(t *testing.T) {
+	keys, values := stackTrieEntries(rand.New(rand.NewSource(11)), 100)
+	store := NewMemTrieStore()
+	st := NewStackTrie(store)
+	for i, key := range keys {
+		if err := st.Update(key, values[i]); err != nil {
+			t.Fatalf("Update(%x) failed: %v", key, err)
+		}
+	}
+
+	reopened, err := NewTrieFromStore(store, st.Hash())
+	if err != nil {
+		t.Fatalf("NewTrieFromStore failed: %v", err)
+	}
+	for i, key := range keys {
+		value, err := reopened.TryGet(key)
+		if err != nil {
+			t.Fatalf("TryGet(%x) failed: %v", key, err)
+		}
+		if !bytes.Equal(value, values[i]) {
+			t.Errorf("Value of %x mismatch. Got %x, want %x", key, value, values[i])
+		}
+	}
+}
+
+func TestStackTrieReopenedTrieAcceptsPuts(t *testing.T) {
+	// Both leaves are embedded in the root, so they are only stored inside it
+	keys := [][]byte{{0x01}, {0x81}}
+	store := NewMemTrieStore()
+	st := NewStackTrie(store)
+	trie := NewTrie(NewMemTrieStore())
+	for _, key := range keys {
+		if err := st.Update(key, []byte{0x01}); err != nil {
+			t.Fatalf("Update(%x) failed: %v", key, err)
+		}
+		trie = trie.Put(key, []byte{0x01})
+	}
+
+	reopened, err := NewTrieFromStore(store, st.Hash())
+	if err != nil {
+		t.Fatalf("NewTrieFromStore failed: %v", err)
+	}
+	reopened = reopened.Put([]byte{0x82}, []byte{0x02})
+	trie = trie.Put([]byte{0x82}, []byte{0x02})
+	if !bytes.Equal(reopened.GetHash(), trie.GetHash()) {
+		t.Errorf("Root mismatch after Put. Got %x, want %x", reopened.GetHash(), trie.GetHash())
+	}
+}
+
+func TestStackTrieRejectsUnsortedKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+	}{
+		{"duplicate", []string{"abc", "abc"}},
+		{"smaller", []string{"abd", "abc"}},
+		{"prefix of the last key", []string{"abc", "ab"}},
+		{"smaller inside a shared path", []string{"ab", "abc", "abd", "ab\x00"}},
+	}
+	for _, tt := range tests {
+		st := NewStackTrie(nil)
+		var err error
+		for _, key := range tt.keys {
+			if err = st.Update([]byte(key), []byte{1}); err != nil {
+				break
+			}
+		}
+		if !errors.Is(err, ErrUnsortedKey) {
+			t.Errorf("%s: expected ErrUnsortedKey, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestStackTrieSkipsEmptyValues(t *testing.T) {
+	st := NewStackTrie(nil)
+	if err := st.Update([]byte("a"), nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := st.Update([]byte("b"), []byte{1}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	expected := NewTrie(nil).Put([]byte("b"), []byte{1}).GetHash()
+	if !bytes.Equal(st.Hash(), expected) {
+		t.Errorf("Root mismatch. Got %x, want %x", st.Hash(), expected)
+	}
+	if err := st.Update([]byte("c"), []byte{1}); err == nil {
+		t.Error("Expected an error when updating a hashed stack trie")
+	}
+}
@@ -2,29 +2,54 @@ package rsktrie
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"sync"
 
 	"golang.org/x/crypto/sha3"
 )
 
+var (
+	// ErrLongValueNotFound is returned when a long value is not present in the trie store.
+	ErrLongValueNotFound = errors.New("long value not found in store")
+	// ErrLongValueMismatch is returned when a stored long value does not match its hash or length.
+	ErrLongValueMismatch = errors.New("long value does not match value hash")
+)
+
 func Keccak256(data []byte) []byte {
 	hash := sha3.NewLegacyKeccak256()
 	hash.Write(data)
 	return hash.Sum(nil)
 }
 
+// Trie is a node of the RSK unified trie. Put and Delete return new tries
+// that share their unchanged nodes with the original one.
+//
+// Read methods are safe for concurrent use: the hash, encoding, children size
+// and long value are filled in lazily under a per-node lock, and so are the
+// nodes that references load from the store. Save releases in-memory children
+// and must not run concurrently with any other call on the same trie.
 type Trie struct {
+	left        *NodeReference
+	right       *NodeReference
+	store       TrieStore
+	sharedPath  *TrieKeySlice
+	valueLength Uint24
+	saved       bool
+
+	// mu guards the fields below. It is never held while calling into other
+	// nodes or the store, so concurrent callers may compute a value twice and
+	// the first one stored wins.
+	mu           sync.Mutex
 	value        []byte
-	left         *NodeReference
-	right        *NodeReference
-	store        TrieStore
-	sharedPath   *TrieKeySlice
-	valueLength  Uint24
 	valueHash    []byte
 	childrenSize *VarInt
+	hash         []byte
+	encoded      []byte
 
-	hash    []byte
-	encoded []byte
-	saved   bool
+	// Cached pre-RSKIP-107 hash and the isSecure flag it was computed with
+	hashOrchid       []byte
+	hashOrchidSecure bool
 }
 
 func NewTrie(store TrieStore) *Trie {
@@ -48,6 +73,19 @@ func NewTrieFull(store TrieStore, sharedPath *TrieKeySlice, value []byte, left,
 	return t
 }
 
+// NewTrieFromStore reopens a previously saved trie by its root hash.
+// Child nodes are loaded lazily from the store as they are accessed.
+func NewTrieFromStore(store TrieStore, rootHash []byte) (*Trie, error) {
+	if bytes.Equal(rootHash, EmptyHash) {
+		return NewTrie(store), nil
+	}
+	root := store.Retrieve(rootHash)
+	if root == nil {
+		return nil, fmt.Errorf("root node %x not found in store", rootHash)
+	}
+	return root, nil
+}
+
 func (t *Trie) IsEmptyTrie() bool {
 	return t.valueLength == 0 && t.left.IsEmpty() && t.right.IsEmpty()
 }
@@ -64,19 +102,89 @@ func (t *Trie) GetByKeySlice(key *TrieKeySlice) []byte {
 	return node.GetValue()
 }
 
-func (t *Trie) GetValue() []byte {
-	if t.value == nil && t.valueLength > 0 {
-		// retrieve long value
-		// TODO: Implement long value retrieval logic
+// TryGet is like Get but reports an error if a node on the key's path or a long
+// value cannot be retrieved from the store. Missing nodes yield a *MissingNodeError.
+func (t *Trie) TryGet(key []byte) ([]byte, error) {
+	node, err := t.TryFind(TrieKeySliceFromKey(key))
+	if node == nil || err != nil {
+		return nil, err
 	}
-	if t.value == nil {
+	return node.TryGetValue()
+}
+
+// GetValue returns a copy of the node value, or nil if there is none.
+// Long values that cannot be retrieved are also returned as nil; use TryGetValue to tell them apart.
+func (t *Trie) GetValue() []byte {
+	val, err := t.TryGetValue()
+	if err != nil {
 		return nil
 	}
-	val := make([]byte, len(t.value))
-	copy(val, t.value)
 	return val
 }
 
+// TryGetValue returns a copy of the node value, lazily retrieving long values
+// from the store and checking them against the value hash.
+func (t *Trie) TryGetValue() ([]byte, error) {
+	value, err := t.cached(&t.value, func() ([]byte, error) {
+		if t.valueLength == 0 {
+			return nil, nil
+		}
+		return t.retrieveLongValue()
+	})
+	if value == nil || err != nil {
+		return nil, err
+	}
+	val := make([]byte, len(value))
+	copy(val, value)
+	return val, nil
+}
+
+func (t *Trie) retrieveLongValue() ([]byte, error) {
+	_, valueHash, _ := t.lazyFields()
+	if t.store == nil {
+		return nil, fmt.Errorf("%w: no store for value hash %x", ErrLongValueNotFound, valueHash)
+	}
+	value := t.store.RetrieveValue(valueHash)
+	if value == nil {
+		return nil, fmt.Errorf("%w: value hash %x", ErrLongValueNotFound, valueHash)
+	}
+	if Uint24(len(value)) != t.valueLength || !bytes.Equal(Keccak256(value), valueHash) {
+		return nil, fmt.Errorf("%w: value hash %x", ErrLongValueMismatch, valueHash)
+	}
+	return value, nil
+}
+
+// cached returns *field, filling it first with compute if it is still nil.
+// A nil result from compute is not cached.
+func (t *Trie) cached(field *[]byte, compute func() ([]byte, error)) ([]byte, error) {
+	t.mu.Lock()
+	value := *field
+	t.mu.Unlock()
+	if value != nil {
+		return value, nil
+	}
+
+	value, err := compute()
+	if value == nil || err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if *field == nil {
+		*field = value
+	}
+	return *field, nil
+}
+
+// lazyFields returns the fields that readers may be filling in concurrently,
+// for building a new node from this one.
+func (t *Trie) lazyFields() (value, valueHash []byte, childrenSize *VarInt) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.value, t.valueHash, t.childrenSize
+}
+
 func (t *Trie) Find(key *TrieKeySlice) *Trie {
 	if t.sharedPath.Length() > key.Length() {
 		return nil
@@ -101,6 +209,34 @@ func (t *Trie) Find(key *TrieKeySlice) *Trie {
 	return node.Find(key.Slice(common.Length()+1, key.Length()))
 }
 
+// TryFind is like Find but returns a *MissingNodeError for unavailable nodes on the path.
+func (t *Trie) TryFind(key *TrieKeySlice) (*Trie, error) {
+	node := t
+	for {
+		common := key.CommonPath(node.sharedPath)
+		if common.Length() < node.sharedPath.Length() {
+			return nil, nil
+		}
+		if common.Length() == key.Length() {
+			return node, nil
+		}
+
+		child, err := node.childRef(key.Get(common.Length())).TryGetNode()
+		if child == nil || err != nil {
+			return nil, err
+		}
+		node = child
+		key = key.Slice(common.Length()+1, key.Length())
+	}
+}
+
+func (t *Trie) childRef(implicitByte byte) *NodeReference {
+	if implicitByte == 0 {
+		return t.left
+	}
+	return t.right
+}
+
 func (t *Trie) RetrieveNode(implicitByte byte) *Trie {
 	if implicitByte == 0 {
 		return t.left.GetNode()
@@ -113,18 +249,62 @@ func (t *Trie) Put(key []byte, value []byte) *Trie {
 }
 
 func (t *Trie) PutKeySlice(key *TrieKeySlice, value []byte) *Trie {
+	newTrie := t.put(key, value)
+	if newTrie == nil {
+		return NewTrie(t.store)
+	}
+	return newTrie
+}
+
+// put inserts or deletes a value and coalesces the resulting node when needed.
+// A nil result means the node became empty and must be removed from its parent.
+func (t *Trie) put(key *TrieKeySlice, value []byte) *Trie {
 	// Treat empty value as delete
 	if value != nil && len(value) == 0 {
 		value = nil
 	}
 
-	newTrie := t.InternalPut(key, value)
-	if newTrie == nil {
-		return NewTrie(t.store)
+	trie := t.InternalPut(key, value)
+
+	// Only delete operations need coalescing
+	if trie == nil || value != nil {
+		return trie
 	}
-	return newTrie
+
+	if trie.IsEmptyTrie() {
+		return nil
+	}
+
+	// Only coalesce if the node has no value and exactly one child
+	if trie.valueLength > 0 {
+		return trie
+	}
+	if trie.left.IsEmpty() == trie.right.IsEmpty() {
+		return trie
+	}
+
+	var child *Trie
+	var childImplicitByte byte
+	if !trie.left.IsEmpty() {
+		child = trie.left.GetNode()
+		childImplicitByte = 0
+	} else {
+		child = trie.right.GetNode()
+		childImplicitByte = 1
+	}
+
+	if child == nil {
+		panic("The trie doesn't contain the child node")
+	}
+
+	newSharedPath := trie.sharedPath.RebuildSharedPath(childImplicitByte, child.sharedPath)
+	childValue, childValueHash, childChildrenSize := child.lazyFields()
+
+	return NewTrieFull(child.store, newSharedPath, childValue, child.left, child.right, child.valueLength, childValueHash, childChildrenSize)
 }
 
+// InternalPut returns the node resulting from setting key to value, or nil
+// when the node ends up with neither a value nor children.
 func (t *Trie) InternalPut(key *TrieKeySlice, value []byte) *Trie {
 	commonPath := key.CommonPath(t.sharedPath)
 
@@ -133,7 +313,7 @@ func (t *Trie) InternalPut(key *TrieKeySlice, value []byte) *Trie {
 		if value == nil {
 			return t // Deleting non-existent key
 		}
-		return t.Split(commonPath).PutKeySlice(key, value)
+		return t.Split(commonPath).put(key, value)
 	}
 
 	// Case 2: Exact match or sub-key
@@ -143,18 +323,13 @@ func (t *Trie) InternalPut(key *TrieKeySlice, value []byte) *Trie {
 		if t.valueLength == Uint24(len(value)) && bytes.Equal(t.GetValue(), value) {
 			return t
 		}
-		if value == nil {
-			// Delete logic - simplified for now
-			// If deleting value, and no children, return empty?
-			// Need proper delete coalescing logic
-			// For now, return node with null value
-			// Real implementation coalesces.
-			// Let's implement basics: set value to nil.
-			// Then check if we can merge/remove.
-			return NewTrieFull(t.store, t.sharedPath, nil, t.left, t.right, 0, nil, t.childrenSize)
+
+		if value == nil && t.left.IsEmpty() && t.right.IsEmpty() {
+			return nil
 		}
 
-		return NewTrieFull(t.store, t.sharedPath, value, t.left, t.right, Uint24(len(value)), nil, t.childrenSize)
+		_, _, childrenSize := t.lazyFields()
+		return NewTrieFull(t.store, t.sharedPath, value, t.left, t.right, Uint24(len(value)), nil, childrenSize)
 	}
 
 	// Case 3: Recursive put in children
@@ -169,35 +344,54 @@ func (t *Trie) InternalPut(key *TrieKeySlice, value []byte) *Trie {
 	}
 
 	subKey := key.Slice(t.sharedPath.Length()+1, key.Length())
-	newNode := node.PutKeySlice(subKey, value)
+	newNode := node.put(subKey, value)
 
 	if newNode == node {
 		return t // No change
 	}
 
+	currentValue, valueHash, childrenSize := t.lazyFields()
+
 	newLeft := t.left
 	newRight := t.right
 	newNodeRef := NewNodeReference(t.store, newNode, nil)
 
+	// Adjust the children size by the difference between the old and new child
 	if pos == 0 {
 		newLeft = newNodeRef
+		if childrenSize != nil {
+			childrenSize = newChildrenSize(childrenSize.Value, t.left.ReferenceSize(), newLeft.ReferenceSize())
+		}
 	} else {
 		newRight = newNodeRef
+		if childrenSize != nil {
+			childrenSize = newChildrenSize(childrenSize.Value, t.right.ReferenceSize(), newRight.ReferenceSize())
+		}
 	}
 
-	// TODO: Recalculate ChildrenSize
+	if t.valueLength == 0 && newLeft.IsEmpty() && newRight.IsEmpty() {
+		return nil
+	}
 
-	return NewTrieFull(t.store, t.sharedPath, t.value, newLeft, newRight, t.valueLength, t.valueHash, t.childrenSize)
+	return NewTrieFull(t.store, t.sharedPath, currentValue, newLeft, newRight, t.valueLength, valueHash, childrenSize)
+}
+
+// newChildrenSize replaces the size of one child reference within a children size value.
+func newChildrenSize(current uint64, oldReferenceSize, newReferenceSize int) *VarInt {
+	vi := NewVarInt(current - uint64(oldReferenceSize) + uint64(newReferenceSize))
+	return &vi
 }
 
 func (t *Trie) Split(commonPath *TrieKeySlice) *Trie {
 	commonLen := commonPath.Length()
 	newChildSharedPath := t.sharedPath.Slice(commonLen+1, t.sharedPath.Length())
 
-	newChildTrie := NewTrieFull(t.store, newChildSharedPath, t.value, t.left, t.right, t.valueLength, t.valueHash, t.childrenSize)
+	value, valueHash, childrenSize := t.lazyFields()
+	newChildTrie := NewTrieFull(t.store, newChildSharedPath, value, t.left, t.right, t.valueLength, valueHash, childrenSize)
 	newChildRef := NewNodeReference(t.store, newChildTrie, nil)
 
 	pos := t.sharedPath.Get(commonLen)
+	newChildrenSize := NewVarInt(uint64(newChildRef.ReferenceSize()))
 	var newLeft, newRight *NodeReference
 	if pos == 0 {
 		newLeft = newChildRef
@@ -207,13 +401,111 @@ func (t *Trie) Split(commonPath *TrieKeySlice) *Trie {
 		newRight = newChildRef
 	}
 
-	return NewTrieFull(t.store, commonPath, nil, newLeft, newRight, 0, nil, nil) // ChildrenSize needs recalc
+	return NewTrieFull(t.store, commonPath, nil, newLeft, newRight, 0, nil, &newChildrenSize)
 }
 
 func (t *Trie) Delete(key []byte) *Trie {
 	return t.Put(key, nil)
 }
 
+// TryPut is like Put but first checks that every node the update needs is
+// available, returning a *MissingNodeError otherwise. Use it on tries whose
+// store may lack subtrees, such as partial tries built from proofs.
+func (t *Trie) TryPut(key []byte, value []byte) (*Trie, error) {
+	keySlice := TrieKeySliceFromKey(key)
+	if err := t.checkPutPath(keySlice, len(value) == 0); err != nil {
+		return nil, err
+	}
+	return t.PutKeySlice(keySlice, value), nil
+}
+
+// TryDelete is like Delete but reports unavailable nodes as TryPut does.
+func (t *Trie) TryDelete(key []byte) (*Trie, error) {
+	return t.TryPut(key, nil)
+}
+
+// checkPutPath loads the nodes that put reads for key: the nodes on its path
+// and, when deleting, the node a valueless parent would be coalesced with.
+func (t *Trie) checkPutPath(key *TrieKeySlice, deleting bool) error {
+	var parent *Trie
+	var parentPos byte
+	node := t
+	for {
+		common := key.CommonPath(node.sharedPath)
+		if common.Length() < node.sharedPath.Length() {
+			// Diverges inside the shared path: a split or a no-op delete
+			return nil
+		}
+		if common.Length() == key.Length() {
+			break
+		}
+
+		pos := key.Get(common.Length())
+		child, err := node.childRef(pos).TryGetNode()
+		if err != nil {
+			return err
+		}
+		if child == nil {
+			return nil
+		}
+		parent, parentPos, node = node, pos, child
+		key = key.Slice(common.Length()+1, key.Length())
+	}
+
+	if !deleting || node.valueLength == 0 {
+		return nil
+	}
+
+	switch {
+	case node.left.IsEmpty() && node.right.IsEmpty():
+		// The node is removed; a valueless parent merges with its other child
+		if parent != nil && parent.valueLength == 0 {
+			_, err := parent.childRef(1 - parentPos).TryGetNode()
+			return err
+		}
+	case node.left.IsEmpty() || node.right.IsEmpty():
+		// The node merges with its only child
+		_, err := node.left.TryGetNode()
+		if err == nil {
+			_, err = node.right.TryGetNode()
+		}
+		return err
+	}
+	return nil
+}
+
+// Save persists every node and long value that was not saved yet into store,
+// bottom-up. References to saved children that are not embedded in their
+// parent release the in-memory node and keep only its hash, so they are
+// loaded again from store when needed.
+func (t *Trie) Save(store TrieStore) {
+	if t.IsEmptyTrie() {
+		return
+	}
+	t.save(store)
+}
+
+func (t *Trie) save(store TrieStore) {
+	if t.saved {
+		return
+	}
+
+	// Serialize this node before its children are released
+	t.GetHash()
+
+	t.left.save(store)
+	t.right.save(store)
+
+	t.store = store
+	store.Save(t)
+}
+
+// WasSaved reports whether this node has already been persisted by Save. The
+// store marks it once the node is durable.
+func (t *Trie) WasSaved() bool {
+	return t.saved
+}
+
 const (
 	MaxEmbeddedNodeSizeInBytes = 44
 )
@@ -229,38 +521,65 @@ var EmptyHash = Keccak256([]byte{0x80})
 // So EmptyHash is Keccak(0x80).
 
 func (t *Trie) GetHash() []byte {
-	if t.hash != nil {
-		return t.hash
-	}
 	if t.IsEmptyTrie() {
 		val := make([]byte, 32)
 		copy(val, EmptyHash)
 		return val
 	}
 
-	msg := t.ToMessage()
-	t.hash = Keccak256(msg)
-	return t.hash
+	hash, _ := t.cached(&t.hash, func() ([]byte, error) {
+		return Keccak256(t.message()), nil
+	})
+	return hash
 }
 
 func (t *Trie) ToMessage() []byte {
-	if t.encoded == nil {
-		t.InternalToMessage()
-	}
+	encoded := t.message()
 	// Return copy
-	cp := make([]byte, len(t.encoded))
-	copy(cp, t.encoded)
+	cp := make([]byte, len(encoded))
+	copy(cp, encoded)
 	return cp
 }
 
+// GetMessageLength returns the length of ToMessage. Unless the node was
+// already serialized, it is computed from the node fields: serializing would
+// hash every non-embedded child, and Put asks for this length on each node
+// it rebuilds.
 func (t *Trie) GetMessageLength() int {
-	if t.encoded == nil {
-		t.InternalToMessage()
+	t.mu.Lock()
+	encoded := t.encoded
+	t.mu.Unlock()
+	if encoded != nil {
+		return len(encoded)
 	}
-	return len(t.encoded)
+
+	length := 1 + NewSharedPathSerializer(t.sharedPath).SerializedLength()
+	length += t.left.serializedLength() + t.right.serializedLength()
+	if !t.IsTerminal() {
+		length += NewVarInt(t.GetChildrenSize().Value).Size
+	}
+	if t.HasLongValue() {
+		length += 32 + 3 // value hash and Uint24 length
+	} else {
+		length += t.valueLength.Int()
+	}
+	return length
+}
+
+// message returns the cached serialization, which must not be modified.
+func (t *Trie) message() []byte {
+	encoded, _ := t.cached(&t.encoded, func() ([]byte, error) {
+		return t.encode(), nil
+	})
+	return encoded
 }
 
+// InternalToMessage serializes the node into its message cache.
 func (t *Trie) InternalToMessage() {
+	t.message()
+}
+
+func (t *Trie) encode() []byte {
 	// Logic from internalToMessage
 	lvalue := t.valueLength
 	hasLongVal := t.HasLongValue()
@@ -271,25 +590,24 @@ func (t *Trie) InternalToMessage() {
 	buf := new(bytes.Buffer)
 
 	// Flags
-	// 01000000
-	var flags byte = 0b01000000
+	var flags byte = flagsVersion
 	if hasLongVal {
-		flags |= 0b00100000
+		flags |= flagLongValue
 	}
 	if sps.IsPresent() {
-		flags |= 0b00010000
+		flags |= flagSharedPath
 	}
 	if !t.left.IsEmpty() {
-		flags |= 0b00001000
+		flags |= flagLeftPresent
 	}
 	if !t.right.IsEmpty() {
-		flags |= 0b00000100
+		flags |= flagRightPresent
 	}
 	if t.left.IsEmbeddable() {
-		flags |= 0b00000010
+		flags |= flagLeftEmbedded
 	}
 	if t.right.IsEmbeddable() {
-		flags |= 0b00000001
+		flags |= flagRightEmbedded
 	}
 
 	buf.WriteByte(flags)
@@ -309,14 +627,23 @@ func (t *Trie) InternalToMessage() {
 		buf.Write(t.GetValue())
 	}
 
-	t.encoded = buf.Bytes()
+	return buf.Bytes()
 }
 
 func (t *Trie) GetValueHash() []byte {
-	if t.valueHash == nil && t.valueLength > 0 {
-		t.valueHash = Keccak256(t.GetValue())
-	}
-	return t.valueHash
+	valueHash, _ := t.cached(&t.valueHash, func() ([]byte, error) {
+		if t.valueLength == 0 {
+			return nil, nil
+		}
+		return Keccak256(t.GetValue()), nil
+	})
+	return valueHash
+}
+
+// GetValueLength returns the length of the node value, which is known
+// without retrieving a long value.
+func (t *Trie) GetValueLength() Uint24 {
+	return t.valueLength
 }
 
 func (t *Trie) HasLongValue() bool {
@@ -333,21 +660,33 @@ func (t *Trie) IsEmbeddable() bool {
 }
 
 func (t *Trie) GetChildrenSize() *VarInt {
+	t.mu.Lock()
+	childrenSize := t.childrenSize
+	t.mu.Unlock()
+	if childrenSize != nil {
+		return childrenSize
+	}
+
+	var vi VarInt
+	if t.IsTerminal() {
+		vi = NewVarInt(0)
+	} else {
+		// left.referenceSize() + right.referenceSize()
+		// Go NodeReference ReferenceSize calls getNode().TrieSize()?
+		// No, Java ReferenceSize logic:
+		// trie.getChildrenSize().value + externalValueLength + trie.getMessageLength()
+		// So it's the SERIALIZED size + children size.
+		// "Size of this node along with its children"
+
+		ls := t.left.ReferenceSize()
+		rs := t.right.ReferenceSize()
+		vi = NewVarInt(uint64(ls + rs))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	if t.childrenSize == nil {
-		if t.IsTerminal() {
-			t.childrenSize = &VarInt{Value: 0}
-		} else {
-			// left.referenceSize() + right.referenceSize()
-			// Go NodeReference ReferenceSize calls getNode().TrieSize()?
-			// No, Java ReferenceSize logic:
-			// trie.getChildrenSize().value + externalValueLength + trie.getMessageLength()
-			// So it's the SERIALIZED size + children size.
-			// "Size of this node along with its children"
-
-			ls := t.left.ReferenceSize()
-			rs := t.right.ReferenceSize()
-			t.childrenSize = &VarInt{Value: uint64(ls + rs)}
-		}
+		t.childrenSize = &vi
 	}
 	return t.childrenSize
 }
@@ -375,6 +714,16 @@ func (t *Trie) GetPostOrderIterator() *PostOrderIterator {
 	return NewPostOrderIterator(t)
 }
 
+// GetRangeIterator returns the (key, value) pairs with start <= key < end.
+func (t *Trie) GetRangeIterator(start, end []byte) *RangeIterator {
+	return NewRangeIterator(t, start, end)
+}
+
+// GetPrefixIterator returns the (key, value) pairs whose key starts with prefix.
+func (t *Trie) GetPrefixIterator(prefix []byte) *RangeIterator {
+	return NewPrefixIterator(t, prefix)
+}
+
 // GetSharedPath returns the shared path of this trie node
 func (t *Trie) GetSharedPath() *TrieKeySlice {
 	return t.sharedPath
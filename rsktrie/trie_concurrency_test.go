@@ -0,0 +1,138 @@
+package rsktrie
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+const concurrentReaders = 8
+
+// readConcurrently runs Get, GetHash and iteration over trie from several goroutines at once.
+// Run with -race to detect unsynchronized cache fills.
+func readConcurrently(t *testing.T, trie *Trie, expected map[string][]byte, wantHash []byte) {
+	var wg sync.WaitGroup
+	for r := 0; r < concurrentReaders; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if hash := trie.GetHash(); !bytes.Equal(hash, wantHash) {
+				t.Errorf("Root hash mismatch. Got %x, want %x", hash, wantHash)
+			}
+			for key, value := range expected {
+				if got := trie.Get([]byte(key)); !bytes.Equal(got, value) {
+					t.Errorf("Get(%q) mismatch. Got %x, want %x", key, got, value)
+				}
+			}
+
+			count := 0
+			for it := trie.GetPrefixIterator([]byte("key")); it.HasNext(); {
+				kv := it.Next()
+				if !bytes.Equal(kv.Value, expected[string(kv.Key)]) {
+					t.Errorf("Iterated value of %q mismatch", kv.Key)
+				}
+				count++
+			}
+			if count != len(expected) {
+				t.Errorf("Expected %d iterated keys, got %d", len(expected), count)
+			}
+
+			nodes := 0
+			for it := trie.GetPreOrderIterator(); it.HasNext(); it.Next() {
+				nodes++
+			}
+			if nodes == 0 {
+				t.Error("Expected pre-order iteration to visit nodes")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestConcurrentReadsOfInMemoryTrie(t *testing.T) {
+	reference, expected := buildKeyedTestTrie(200, 50)
+	wantHash := reference.GetHash()
+
+	// Hashes and encodings of this copy are computed by the readers themselves
+	trie, _ := buildKeyedTestTrie(200, 50)
+
+	readConcurrently(t, trie, expected, wantHash)
+}
+
+func TestConcurrentReadsOfStoredTrie(t *testing.T) {
+	built, expected := buildKeyedTestTrie(200, 50)
+	store := NewMemTrieStore()
+	built.Save(store)
+	rootHash := built.GetHash()
+
+	// A root decoded from its message references every child by hash, so the
+	// readers load nodes and long values from the shared store concurrently
+	root, err := FromMessage(built.ToMessage(), store)
+	if err != nil {
+		t.Fatalf("FromMessage failed: %v", err)
+	}
+
+	readConcurrently(t, root, expected, rootHash)
+}
+
+func TestConcurrentProofGeneration(t *testing.T) {
+	trie, expected := buildKeyedTestTrie(200, 50)
+	rootHash := trie.GetHash()
+
+	var wg sync.WaitGroup
+	for r := 0; r < concurrentReaders; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range expected {
+				if _, err := trie.GetProof([]byte(key)); err != nil {
+					t.Errorf("GetProof(%q) failed: %v", key, err)
+				}
+			}
+			if !bytes.Equal(trie.GetHashOrchid(false), trie.GetHashOrchid(false)) {
+				t.Error("Expected a stable Orchid hash")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if !bytes.Equal(trie.GetHash(), rootHash) {
+		t.Error("Expected the root hash to be unchanged by concurrent reads")
+	}
+}
+
+func TestMemTrieStoreConcurrentSaveAndRetrieve(t *testing.T) {
+	store := NewMemTrieStore()
+
+	var wg sync.WaitGroup
+	hashes := make([][]byte, concurrentReaders)
+	for r := 0; r < concurrentReaders; r++ {
+		trie := NewTrie(nil).Put([]byte(fmt.Sprintf("writer-%d", r)), makeValue(40+r))
+		hashes[r] = trie.GetHash()
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			trie.Save(store)
+		}()
+		go func(hash []byte) {
+			defer wg.Done()
+			// The node may or may not be saved yet; only the access is checked
+			store.Retrieve(hash)
+			store.RetrieveValue(hash)
+		}(hashes[r])
+	}
+	wg.Wait()
+
+	for r, hash := range hashes {
+		node := store.Retrieve(hash)
+		if node == nil {
+			t.Fatalf("Expected node %d to be stored", r)
+		}
+		if !bytes.Equal(node.GetValue(), makeValue(40+r)) {
+			t.Errorf("Value of node %d mismatch", r)
+		}
+	}
+}
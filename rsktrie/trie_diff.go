@@ -0,0 +1,272 @@
+package rsktrie
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// ChangeType classifies a key that differs between two tries.
+type ChangeType int
+
+const (
+	// ChangeAdded means the key only exists in the new trie
+	ChangeAdded ChangeType = iota + 1
+	// ChangeRemoved means the key only exists in the old trie
+	ChangeRemoved
+	// ChangeModified means the key exists in both tries with different values
+	ChangeModified
+)
+
+func (c ChangeType) String() string {
+	switch c {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeModified:
+		return "modified"
+	default:
+		return fmt.Sprintf("ChangeType(%d)", int(c))
+	}
+}
+
+// TrieChange is a single key that differs between two tries.
+// OldValue is nil for added keys and NewValue is nil for removed keys.
+type TrieChange struct {
+	Type     ChangeType
+	Key      []byte
+	OldValue []byte
+	NewValue []byte
+}
+
+// DiffRoots compares the tries with the given root hashes, loading nodes from store.
+// See Diff.
+func DiffRoots(store TrieStore, oldRoot, newRoot []byte, onChange func(*TrieChange) error) error {
+	oldTrie, err := NewTrieFromStore(store, oldRoot)
+	if err != nil {
+		return fmt.Errorf("open old root: %w", err)
+	}
+	newTrie, err := NewTrieFromStore(store, newRoot)
+	if err != nil {
+		return fmt.Errorf("open new root: %w", err)
+	}
+	return Diff(oldTrie, newTrie, onChange)
+}
+
+// Diff walks both tries in key order and calls onChange for every key that
+// was added, removed or modified. Subtrees referenced by the same hash on both
+// sides are skipped without being loaded. Walking stops at the first error
+// returned by onChange, which is then returned.
+func Diff(oldTrie, newTrie *Trie, onChange func(*TrieChange) error) error {
+	d := &trieDiffer{onChange: onChange, path: []byte{}}
+	return d.diff(newDiffCursor(oldTrie), newDiffCursor(newTrie))
+}
+
+// diffCursor is a position in a trie. It is either the start of a node that
+// is only known by its reference, or a loaded node plus how many bits of its
+// shared path lie above the position. The zero value is an empty subtree.
+type diffCursor struct {
+	ref  *NodeReference
+	node *Trie
+	skip int
+}
+
+func newDiffCursor(t *Trie) diffCursor {
+	if t == nil || t.IsEmptyTrie() {
+		return diffCursor{}
+	}
+	return diffCursor{node: t}
+}
+
+func (c diffCursor) isEmpty() bool {
+	return c.ref == nil && c.node == nil
+}
+
+// hashAtStart returns the hash of the subtree when the position is the start
+// of a node, without loading referenced nodes.
+func (c diffCursor) hashAtStart() []byte {
+	if c.ref != nil {
+		return c.ref.GetHash()
+	}
+	if c.skip == 0 {
+		return c.node.GetHash()
+	}
+	return nil
+}
+
+// load resolves a referenced node from its store.
+func (c diffCursor) load() (diffCursor, error) {
+	if c.ref == nil {
+		return c, nil
+	}
+	node, err := c.ref.TryGetNode()
+	if err != nil {
+		return c, err
+	}
+	return diffCursor{node: node}, nil
+}
+
+// atNode reports whether the position is the node itself, past its shared path.
+func (c diffCursor) atNode() bool {
+	return c.skip == c.node.sharedPath.Length()
+}
+
+// step moves a loaded cursor one bit down.
+func (c diffCursor) step(bit byte) diffCursor {
+	if !c.atNode() {
+		if c.node.sharedPath.Get(c.skip) != bit {
+			return diffCursor{}
+		}
+		return diffCursor{node: c.node, skip: c.skip + 1}
+	}
+
+	ref := c.node.left
+	if bit == 1 {
+		ref = c.node.right
+	}
+	if ref.IsEmpty() {
+		return diffCursor{}
+	}
+	return diffCursor{ref: ref}
+}
+
+// trieDiffer walks two tries. path holds the expanded bits of the current
+// position; it is shared by the whole walk and only encoded into a new key
+// when a change is reported.
+type trieDiffer struct {
+	onChange func(*TrieChange) error
+	path     []byte
+}
+
+func (d *trieDiffer) diff(a, b diffCursor) error {
+	if a.isEmpty() && b.isEmpty() {
+		return nil
+	}
+	if !a.isEmpty() && !b.isEmpty() {
+		// Equal subtrees are skipped without loading them
+		hashA, hashB := a.hashAtStart(), b.hashAtStart()
+		if hashA != nil && bytes.Equal(hashA, hashB) {
+			return nil
+		}
+	}
+
+	a, err := a.load()
+	if err != nil {
+		return err
+	}
+	b, err = b.load()
+	if err != nil {
+		return err
+	}
+	if a.isEmpty() {
+		return d.emitAll(b, ChangeAdded)
+	}
+	if b.isEmpty() {
+		return d.emitAll(a, ChangeRemoved)
+	}
+
+	if a.atNode() || b.atNode() {
+		if err := d.diffValues(a, b); err != nil {
+			return err
+		}
+	}
+
+	depth := len(d.path)
+	defer func() { d.path = d.path[:depth] }()
+	for bit := byte(0); bit <= 1; bit++ {
+		d.path = append(d.path[:depth], bit)
+		if err := d.diff(a.step(bit), b.step(bit)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diffValues compares the values at a position where at least one side is at a node.
+func (d *trieDiffer) diffValues(a, b diffCursor) error {
+	hasA := a.atNode() && a.node.valueLength > 0
+	hasB := b.atNode() && b.node.valueLength > 0
+	if !hasA && !hasB {
+		return nil
+	}
+	if hasA && hasB && sameValue(a.node, b.node) {
+		return nil
+	}
+
+	change := &TrieChange{Key: PathEncoderEncode(d.path)}
+	var err error
+	switch {
+	case !hasA:
+		change.Type = ChangeAdded
+	case !hasB:
+		change.Type = ChangeRemoved
+	default:
+		change.Type = ChangeModified
+	}
+	if hasA {
+		if change.OldValue, err = a.node.TryGetValue(); err != nil {
+			return fmt.Errorf("old value of key %x: %w", change.Key, err)
+		}
+	}
+	if hasB {
+		if change.NewValue, err = b.node.TryGetValue(); err != nil {
+			return fmt.Errorf("new value of key %x: %w", change.Key, err)
+		}
+	}
+	return d.onChange(change)
+}
+
+// emitAll reports every value below a loaded cursor as added or removed.
+func (d *trieDiffer) emitAll(c diffCursor, changeType ChangeType) error {
+	depth := len(d.path)
+	defer func() { d.path = d.path[:depth] }()
+
+	// Jump over the rest of the shared path at once
+	for i := c.skip; i < c.node.sharedPath.Length(); i++ {
+		d.path = append(d.path, c.node.sharedPath.Get(i))
+	}
+
+	if c.node.valueLength > 0 {
+		value, err := c.node.TryGetValue()
+		if err != nil {
+			return fmt.Errorf("value of key %x: %w", PathEncoderEncode(d.path), err)
+		}
+		change := &TrieChange{Type: changeType, Key: PathEncoderEncode(d.path)}
+		if changeType == ChangeAdded {
+			change.NewValue = value
+		} else {
+			change.OldValue = value
+		}
+		if err := d.onChange(change); err != nil {
+			return err
+		}
+	}
+
+	atNode := len(d.path)
+	for bit := byte(0); bit <= 1; bit++ {
+		child, err := diffCursor{node: c.node, skip: c.node.sharedPath.Length()}.step(bit).load()
+		if err != nil {
+			return err
+		}
+		if child.isEmpty() {
+			continue
+		}
+		d.path = append(d.path[:atNode], bit)
+		if err := d.emitAll(child, changeType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameValue compares node values, using the value hash for long values so
+// that they do not need to be loaded.
+func sameValue(a, b *Trie) bool {
+	if a.valueLength != b.valueLength {
+		return false
+	}
+	if a.HasLongValue() {
+		return bytes.Equal(a.GetValueHash(), b.GetValueHash())
+	}
+	return bytes.Equal(a.GetValue(), b.GetValue())
+}
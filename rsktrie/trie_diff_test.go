@@ -0,0 +1,210 @@
+package rsktrie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// countingTrieStore counts node loads to check which subtrees Diff visits.
+type countingTrieStore struct {
+	*MemTrieStore
+	retrieved int
+}
+
+func (s *countingTrieStore) Retrieve(hash []byte) *Trie {
+	s.retrieved++
+	return s.MemTrieStore.Retrieve(hash)
+}
+
+func collectDiff(t *testing.T, oldTrie, newTrie *Trie) map[string]*TrieChange {
+	t.Helper()
+	changes := make(map[string]*TrieChange)
+	var lastKey []byte
+	err := Diff(oldTrie, newTrie, func(c *TrieChange) error {
+		if lastKey != nil && bytes.Compare(c.Key, lastKey) <= 0 {
+			t.Errorf("Keys out of order: %x after %x", c.Key, lastKey)
+		}
+		lastKey = c.Key
+		changes[string(c.Key)] = c
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	return changes
+}
+
+func TestDiffAgainstExpectedChanges(t *testing.T) {
+	rng := rand.New(rand.NewSource(9))
+	oldValues := make(map[string][]byte)
+	oldTrie := NewTrie(NewMemTrieStore())
+	for k := 0; k < 300; k++ {
+		key := fmt.Sprintf("key%d", rng.Intn(500))
+		value := makeValue(rng.Intn(60) + 1)
+		oldValues[key] = value
+		oldTrie = oldTrie.Put([]byte(key), value)
+	}
+
+	newValues := make(map[string][]byte)
+	for k, v := range oldValues {
+		newValues[k] = v
+	}
+	newTrie := oldTrie
+	for k := 0; k < 100; k++ {
+		key := fmt.Sprintf("key%d", rng.Intn(600))
+		if rng.Intn(3) == 0 {
+			delete(newValues, key)
+			newTrie = newTrie.Delete([]byte(key))
+			continue
+		}
+		value := append(makeValue(rng.Intn(60)+1), byte(k))
+		newValues[key] = value
+		newTrie = newTrie.Put([]byte(key), value)
+	}
+
+	changes := collectDiff(t, oldTrie, newTrie)
+
+	expected := 0
+	for key, newValue := range newValues {
+		oldValue, existed := oldValues[key]
+		change := changes[key]
+		switch {
+		case !existed:
+			expected++
+			if change == nil || change.Type != ChangeAdded || !bytes.Equal(change.NewValue, newValue) {
+				t.Errorf("Expected %s to be added, got %+v", key, change)
+			}
+		case !bytes.Equal(oldValue, newValue):
+			expected++
+			if change == nil || change.Type != ChangeModified ||
+				!bytes.Equal(change.OldValue, oldValue) || !bytes.Equal(change.NewValue, newValue) {
+				t.Errorf("Expected %s to be modified, got %+v", key, change)
+			}
+		case change != nil:
+			t.Errorf("Unexpected change for %s: %+v", key, change)
+		}
+	}
+	for key, oldValue := range oldValues {
+		if _, ok := newValues[key]; ok {
+			continue
+		}
+		expected++
+		change := changes[key]
+		if change == nil || change.Type != ChangeRemoved || !bytes.Equal(change.OldValue, oldValue) {
+			t.Errorf("Expected %s to be removed, got %+v", key, change)
+		}
+	}
+	if len(changes) != expected {
+		t.Errorf("Expected %d changes, got %d", expected, len(changes))
+	}
+}
+
+func TestDiffWithEmptyTrie(t *testing.T) {
+	trie := NewTrie(nil).Put([]byte("foo"), []byte("bar")).Put([]byte("food"), makeValue(40))
+
+	added := collectDiff(t, NewTrie(nil), trie)
+	if len(added) != 2 || added["foo"].Type != ChangeAdded || added["food"].Type != ChangeAdded {
+		t.Errorf("Expected two added keys, got %v", added)
+	}
+
+	removed := collectDiff(t, trie, nil)
+	if len(removed) != 2 || removed["foo"].Type != ChangeRemoved || !bytes.Equal(removed["food"].OldValue, makeValue(40)) {
+		t.Errorf("Expected two removed keys, got %v", removed)
+	}
+
+	if same := collectDiff(t, trie, trie); len(same) != 0 {
+		t.Errorf("Expected no changes, got %v", same)
+	}
+}
+
+func TestDiffLongKeys(t *testing.T) {
+	// Keys sharing a long prefix, so changes are reported deep in the walk
+	prefix := bytes.Repeat([]byte{0x5a}, 1024)
+	key := func(suffix ...byte) []byte {
+		return append(append([]byte{}, prefix...), suffix...)
+	}
+	oldTrie := NewTrie(nil).Put(key(0x01), []byte("one")).Put(key(0x02), []byte("two")).Put(key(0x03, 0x00), []byte("three"))
+	newTrie := NewTrie(nil).Put(key(0x01), []byte("one")).Put(key(0x02), []byte("2")).Put(key(0x04), makeValue(40))
+
+	changes := collectDiff(t, oldTrie, newTrie)
+	expected := map[string]ChangeType{
+		string(key(0x02)):       ChangeModified,
+		string(key(0x03, 0x00)): ChangeRemoved,
+		string(key(0x04)):       ChangeAdded,
+	}
+	if len(changes) != len(expected) {
+		t.Errorf("Expected %d changes, got %d", len(expected), len(changes))
+	}
+	for k, changeType := range expected {
+		if c := changes[k]; c == nil || c.Type != changeType {
+			t.Errorf("Expected %v for key ending in %x, got %v", changeType, k[len(prefix):], c)
+		}
+	}
+}
+
+func TestDiffRootsSkipsEqualSubtrees(t *testing.T) {
+	store := &countingTrieStore{MemTrieStore: NewMemTrieStore()}
+	trie := NewTrie(store)
+	for k := 0; k < 1000; k++ {
+		trie = trie.Put([]byte(fmt.Sprintf("key%d", k)), makeValue(k%32+1))
+	}
+	trie.Save(store)
+	oldRoot := trie.GetHash()
+
+	reopened, err := NewTrieFromStore(store, oldRoot)
+	if err != nil {
+		t.Fatalf("NewTrieFromStore failed: %v", err)
+	}
+	changed := reopened.Put([]byte("key500"), []byte("changed"))
+	changed.Save(store)
+	newRoot := changed.GetHash()
+
+	store.retrieved = 0
+	var changes []*TrieChange
+	err = DiffRoots(store, oldRoot, newRoot, func(c *TrieChange) error {
+		changes = append(changes, c)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("DiffRoots failed: %v", err)
+	}
+	if len(changes) != 1 || string(changes[0].Key) != "key500" || string(changes[0].NewValue) != "changed" {
+		t.Fatalf("Unexpected changes: %+v", changes)
+	}
+	// Only the two paths to key500 are loaded, not the 1000-node tries
+	if store.retrieved > 40 {
+		t.Errorf("Expected equal subtrees to be skipped, loaded %d nodes", store.retrieved)
+	}
+}
+
+func TestDiffStopsOnCallbackError(t *testing.T) {
+	oldTrie := NewTrie(nil)
+	newTrie := NewTrie(nil)
+	for k := 0; k < 10; k++ {
+		newTrie = newTrie.Put([]byte(fmt.Sprintf("key%d", k)), []byte("v"))
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err := Diff(oldTrie, newTrie, func(c *TrieChange) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("Expected Diff to stop after the first change, got %v after %d calls", err, calls)
+	}
+}
+
+func TestDiffRootsMissingNode(t *testing.T) {
+	store := NewMemTrieStore()
+	trie := NewTrie(store).Put([]byte("foo"), []byte("bar"))
+	trie.Save(store)
+
+	err := DiffRoots(store, trie.GetHash(), Keccak256([]byte("missing")), func(*TrieChange) error { return nil })
+	if err == nil {
+		t.Error("Expected an error for an unknown root")
+	}
+}
@@ -2,124 +2,179 @@ package rsktrie
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 
 	"github.com/ethereum/go-ethereum/rlp"
 )
 
+// ErrMalformedNode is returned for messages that are not a valid node
+// serialization: truncated fields, and for FromMessageStrict any encoding
+// RSKj would not produce.
+var ErrMalformedNode = errors.New("malformed trie node")
+
 // FromMessage deserializes a Trie node from its serialized format (RSKIP-107 format).
 // This is used to reconstruct trie nodes from proof data.
 func FromMessage(message []byte, store TrieStore) (*Trie, error) {
+	return fromMessage(message, store, false)
+}
+
+// FromMessageStrict deserializes a Trie node like FromMessage, but only
+// accepts the exact serialization RSKj would produce for the node. Besides
+// truncated fields it rejects trailing bytes, non-canonical lengths and
+// VarInts, reserved or inconsistent flags, embedded nodes that are too large
+// or have children, nodes without a value and fewer than two children, and
+// any message that does not re-serialize to the same bytes.
+//
+// Use it for untrusted input such as proofs: a node that hashes to a trusted
+// hash but decodes loosely could otherwise be read differently than RSKj
+// reads it.
+func FromMessageStrict(message []byte, store TrieStore) (*Trie, error) {
+	return fromMessage(message, store, true)
+}
+
+func fromMessage(message []byte, store TrieStore, strict bool) (*Trie, error) {
 	if len(message) == 0 {
 		return nil, fmt.Errorf("empty message")
 	}
 
 	// Check if it's the old Orchid format (first byte == 2 means arity)
 	if message[0] == 2 {
-		return fromMessageOrchid(message, store)
+		node, err := fromMessageOrchid(message, store)
+		if err != nil || !strict {
+			return node, err
+		}
+		if !bytes.Equal(node.ToMessageOrchid(message[1]&orchidFlagSecure != 0), message) {
+			return nil, fmt.Errorf("%w: orchid message does not re-serialize to the same bytes", ErrMalformedNode)
+		}
+		return node, nil
+	}
+
+	node, err := fromMessageRSKIP107(message, store, strict)
+	if err != nil || !strict {
+		return node, err
 	}
+	if !bytes.Equal(node.ToMessage(), message) {
+		return nil, fmt.Errorf("%w: message does not re-serialize to the same bytes", ErrMalformedNode)
+	}
+	return node, nil
+}
 
-	return fromMessageRSKIP107(message, store)
+// messageReader reads the fields of a serialized node. Unlike bytes.Reader it
+// never returns fewer bytes than asked for.
+type messageReader struct {
+	message []byte
+	pos     int
 }
 
-// fromMessageRSKIP107 deserializes using the RSKIP-107 format
-func fromMessageRSKIP107(message []byte, store TrieStore) (*Trie, error) {
-	if len(message) < 1 {
-		return nil, fmt.Errorf("message too short")
+func (r *messageReader) remaining() int {
+	return len(r.message) - r.pos
+}
+
+func (r *messageReader) readByte(field string) (byte, error) {
+	if r.remaining() < 1 {
+		return 0, fmt.Errorf("%w: truncated %s", ErrMalformedNode, field)
 	}
+	b := r.message[r.pos]
+	r.pos++
+	return b, nil
+}
 
-	buf := bytes.NewReader(message)
+// readBytes returns a copy of the next n bytes
+func (r *messageReader) readBytes(n int, field string) ([]byte, error) {
+	if n < 0 || r.remaining() < n {
+		return nil, fmt.Errorf("%w: truncated %s: need %d bytes, have %d", ErrMalformedNode, field, n, r.remaining())
+	}
+	b := make([]byte, n)
+	copy(b, r.message[r.pos:])
+	r.pos += n
+	return b, nil
+}
 
-	flags, err := buf.ReadByte()
+func (r *messageReader) readVarInt(field string, strict bool) (VarInt, error) {
+	vi, err := ReadVarInt(r.message, r.pos)
 	if err != nil {
-		return nil, fmt.Errorf("read flags: %w", err)
+		return VarInt{}, fmt.Errorf("%w: truncated %s: %v", ErrMalformedNode, field, err)
+	}
+	if strict && NewVarInt(vi.Value).Size != vi.Size {
+		return VarInt{}, fmt.Errorf("%w: non-canonical %s VarInt %x", ErrMalformedNode, field, r.message[r.pos:r.pos+vi.Size])
+	}
+	r.pos += vi.Size
+	return vi, nil
+}
+
+// RSKIP-107 message flags
+const (
+	flagsVersionMask  = 0b11000000
+	flagsVersion      = 0b01000000
+	flagLongValue     = 0b00100000
+	flagSharedPath    = 0b00010000
+	flagLeftPresent   = 0b00001000
+	flagRightPresent  = 0b00000100
+	flagLeftEmbedded  = 0b00000010
+	flagRightEmbedded = 0b00000001
+)
+
+// fromMessageRSKIP107 deserializes using the RSKIP-107 format
+func fromMessageRSKIP107(message []byte, store TrieStore, strict bool) (*Trie, error) {
+	buf := &messageReader{message: message}
+
+	flags, err := buf.readByte("flags")
+	if err != nil {
+		return nil, err
 	}
 
 	// Parse flags
-	hasLongVal := (flags & 0b00100000) == 0b00100000
-	sharedPrefixPresent := (flags & 0b00010000) == 0b00010000
-	leftNodePresent := (flags & 0b00001000) == 0b00001000
-	rightNodePresent := (flags & 0b00000100) == 0b00000100
-	leftNodeEmbedded := (flags & 0b00000010) == 0b00000010
-	rightNodeEmbedded := (flags & 0b00000001) == 0b00000001
+	hasLongVal := flags&flagLongValue != 0
+	sharedPrefixPresent := flags&flagSharedPath != 0
+	leftNodePresent := flags&flagLeftPresent != 0
+	rightNodePresent := flags&flagRightPresent != 0
+	leftNodeEmbedded := flags&flagLeftEmbedded != 0
+	rightNodeEmbedded := flags&flagRightEmbedded != 0
+
+	if strict {
+		if flags&flagsVersionMask != flagsVersion {
+			return nil, fmt.Errorf("%w: unknown version in flags %08b", ErrMalformedNode, flags)
+		}
+		if (leftNodeEmbedded && !leftNodePresent) || (rightNodeEmbedded && !rightNodePresent) {
+			return nil, fmt.Errorf("%w: absent child marked embedded in flags %08b", ErrMalformedNode, flags)
+		}
+	}
 
 	// Deserialize shared path
 	sharedPath := TrieKeySliceEmpty()
 	if sharedPrefixPresent {
-		sp, err := deserializeSharedPath(buf)
+		sp, err := deserializeSharedPath(buf, strict)
 		if err != nil {
 			return nil, fmt.Errorf("deserialize shared path: %w", err)
 		}
 		sharedPath = sp
 	}
 
-	// Deserialize left node reference
-	var left *NodeReference = NodeReferenceEmpty()
+	// Deserialize child node references
+	left := NodeReferenceEmpty()
 	if leftNodePresent {
-		if leftNodeEmbedded {
-			lengthByte, err := buf.ReadByte()
-			if err != nil {
-				return nil, fmt.Errorf("read left embedded length: %w", err)
-			}
-			embeddedNode := make([]byte, lengthByte)
-			if _, err := buf.Read(embeddedNode); err != nil {
-				return nil, fmt.Errorf("read left embedded node: %w", err)
-			}
-			node, err := fromMessageRSKIP107(embeddedNode, store)
-			if err != nil {
-				return nil, fmt.Errorf("parse left embedded node: %w", err)
-			}
-			left = NewNodeReference(store, node, nil)
-		} else {
-			hash := make([]byte, 32)
-			if _, err := buf.Read(hash); err != nil {
-				return nil, fmt.Errorf("read left hash: %w", err)
-			}
-			left = NewNodeReference(store, nil, hash)
+		left, err = deserializeNodeReference(buf, store, leftNodeEmbedded, "left", strict)
+		if err != nil {
+			return nil, err
 		}
 	}
-
-	// Deserialize right node reference
-	var right *NodeReference = NodeReferenceEmpty()
+	right := NodeReferenceEmpty()
 	if rightNodePresent {
-		if rightNodeEmbedded {
-			lengthByte, err := buf.ReadByte()
-			if err != nil {
-				return nil, fmt.Errorf("read right embedded length: %w", err)
-			}
-			embeddedNode := make([]byte, lengthByte)
-			if _, err := buf.Read(embeddedNode); err != nil {
-				return nil, fmt.Errorf("read right embedded node: %w", err)
-			}
-			node, err := fromMessageRSKIP107(embeddedNode, store)
-			if err != nil {
-				return nil, fmt.Errorf("parse right embedded node: %w", err)
-			}
-			right = NewNodeReference(store, node, nil)
-		} else {
-			hash := make([]byte, 32)
-			if _, err := buf.Read(hash); err != nil {
-				return nil, fmt.Errorf("read right hash: %w", err)
-			}
-			right = NewNodeReference(store, nil, hash)
+		right, err = deserializeNodeReference(buf, store, rightNodeEmbedded, "right", strict)
+		if err != nil {
+			return nil, err
 		}
 	}
 
 	// Deserialize children size (if non-terminal)
 	var childrenSize *VarInt
 	if leftNodePresent || rightNodePresent {
-		// Read remaining bytes to parse VarInt
-		remaining := make([]byte, buf.Len())
-		n, _ := buf.Read(remaining)
-		remaining = remaining[:n]
-
-		vi, err := ReadVarInt(remaining, 0)
+		vi, err := buf.readVarInt("children size", strict)
 		if err != nil {
-			return nil, fmt.Errorf("read children size: %w", err)
+			return nil, err
 		}
 		childrenSize = &vi
-		// Create new reader from remaining data after VarInt
-		buf = bytes.NewReader(remaining[vi.Size:])
 	}
 
 	// Deserialize value
@@ -128,31 +183,92 @@ func fromMessageRSKIP107(message []byte, store TrieStore) (*Trie, error) {
 	var valueHash []byte
 
 	if hasLongVal {
-		valueHash = make([]byte, 32)
-		if _, err := buf.Read(valueHash); err != nil {
-			return nil, fmt.Errorf("read value hash: %w", err)
+		if valueHash, err = buf.readBytes(32, "value hash"); err != nil {
+			return nil, err
 		}
-		lvalueBytes := make([]byte, 3)
-		if _, err := buf.Read(lvalueBytes); err != nil {
-			return nil, fmt.Errorf("read value length: %w", err)
+		lvalueBytes, err := buf.readBytes(Uint24Bytes, "value length")
+		if err != nil {
+			return nil, err
 		}
 		valueLength = DecodeUint24(lvalueBytes, 0)
 		// Long value - would need to retrieve from store
 		// value remains nil
-	} else {
-		remaining := buf.Len()
-		if remaining > 0 {
-			value = make([]byte, remaining)
-			if _, err := buf.Read(value); err != nil {
-				return nil, fmt.Errorf("read value: %w", err)
-			}
-			valueLength = Uint24(len(value))
+		if strict && buf.remaining() > 0 {
+			return nil, fmt.Errorf("%w: %d trailing bytes after long value", ErrMalformedNode, buf.remaining())
+		}
+	} else if buf.remaining() > 0 {
+		value, _ = buf.readBytes(buf.remaining(), "value")
+		valueLength = Uint24(len(value))
+	}
+
+	if strict {
+		if err := checkNodeShape(hasLongVal, len(value), valueLength, left, right, childrenSize); err != nil {
+			return nil, err
 		}
 	}
 
 	return NewTrieFull(store, sharedPath, value, left, right, valueLength, valueHash, childrenSize), nil
 }
 
+// deserializeNodeReference reads a child reference: a 32-byte hash, or a
+// one-byte length and the embedded node.
+func deserializeNodeReference(buf *messageReader, store TrieStore, embedded bool, side string, strict bool) (*NodeReference, error) {
+	if !embedded {
+		hash, err := buf.readBytes(32, side+" hash")
+		if err != nil {
+			return nil, err
+		}
+		return NewNodeReference(store, nil, hash), nil
+	}
+
+	lengthByte, err := buf.readByte(side + " embedded length")
+	if err != nil {
+		return nil, err
+	}
+	if strict && int(lengthByte) > MaxEmbeddedNodeSizeInBytes {
+		return nil, fmt.Errorf("%w: %s embedded node of %d bytes", ErrMalformedNode, side, lengthByte)
+	}
+	embeddedNode, err := buf.readBytes(int(lengthByte), side+" embedded node")
+	if err != nil {
+		return nil, err
+	}
+	// As in RSKj, embedded nodes are always RSKIP-107 nodes, whatever their
+	// first byte
+	node, err := fromMessageRSKIP107(embeddedNode, store, strict)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s embedded node: %w", side, err)
+	}
+	if strict && !node.IsEmbeddable() {
+		return nil, fmt.Errorf("%w: %s embedded node is not embeddable", ErrMalformedNode, side)
+	}
+	return NewNodeReference(store, node, nil), nil
+}
+
+// checkNodeShape rejects value and children combinations that RSKj never
+// serializes: short values that should be long and vice versa, nodes without
+// a value that are not a split between two children, since RSKj coalesces
+// them on delete, and children sizes that disagree with embedded children.
+func checkNodeShape(hasLongVal bool, shortValueLength int, valueLength Uint24, left, right *NodeReference, childrenSize *VarInt) error {
+	if hasLongVal && valueLength <= 32 {
+		return fmt.Errorf("%w: long value of %d bytes", ErrMalformedNode, valueLength)
+	}
+	if !hasLongVal && shortValueLength > 32 {
+		return fmt.Errorf("%w: embedded value of %d bytes", ErrMalformedNode, shortValueLength)
+	}
+	if valueLength == 0 && (left.IsEmpty() || right.IsEmpty()) {
+		return fmt.Errorf("%w: node without value has fewer than two children", ErrMalformedNode)
+	}
+
+	// The sizes of subtrees only known by hash cannot be checked here
+	if childrenSize == nil || left.isHashOnly() || right.isHashOnly() {
+		return nil
+	}
+	if expected := uint64(left.ReferenceSize() + right.ReferenceSize()); childrenSize.Value != expected {
+		return fmt.Errorf("%w: children size %d, embedded children take %d", ErrMalformedNode, childrenSize.Value, expected)
+	}
+	return nil
+}
+
 // fromMessageOrchid deserializes using the pre-RSKIP-107 format
 func fromMessageOrchid(message []byte, store TrieStore) (*Trie, error) {
 	if len(message) < 6 {
@@ -251,8 +367,11 @@ func fromMessageOrchid(message []byte, store TrieStore) (*Trie, error) {
 // - If 1 <= lshared <= 32: byte = lshared - 1 (so byte 0-31 means length 1-32)
 // - If 160 <= lshared <= 382: byte = lshared - 128 (so byte 32-254 means length 160-382)
 // - If byte == 255: followed by VarInt
-func deserializeSharedPath(buf *bytes.Reader) (*TrieKeySlice, error) {
-	lengthByte, err := buf.ReadByte()
+//
+// In strict mode the VarInt form is only accepted for lengths the short forms
+// cannot encode, and the padding bits of the encoded path must be zero.
+func deserializeSharedPath(buf *messageReader, strict bool) (*TrieKeySlice, error) {
+	lengthByte, err := buf.readByte("shared path length")
 	if err != nil {
 		return nil, err
 	}
@@ -267,17 +386,18 @@ func deserializeSharedPath(buf *bytes.Reader) (*TrieKeySlice, error) {
 		pathLen = int(lengthByte) + 128
 	} else {
 		// byte == 255: read VarInt
-		remaining := make([]byte, buf.Len())
-		if _, err := buf.Read(remaining); err != nil {
+		vi, err := buf.readVarInt("shared path length", strict)
+		if err != nil {
 			return nil, err
 		}
-		vi, err := ReadVarInt(remaining, 0)
-		if err != nil {
-			return nil, fmt.Errorf("read varint for path length: %w", err)
+		// Bound the length before converting it: the path must fit in the message
+		if vi.Value > uint64(8*buf.remaining()) {
+			return nil, fmt.Errorf("%w: truncated shared path of %d bits", ErrMalformedNode, vi.Value)
 		}
 		pathLen = int(vi.Value)
-		// Put back the remaining bytes after VarInt
-		buf = bytes.NewReader(remaining[vi.Size:])
+		if strict && (pathLen == 0 || CalculateVarIntSize(pathLen) == 1) {
+			return nil, fmt.Errorf("%w: shared path length %d encoded as VarInt", ErrMalformedNode, pathLen)
+		}
 	}
 
 	encodedLen := calculateEncodedLength(pathLen)
@@ -285,9 +405,12 @@ func deserializeSharedPath(buf *bytes.Reader) (*TrieKeySlice, error) {
 		return TrieKeySliceEmpty(), nil
 	}
 
-	encodedBytes := make([]byte, encodedLen)
-	if _, err := buf.Read(encodedBytes); err != nil {
-		return nil, fmt.Errorf("read encoded path: %w", err)
+	encodedBytes, err := buf.readBytes(encodedLen, "encoded path")
+	if err != nil {
+		return nil, err
+	}
+	if padding := encodedLen*8 - pathLen; strict && encodedBytes[encodedLen-1]&(1<<padding-1) != 0 {
+		return nil, fmt.Errorf("%w: non-zero padding bits in shared path", ErrMalformedNode)
 	}
 
 	return TrieKeySliceFromEncodedFull(encodedBytes, pathLen), nil
@@ -310,5 +433,5 @@ func FromRLPProof(rlpEncoded []byte, store TrieStore) (*Trie, error) {
 		return nil, fmt.Errorf("RLP decode proof: %w", err)
 	}
 
-	return FromMessage(serializedNode, store)
+	return FromMessageStrict(serializedNode, store)
 }
@@ -0,0 +1,172 @@
+package rsktrie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// strictTestTrie has short and long values, embedded and hash-referenced
+// children, and shared paths using each length encoding.
+func strictTestTrie() *Trie {
+	trie := NewTrie(NewMemTrieStore())
+	for k := 0; k < 50; k++ {
+		trie = trie.Put([]byte(fmt.Sprintf("key%d", k)), makeValue(k%40+1))
+	}
+	long := bytes.Repeat([]byte{0xa5}, 40)
+	trie = trie.Put(long, []byte{0x01})
+	trie = trie.Put(append(long[:20:20], 0x00), makeValue(3))
+	return trie.Put([]byte{0x00}, []byte{0x2a}).Put([]byte{0x80}, []byte{0x2b})
+}
+
+// nodeMessages returns the messages of all nodes of trie
+func nodeMessages(trie *Trie) [][]byte {
+	var messages [][]byte
+	for it := trie.GetPreOrderIterator(); it.HasNext(); {
+		messages = append(messages, it.Next().GetNode().ToMessage())
+	}
+	return messages
+}
+
+func TestFromMessageStrictAcceptsTrieNodes(t *testing.T) {
+	for i, message := range nodeMessages(strictTestTrie()) {
+		node, err := FromMessageStrict(message, nil)
+		if err != nil {
+			t.Fatalf("Node %d (%x): %v", i, message, err)
+		}
+		if !bytes.Equal(node.GetHash(), Keccak256(message)) {
+			t.Errorf("Node %d: hash mismatch", i)
+		}
+	}
+
+	leaf := NewTrie(nil).Put([]byte("key"), []byte("value"))
+	for _, secure := range []bool{false, true} {
+		if _, err := FromMessageStrict(leaf.ToMessageOrchid(secure), nil); err != nil {
+			t.Errorf("Orchid leaf (secure=%v): %v", secure, err)
+		}
+	}
+}
+
+func TestFromMessageStrictRejectsMalformedNodes(t *testing.T) {
+	// flags 0x50: shared path of 8 bits, value 0x2a
+	leaf := []byte{0x50, 0x07, 0x01, 0x2a}
+	if m := NewTrie(nil).Put([]byte{0x01}, []byte{0x2a}).ToMessage(); !bytes.Equal(m, leaf) {
+		t.Fatalf("Unexpected leaf message %x", m)
+	}
+
+	// Two embedded leaves and their children size
+	split := NewTrie(nil).Put([]byte{0x00}, []byte{0x2a}).Put([]byte{0x80}, []byte{0x2b}).ToMessage()
+	if split[0] != 0x4f {
+		t.Fatalf("Expected embedded children, got flags %08b", split[0])
+	}
+	splitSize := split[len(split)-1]
+	withoutSize := split[: len(split)-1 : len(split)-1]
+
+	longValue := NewTrie(nil).Put([]byte{0x01}, makeValue(40)).ToMessage()
+	shortenedLong := append(append([]byte{}, longValue[:len(longValue)-3]...), 0x00, 0x00, 0x10)
+
+	oneChild := NewTrieFull(nil, TrieKeySliceEmpty(), nil,
+		NewNodeReference(nil, NewTrie(nil).Put([]byte{0x01}, []byte{0x2a}), nil), NodeReferenceEmpty(), 0, nil, nil).ToMessage()
+
+	orchidUnknownFlag := NewTrie(nil).Put([]byte("key"), []byte("value")).ToMessageOrchid(false)
+	orchidUnknownFlag[1] |= 0x04
+
+	// Embedded nodes are always RSKIP-107 nodes, even if they start like an Orchid node
+	orchidLeaf := NewTrie(nil).Put([]byte("key"), []byte("value")).ToMessageOrchid(false)
+	orchidEmbedded := append([]byte{0x4a, byte(len(orchidLeaf))}, orchidLeaf...)
+	orchidEmbedded = append(orchidEmbedded, byte(len(orchidLeaf)+1), 0x2a)
+
+	tests := []struct {
+		name      string
+		message   []byte
+		lenientOK bool
+	}{
+		{"truncated child hash", []byte{0x48, 0x01, 0x02}, false},
+		{"truncated shared path", []byte{0x50, 0x1f, 0x01}, false},
+		{"truncated embedded node", []byte{0x4a, 0x05, 0x40, 0x01}, false},
+		{"truncated long value", longValue[:len(longValue)-1], false},
+		{"huge shared path length", []byte{0x50, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}, false},
+		{"trailing bytes after long value", append(append([]byte{}, longValue...), 0x00), true},
+		{"reserved flag bit", []byte{0xd0, 0x07, 0x01, 0x2a}, true},
+		{"missing version flag", []byte{0x10, 0x07, 0x01, 0x2a}, true},
+		{"absent child marked embedded", []byte{0x52, 0x07, 0x01, 0x2a}, true},
+		{"shared path length as VarInt", []byte{0x50, 0xff, 0x08, 0x01, 0x2a}, true},
+		{"non-zero padding bits", []byte{0x50, 0x02, 0x21, 0x2a}, true},
+		{"non-canonical children size", append(append([]byte{}, withoutSize...), 0xfd, splitSize, 0x00), true},
+		{"wrong children size", append(append([]byte{}, withoutSize...), splitSize+1), true},
+		{"long value flag on short value", shortenedLong, true},
+		{"short value over 32 bytes", append([]byte{0x40}, makeValue(33)...), true},
+		{"node without value or children", []byte{0x50, 0x07, 0x01}, true},
+		{"node without value and one child", oneChild, true},
+		{"oversized embedded node", append([]byte{0x4a, 45, 0x40}, makeValue(44)...), false},
+		{"embedded node with children", append(append([]byte{0x4f, byte(len(split))}, split...), 0x04, 0x40, 0x01, 0x02, 0x03, 0x2a), true},
+		{"unknown orchid flag", orchidUnknownFlag, true},
+		{"orchid embedded node", orchidEmbedded, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := FromMessageStrict(tt.message, nil); !errors.Is(err, ErrMalformedNode) {
+				t.Errorf("FromMessageStrict(%x): expected ErrMalformedNode, got %v", tt.message, err)
+			}
+			if _, err := FromMessage(tt.message, nil); (err == nil) != tt.lenientOK {
+				t.Errorf("FromMessage(%x): expected success=%v, got %v", tt.message, tt.lenientOK, err)
+			}
+		})
+	}
+}
+
+// FuzzFromMessage checks that decoding never panics and that whatever strict
+// decoding accepts is the canonical serialization of the decoded node.
+func FuzzFromMessage(f *testing.F) {
+	for _, message := range nodeMessages(strictTestTrie()) {
+		f.Add(message)
+	}
+	f.Add([]byte{0x50, 0xff, 0x08, 0x01, 0x2a})
+	f.Add(NewTrie(nil).Put([]byte("key"), []byte("value")).ToMessageOrchid(true))
+
+	f.Fuzz(func(t *testing.T, message []byte) {
+		lenient, lenientErr := FromMessage(message, nil)
+		strict, err := FromMessageStrict(message, nil)
+		if err != nil {
+			return
+		}
+		if lenientErr != nil {
+			t.Fatalf("Strict decoding accepted what FromMessage rejects: %v", lenientErr)
+		}
+		if message[0] == 2 {
+			if orchid := strict.ToMessageOrchid(message[1]&orchidFlagSecure != 0); !bytes.Equal(orchid, message) {
+				t.Fatalf("Accepted Orchid node re-serializes to %x", orchid)
+			}
+			return
+		}
+		if !bytes.Equal(strict.ToMessage(), message) {
+			t.Fatalf("Accepted node re-serializes to %x", strict.ToMessage())
+		}
+		if !bytes.Equal(lenient.GetHash(), Keccak256(message)) {
+			t.Fatal("FromMessage decodes the node differently")
+		}
+	})
+}
+
+// FuzzFromMessageStrictTrie checks that strict decoding accepts every node of
+// tries built from arbitrary keys and values.
+func FuzzFromMessageStrictTrie(f *testing.F) {
+	f.Add([]byte("key1"), []byte("value1"), []byte("key2"), bytes.Repeat([]byte{0x01}, 40))
+	f.Add([]byte{0x00}, []byte{0x01}, []byte{0x80}, []byte{0x02})
+	f.Add(bytes.Repeat([]byte{0xff}, 50), []byte{0x01}, bytes.Repeat([]byte{0xff}, 49), []byte{0x02})
+
+	f.Fuzz(func(t *testing.T, key1, value1, key2, value2 []byte) {
+		base := strictTestTrie()
+		trie := base.Put(key1, value1).Put(key2, value2)
+		if len(key1) > 0 {
+			trie = trie.Put(append(key1, key2...), value2)
+		}
+		for i, message := range nodeMessages(trie) {
+			if _, err := FromMessageStrict(message, nil); err != nil {
+				t.Fatalf("Node %d (%x): %v", i, message, err)
+			}
+		}
+	})
+}
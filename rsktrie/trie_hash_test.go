@@ -2,7 +2,10 @@ package rsktrie
 
 import (
 	"bytes"
+	"fmt"
 	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
 )
 
 func TestGetNotNullHashOnEmptyTrie(t *testing.T) {
@@ -117,3 +120,284 @@ func TestTriesWithDifferentKeyValuesHaveDifferentHashes(t *testing.T) {
 		t.Error("Hashes should be different")
 	}
 }
+
+func TestMessageLengthMatchesSerialization(t *testing.T) {
+	trie := NewTrie(nil)
+	// Short and long values, and shared paths of every length encoding
+	for i := 0; i < 40; i++ {
+		trie = trie.Put([]byte(fmt.Sprintf("k%d", i)), makeValue(i*3+1))
+	}
+	prefix := bytes.Repeat([]byte{0xAA}, 30)
+	trie = trie.Put(prefix, makeValue(10))
+	trie = trie.Put(append(prefix, make([]byte, 8)...), makeValue(20))             // 63-bit path
+	trie = trie.Put(append(prefix, bytes.Repeat([]byte{1}, 30)...), makeValue(50)) // 239-bit path
+	trie = trie.Put(append(prefix, bytes.Repeat([]byte{2}, 60)...), makeValue(5))  // 479-bit path
+
+	// Lengths are computed before any node is serialized
+	var nodes []*Trie
+	var lengths []int
+	for it := trie.GetPreOrderIterator(); it.HasNext(); {
+		node := it.Next().GetNode()
+		nodes = append(nodes, node)
+		lengths = append(lengths, node.GetMessageLength())
+	}
+	for i, node := range nodes {
+		if want := len(node.ToMessage()); lengths[i] != want {
+			t.Errorf("Node %d: message length %d, serialized %d bytes", i, lengths[i], want)
+		}
+	}
+}
+
+// withRecomputedChildrenSize copies a trie dropping every cached children size,
+// so that GetChildrenSize computes them from scratch like RSKj's getChildrenSize.
+func withRecomputedChildrenSize(trie *Trie) *Trie {
+	copyRef := func(ref *NodeReference) *NodeReference {
+		node := ref.GetNode()
+		if node == nil {
+			return NodeReferenceEmpty()
+		}
+		return NewNodeReference(trie.store, withRecomputedChildrenSize(node), nil)
+	}
+	return NewTrieFull(trie.store, trie.sharedPath, trie.value, copyRef(trie.left), copyRef(trie.right), trie.valueLength, trie.valueHash, nil)
+}
+
+func assertChildrenSizeIsConsistent(t *testing.T, trie *Trie) {
+	t.Helper()
+	expected := withRecomputedChildrenSize(trie)
+
+	it := trie.GetPreOrderIterator()
+	expectedIt := expected.GetPreOrderIterator()
+	for it.HasNext() {
+		el := it.Next()
+		expectedEl := expectedIt.Next()
+		got := el.GetNode().GetChildrenSize().Value
+		want := expectedEl.GetNode().GetChildrenSize().Value
+		if got != want {
+			t.Fatalf("Children size mismatch at %s: got %d, want %d", el, got, want)
+		}
+	}
+
+	if !bytes.Equal(trie.GetHash(), expected.GetHash()) {
+		t.Fatalf("Hash mismatch: got %x, want %x", trie.GetHash(), expected.GetHash())
+	}
+}
+
+func TestChildrenSizeAfterPutAndSplit(t *testing.T) {
+	trie := NewTrie(NewMemTrieStore())
+
+	trie = trie.Put([]byte("foo"), []byte("bar"))
+	assertChildrenSizeIsConsistent(t, trie)
+
+	// Split with an embedded child
+	trie = trie.Put([]byte("fox"), []byte("baz"))
+	assertChildrenSizeIsConsistent(t, trie)
+
+	// Split with a long value child
+	trie = trie.Put([]byte("bar"), makeValue(100))
+	assertChildrenSizeIsConsistent(t, trie)
+
+	// Replace a long value below an existing node
+	trie = trie.Put([]byte("bar"), makeValue(200))
+	assertChildrenSizeIsConsistent(t, trie)
+
+	// Put a value on an inner node
+	trie = trie.Put([]byte("fo"), []byte("42"))
+	assertChildrenSizeIsConsistent(t, trie)
+}
+
+func TestChildrenSizeAfterMixedInsertsAndDeletes(t *testing.T) {
+	trie := NewTrie(NewMemTrieStore())
+
+	for k := 0; k < 200; k++ {
+		key := []byte(fmt.Sprintf("key%d", k*7%200))
+		// Mix short, embeddable and long values
+		trie = trie.Put(key, makeValue(k%64+1))
+		if k%25 == 0 {
+			assertChildrenSizeIsConsistent(t, trie)
+		}
+	}
+	assertChildrenSizeIsConsistent(t, trie)
+
+	for k := 0; k < 200; k += 3 {
+		trie = trie.Delete([]byte(fmt.Sprintf("key%d", k)))
+		if k%25 == 0 {
+			assertChildrenSizeIsConsistent(t, trie)
+		}
+	}
+	assertChildrenSizeIsConsistent(t, trie)
+
+	for k := 0; k < 200; k += 2 {
+		trie = trie.Put([]byte(fmt.Sprintf("key%d", k)), makeValue(k%40+1))
+	}
+	assertChildrenSizeIsConsistent(t, trie)
+}
+
+func TestHashAfterDeletesMatchesTrieBuiltWithoutKeys(t *testing.T) {
+	trie := NewTrie(NewMemTrieStore())
+	expected := NewTrie(NewMemTrieStore())
+
+	for k := 0; k < 150; k++ {
+		key := []byte(fmt.Sprintf("%d", k))
+		trie = trie.Put(key, makeValue(k%50+1))
+		if k%3 != 0 {
+			expected = expected.Put(key, makeValue(k%50+1))
+		}
+	}
+	for k := 0; k < 150; k += 3 {
+		trie = trie.Delete([]byte(fmt.Sprintf("%d", k)))
+	}
+
+	if !bytes.Equal(trie.GetHash(), expected.GetHash()) {
+		t.Errorf("Hash mismatch: got %x, want %x", trie.GetHash(), expected.GetHash())
+	}
+}
+
+func TestHashAfterMixedUpdatesMatchesRSKj(t *testing.T) {
+	// storageHash RSKj returned for the SimpleStorage contract after its
+	// constructor (misc/account-proof-examples.md): slot 0 holds 42, slot 1 an
+	// address and the mapping at slot 2 holds 100 and 200 for keys 0 and 1
+	storageHash := common.HexToHash("0x4ac668a682701c5e73038c48163ed1dfb8e75d8f90cf0ad54cea2285a32a5e98")
+	contract := common.HexToAddress("0x77045E71a7A2c50903d88e564cD72fab11e82051")
+	owner := common.HexToAddress("0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826")
+
+	mapper := NewTrieKeyMapper()
+	slot := func(n int) common.Hash { return common.BytesToHash([]byte{byte(n)}) }
+	mappingSlot := func(key int) common.Hash {
+		return common.BytesToHash(Keccak256(append(slot(key).Bytes(), slot(2).Bytes()...)))
+	}
+	storageKey := func(s common.Hash) []byte { return mapper.GetAccountStorageKey(contract, s) }
+	expected := map[common.Hash][]byte{
+		slot(0):        {42},
+		slot(1):        owner.Bytes(),
+		mappingSlot(0): {100},
+		mappingSlot(1): {200},
+	}
+	// The contract node and its long code are siblings of the storage node
+	newContractTrie := func() *Trie {
+		return NewTrie(NewMemTrieStore()).
+			Put(mapper.GetAccountKey(contract), makeValue(10)).
+			Put(mapper.GetCodeKey(contract), makeValue(300)).
+			Put(mapper.GetAccountStoragePrefixKey(contract), []byte{0x01})
+	}
+
+	tests := []struct {
+		name   string
+		update func(trie *Trie) *Trie
+	}{
+		{"inserts only", func(trie *Trie) *Trie {
+			for _, s := range []common.Hash{slot(0), slot(1), mappingSlot(0), mappingSlot(1)} {
+				trie = trie.Put(storageKey(s), expected[s])
+			}
+			return trie
+		}},
+		{"overwrites and deletes of long values", func(trie *Trie) *Trie {
+			trie = trie.Put(storageKey(mappingSlot(1)), makeValue(100)).
+				Put(storageKey(slot(3)), makeValue(33)).
+				Put(storageKey(slot(0)), []byte{7}).
+				Put(storageKey(mappingSlot(0)), expected[mappingSlot(0)]).
+				Put(storageKey(slot(1)), expected[slot(1)]).
+				Delete(storageKey(slot(0))).
+				Put(storageKey(mappingSlot(1)), expected[mappingSlot(1)]).
+				Delete(storageKey(slot(3)))
+			return trie.Put(storageKey(slot(0)), expected[slot(0)])
+		}},
+		{"deletes down from a larger storage", func(trie *Trie) *Trie {
+			for n := 0; n < 64; n++ {
+				// Short, embeddable and long values
+				trie = trie.Put(storageKey(slot(n)), makeValue(n%40+1))
+				trie = trie.Put(storageKey(mappingSlot(n)), makeValue(n%40+1))
+			}
+			for n := 63; n >= 0; n-- {
+				for _, s := range []common.Hash{slot(n), mappingSlot(n)} {
+					if value, ok := expected[s]; ok {
+						trie = trie.Put(storageKey(s), value)
+					} else {
+						trie = trie.Delete(storageKey(s))
+					}
+				}
+			}
+			return trie
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trie := tt.update(newContractTrie())
+			node := trie.Find(TrieKeySliceFromKey(mapper.GetAccountStoragePrefixKey(contract)))
+			if node == nil {
+				t.Fatal("Storage node not found")
+			}
+			if hash := common.BytesToHash(node.GetHash()); hash != storageHash {
+				t.Errorf("Expected storage hash %s, got %s", storageHash.Hex(), hash.Hex())
+			}
+		})
+	}
+}
+
+func TestToMessageOrchidLeaf(t *testing.T) {
+	trie := NewTrie(nil).Put([]byte("foo"), []byte("bar"))
+
+	// arity | flags | child bits | lshared = 24 | "foo" | "bar"
+	expected := []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x18, 'f', 'o', 'o', 'b', 'a', 'r'}
+	if msg := trie.ToMessageOrchid(false); !bytes.Equal(msg, expected) {
+		t.Errorf("Orchid message: got %x, want %x", msg, expected)
+	}
+
+	expected[1] = 0x01
+	if msg := trie.ToMessageOrchid(true); !bytes.Equal(msg, expected) {
+		t.Errorf("Secure Orchid message: got %x, want %x", msg, expected)
+	}
+
+	if bytes.Equal(trie.GetHashOrchid(false), trie.GetHashOrchid(true)) {
+		t.Error("Expected the secure flag to change the Orchid hash")
+	}
+	if !bytes.Equal(trie.GetHashOrchid(false), Keccak256(trie.ToMessageOrchid(false))) {
+		t.Error("Orchid hash is not the hash of the Orchid message")
+	}
+}
+
+func TestToMessageOrchidLongValue(t *testing.T) {
+	value := makeValue(100)
+	trie := NewTrie(nil).Put([]byte("foo"), value)
+
+	msg := trie.ToMessageOrchid(false)
+	if msg[1] != 0x02 {
+		t.Errorf("Expected long value flag, got flags %02x", msg[1])
+	}
+	if !bytes.Equal(msg[len(msg)-32:], Keccak256(value)) {
+		t.Error("Expected the message to end with the value hash")
+	}
+}
+
+func TestToMessageOrchidRoundTrip(t *testing.T) {
+	trie := NewTrie(nil)
+	for k := 0; k < 50; k++ {
+		trie = trie.Put([]byte(fmt.Sprintf("key%d", k)), makeValue(k%32+1))
+	}
+	if bytes.Equal(trie.GetHashOrchid(false), trie.GetHash()) {
+		t.Fatal("Expected Orchid and RSKIP-107 root hashes to differ")
+	}
+
+	it := trie.GetPreOrderIterator()
+	for it.HasNext() {
+		node := it.Next().GetNode()
+		decoded, err := FromMessage(node.ToMessageOrchid(false), nil)
+		if err != nil {
+			t.Fatalf("FromMessage failed: %v", err)
+		}
+		if !bytes.Equal(decoded.GetSharedPath().Encode(), node.GetSharedPath().Encode()) ||
+			decoded.GetSharedPath().Length() != node.GetSharedPath().Length() {
+			t.Error("Shared path mismatch")
+		}
+		if !bytes.Equal(decoded.GetValue(), node.GetValue()) {
+			t.Errorf("Value mismatch: got %x, want %x", decoded.GetValue(), node.GetValue())
+		}
+		// Children are referenced by their Orchid hashes
+		if !bytes.Equal(decoded.GetLeft().GetHash(), node.GetLeft().GetHashOrchid(false)) {
+			t.Error("Left child hash mismatch")
+		}
+		if !bytes.Equal(decoded.GetRight().GetHash(), node.GetRight().GetHashOrchid(false)) {
+			t.Error("Right child hash mismatch")
+		}
+	}
+}
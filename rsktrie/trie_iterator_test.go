@@ -1,8 +1,14 @@
 package rsktrie
 
 import (
+	"bytes"
 	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"sort"
 	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
 )
 
 func TestIterationElement(t *testing.T) {
@@ -105,3 +111,134 @@ func TestPostOrderIterator(t *testing.T) {
 		t.Errorf("Count mismatch")
 	}
 }
+
+func collectRange(t *testing.T, it *RangeIterator) []*KeyValue {
+	t.Helper()
+	var kvs []*KeyValue
+	for it.HasNext() {
+		kvs = append(kvs, it.Next())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Iteration failed: %v", err)
+	}
+	return kvs
+}
+
+func TestRangeIteratorMatchesSortedKeys(t *testing.T) {
+	rng := rand.New(rand.NewSource(10))
+	values := make(map[string][]byte)
+	trie := NewTrie(NewMemTrieStore())
+	for k := 0; k < 300; k++ {
+		key := make([]byte, 1+rng.Intn(4))
+		rng.Read(key)
+		values[string(key)] = makeValue(rng.Intn(50) + 1)
+		trie = trie.Put(key, values[string(key)])
+	}
+	var keys []string
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	randomBound := func() []byte {
+		if rng.Intn(5) == 0 {
+			return nil
+		}
+		b := make([]byte, 1+rng.Intn(3))
+		rng.Read(b)
+		return b
+	}
+
+	for i := 0; i < 100; i++ {
+		start, end := randomBound(), randomBound()
+		var expected []string
+		for _, k := range keys {
+			if (start == nil || k >= string(start)) && (end == nil || k < string(end)) {
+				expected = append(expected, k)
+			}
+		}
+
+		got := collectRange(t, trie.GetRangeIterator(start, end))
+		if len(got) != len(expected) {
+			t.Fatalf("Range [%x, %x): got %d keys, want %d", start, end, len(got), len(expected))
+		}
+		for j, kv := range got {
+			if string(kv.Key) != expected[j] || !bytes.Equal(kv.Value, values[expected[j]]) {
+				t.Fatalf("Range [%x, %x) entry %d: got %x, want %x", start, end, j, kv.Key, expected[j])
+			}
+		}
+	}
+}
+
+func TestPrefixIteratorListsContractStorage(t *testing.T) {
+	mapper := NewTrieKeyMapper()
+	contract := common.HexToAddress("0x77045E71a7A2c50903d88e564cD72fab11e82051")
+	other := common.HexToAddress("0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826")
+
+	trie := NewTrie(NewMemTrieStore())
+	for _, addr := range []common.Address{contract, other} {
+		trie = trie.Put(mapper.GetAccountKey(addr), []byte{0x01})
+		trie = trie.Put(mapper.GetCodeKey(addr), []byte{0x60, 0x80})
+		for slot := 0; slot < 20; slot++ {
+			trie = trie.Put(mapper.GetAccountStorageKey(addr, common.BytesToHash([]byte{byte(slot)})), []byte{byte(slot + 1)})
+		}
+	}
+
+	storage := collectRange(t, trie.GetPrefixIterator(mapper.GetAccountStoragePrefixKey(contract)))
+	if len(storage) != 20 {
+		t.Fatalf("Expected 20 storage slots, got %d", len(storage))
+	}
+	for _, kv := range storage {
+		if !bytes.HasPrefix(kv.Key, mapper.GetAccountStoragePrefixKey(contract)) {
+			t.Errorf("Key %x is outside the storage prefix", kv.Key)
+		}
+	}
+
+	accounts := collectRange(t, trie.GetPrefixIterator(DomainPrefix))
+	if len(accounts) != 2*(2+20) {
+		t.Errorf("Expected every account entry under the domain prefix, got %d", len(accounts))
+	}
+}
+
+func TestRangeIteratorSeeksWithoutLoadingTrie(t *testing.T) {
+	store := &countingTrieStore{MemTrieStore: NewMemTrieStore()}
+	trie := NewTrie(store)
+	for k := 0; k < 1000; k++ {
+		trie = trie.Put([]byte(fmt.Sprintf("key%04d", k)), makeValue(k%32+1))
+	}
+	trie.Save(store)
+	reopened, err := NewTrieFromStore(store, trie.GetHash())
+	if err != nil {
+		t.Fatalf("NewTrieFromStore failed: %v", err)
+	}
+
+	store.retrieved = 0
+	kvs := collectRange(t, reopened.GetRangeIterator([]byte("key0500"), []byte("key0503")))
+	if len(kvs) != 3 || string(kvs[0].Key) != "key0500" || string(kvs[2].Key) != "key0502" {
+		t.Fatalf("Unexpected range result: %v", kvs)
+	}
+	if store.retrieved > 50 {
+		t.Errorf("Expected the iterator to seek, loaded %d nodes", store.retrieved)
+	}
+}
+
+func TestRangeIteratorReportsMissingNode(t *testing.T) {
+	trie := NewTrie(nil)
+	for k := 0; k < 10; k++ {
+		trie = trie.Put([]byte(fmt.Sprintf("key%d", k)), makeValue(40))
+	}
+
+	// Decode the root against a store that holds none of its children
+	reopened, err := FromMessage(trie.ToMessage(), NewMemTrieStore())
+	if err != nil {
+		t.Fatalf("FromMessage failed: %v", err)
+	}
+
+	it := reopened.GetRangeIterator(nil, nil)
+	for it.HasNext() {
+		it.Next()
+	}
+	if it.Err() == nil {
+		t.Error("Expected an error for the missing nodes")
+	}
+}
@@ -0,0 +1,97 @@
+package rsktrie
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Orchid message flags
+const (
+	orchidFlagSecure    = 0x01
+	orchidFlagLongValue = 0x02
+)
+
+// GetHashOrchid returns the hash of the node in the Orchid (pre-RSKIP-107)
+// serialization. RSKj still uses it for the tx and receipt trie roots of
+// blocks mined before RSKIP-126.
+func (t *Trie) GetHashOrchid(isSecure bool) []byte {
+	t.mu.Lock()
+	cached, cachedSecure := t.hashOrchid, t.hashOrchidSecure
+	t.mu.Unlock()
+	if cached != nil && cachedSecure == isSecure {
+		return cached
+	}
+
+	if t.IsEmptyTrie() {
+		val := make([]byte, 32)
+		copy(val, EmptyHash)
+		return val
+	}
+
+	hash := Keccak256(t.ToMessageOrchid(isSecure))
+	t.mu.Lock()
+	t.hashOrchid = hash
+	t.hashOrchidSecure = isSecure
+	t.mu.Unlock()
+	return hash
+}
+
+// ToMessageOrchid serializes the node in the Orchid format read by fromMessageOrchid:
+//
+//	arity(1) | flags(1) | child bits(2) | lshared(2) | encoded path | child hashes | value or value hash
+//
+// Children are always referenced by their Orchid hash; there are no embedded nodes.
+func (t *Trie) ToMessageOrchid(isSecure bool) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteByte(2) // arity
+
+	var flags byte
+	if isSecure {
+		flags |= orchidFlagSecure
+	}
+	hasLongVal := t.HasLongValue()
+	if hasLongVal {
+		flags |= orchidFlagLongValue
+	}
+	buf.WriteByte(flags)
+
+	leftHash := t.left.GetHashOrchid(isSecure)
+	rightHash := t.right.GetHashOrchid(isSecure)
+	var bits uint16
+	if leftHash != nil {
+		bits |= 0b01
+	}
+	if rightHash != nil {
+		bits |= 0b10
+	}
+	buf.Write(binary.BigEndian.AppendUint16(nil, bits))
+
+	lshared := t.sharedPath.Length()
+	buf.Write(binary.BigEndian.AppendUint16(nil, uint16(lshared)))
+	if lshared > 0 {
+		buf.Write(t.sharedPath.Encode())
+	}
+
+	buf.Write(leftHash)
+	buf.Write(rightHash)
+
+	if t.valueLength > 0 {
+		if hasLongVal {
+			buf.Write(t.GetValueHash())
+		} else {
+			buf.Write(t.GetValue())
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// GetHashOrchid returns the Orchid hash of the referenced node, or nil if the
+// reference is empty.
+func (n *NodeReference) GetHashOrchid(isSecure bool) []byte {
+	node := n.GetNode()
+	if node == nil {
+		return nil
+	}
+	return node.GetHashOrchid(isSecure)
+}
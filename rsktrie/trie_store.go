@@ -2,6 +2,7 @@ package rsktrie
 
 import (
 	"encoding/hex"
+	"sync"
 )
 
 type TrieStore interface {
@@ -10,7 +11,10 @@ type TrieStore interface {
 	RetrieveValue(hash []byte) []byte
 }
 
+// MemTrieStore is an in-memory TrieStore. It is safe for concurrent use, so
+// a single store can back tries that are read from several goroutines.
 type MemTrieStore struct {
+	mu     sync.RWMutex
 	nodes  map[string]*Trie
 	values map[string][]byte
 }
@@ -26,9 +30,17 @@ func (s *MemTrieStore) Save(t *Trie) {
 	if t == nil {
 		return
 	}
+	// Hashing may retrieve children from this store, so it is done before locking
 	hash := t.GetHash()
 	key := hex.EncodeToString(hash)
+	s.mu.Lock()
 	s.nodes[key] = t
+	s.mu.Unlock()
+
+	// Long values live in the value space, keyed by their hash
+	if value, _, _ := t.lazyFields(); t.HasLongValue() && value != nil {
+		s.AddValue(t.GetValueHash(), value)
+	}
 	t.saved = true
 }
 
@@ -37,6 +49,8 @@ func (s *MemTrieStore) Retrieve(hash []byte) *Trie {
 		return nil
 	}
 	key := hex.EncodeToString(hash)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.nodes[key]
 }
 
@@ -45,7 +59,9 @@ func (s *MemTrieStore) RetrieveValue(hash []byte) []byte {
 		return nil
 	}
 	key := hex.EncodeToString(hash)
+	s.mu.RLock()
 	val := s.values[key]
+	s.mu.RUnlock()
 	// Return copy?
 	if val == nil {
 		return nil
@@ -59,5 +75,7 @@ func (s *MemTrieStore) AddValue(hash []byte, val []byte) {
 	key := hex.EncodeToString(hash)
 	v := make([]byte, len(val))
 	copy(v, val)
+	s.mu.Lock()
 	s.values[key] = v
+	s.mu.Unlock()
 }
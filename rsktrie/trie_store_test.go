@@ -0,0 +1,176 @@
+package rsktrie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestSaveStoresLongValue(t *testing.T) {
+	store := NewMemTrieStore()
+	value := makeValue(100)
+	trie := NewTrie(store).Put([]byte("foo"), value)
+
+	store.Save(trie)
+
+	if !bytes.Equal(store.RetrieveValue(Keccak256(value)), value) {
+		t.Error("Expected long value to be saved by value hash")
+	}
+}
+
+func TestSaveDoesNotStoreShortValue(t *testing.T) {
+	store := NewMemTrieStore()
+	value := makeValue(32)
+	trie := NewTrie(store).Put([]byte("foo"), value)
+
+	store.Save(trie)
+
+	if store.RetrieveValue(Keccak256(value)) != nil {
+		t.Error("Expected short value to stay embedded in the node")
+	}
+}
+
+func TestGetLongValueFromDeserializedNode(t *testing.T) {
+	store := NewMemTrieStore()
+	value := makeValue(100)
+	trie := NewTrie(store).Put([]byte("foo"), value)
+	store.Save(trie)
+
+	node, err := FromMessage(trie.ToMessage(), store)
+	if err != nil {
+		t.Fatalf("FromMessage failed: %v", err)
+	}
+
+	got, err := node.TryGet([]byte("foo"))
+	if err != nil {
+		t.Fatalf("TryGet failed: %v", err)
+	}
+	if !bytes.Equal(got, value) {
+		t.Error("Long value mismatch")
+	}
+	if !bytes.Equal(node.Get([]byte("foo")), value) {
+		t.Error("Long value mismatch using Get")
+	}
+	if !bytes.Equal(node.GetHash(), trie.GetHash()) {
+		t.Error("Hash mismatch after deserialization")
+	}
+}
+
+func TestGetMissingLongValueReturnsError(t *testing.T) {
+	trie := NewTrie(NewMemTrieStore()).Put([]byte("foo"), makeValue(100))
+
+	node, err := FromMessage(trie.ToMessage(), NewMemTrieStore())
+	if err != nil {
+		t.Fatalf("FromMessage failed: %v", err)
+	}
+
+	_, err = node.TryGetValue()
+	if !errors.Is(err, ErrLongValueNotFound) {
+		t.Errorf("Expected ErrLongValueNotFound, got %v", err)
+	}
+	if node.GetValue() != nil {
+		t.Error("Expected nil value from GetValue")
+	}
+}
+
+func TestGetCorruptedLongValueReturnsError(t *testing.T) {
+	value := makeValue(100)
+	trie := NewTrie(NewMemTrieStore()).Put([]byte("foo"), value)
+
+	store := NewMemTrieStore()
+	corrupted := makeValue(100)
+	corrupted[0] ^= 0xff
+	store.AddValue(Keccak256(value), corrupted)
+
+	node, err := FromMessage(trie.ToMessage(), store)
+	if err != nil {
+		t.Fatalf("FromMessage failed: %v", err)
+	}
+
+	_, err = node.TryGetValue()
+	if !errors.Is(err, ErrLongValueMismatch) {
+		t.Errorf("Expected ErrLongValueMismatch, got %v", err)
+	}
+}
+
+func TestSaveAndReopenTrieByRootHash(t *testing.T) {
+	store := NewMemTrieStore()
+	trie := NewTrie(nil)
+	for k := 0; k < 100; k++ {
+		trie = trie.Put([]byte(fmt.Sprintf("key%d", k)), makeValue(k+1))
+	}
+	rootHash := trie.GetHash()
+
+	trie.Save(store)
+
+	if !trie.WasSaved() {
+		t.Error("Expected root to be marked as saved")
+	}
+	for _, ref := range []*NodeReference{trie.GetLeft(), trie.GetRight()} {
+		if !ref.IsEmpty() && !ref.IsEmbeddable() && ref.lazyNode != nil {
+			t.Error("Expected saved child reference to keep only its hash")
+		}
+	}
+
+	reopened, err := NewTrieFromStore(store, rootHash)
+	if err != nil {
+		t.Fatalf("NewTrieFromStore failed: %v", err)
+	}
+	if !bytes.Equal(reopened.GetHash(), rootHash) {
+		t.Errorf("Root hash mismatch: got %x, want %x", reopened.GetHash(), rootHash)
+	}
+	for k := 0; k < 100; k++ {
+		got, err := reopened.TryGet([]byte(fmt.Sprintf("key%d", k)))
+		if err != nil {
+			t.Fatalf("TryGet failed: %v", err)
+		}
+		if !bytes.Equal(got, makeValue(k+1)) {
+			t.Errorf("Value mismatch for key%d", k)
+		}
+	}
+}
+
+func TestSaveOnlyWritesUnsavedNodes(t *testing.T) {
+	store := NewMemTrieStore()
+	trie := NewTrie(store)
+	for k := 0; k < 50; k++ {
+		trie = trie.Put([]byte(fmt.Sprintf("key%d", k)), makeValue(50))
+	}
+	trie.Save(store)
+	saved := len(store.nodes)
+
+	trie.Save(store)
+	if len(store.nodes) != saved {
+		t.Errorf("Expected no new nodes on second save, got %d more", len(store.nodes)-saved)
+	}
+
+	trie = trie.Put([]byte("key7"), makeValue(60))
+	trie.Save(store)
+	if len(store.nodes) == saved {
+		t.Error("Expected modified path to be saved")
+	}
+	if !bytes.Equal(trie.Get([]byte("key7")), makeValue(60)) {
+		t.Error("Value mismatch after second save")
+	}
+	if !bytes.Equal(trie.Get([]byte("key8")), makeValue(50)) {
+		t.Error("Value mismatch for unmodified key after second save")
+	}
+}
+
+func TestReopenEmptyTrie(t *testing.T) {
+	store := NewMemTrieStore()
+	NewTrie(store).Save(store)
+
+	trie, err := NewTrieFromStore(store, EmptyHash)
+	if err != nil {
+		t.Fatalf("NewTrieFromStore failed: %v", err)
+	}
+	if !trie.IsEmptyTrie() {
+		t.Error("Expected empty trie")
+	}
+
+	if _, err := NewTrieFromStore(store, Keccak256([]byte("missing"))); err == nil {
+		t.Error("Expected error for unknown root hash")
+	}
+}
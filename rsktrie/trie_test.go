@@ -14,6 +14,20 @@ func makeValue(size int) []byte {
 	return v
 }
 
+// buildKeyedTestTrie returns a trie of n keys "key0", "key1"... with values
+// of 1 to maxValueLen bytes, mixing embeddable and long values, and its
+// contents by key
+func buildKeyedTestTrie(n, maxValueLen int) (*Trie, map[string][]byte) {
+	values := make(map[string][]byte, n)
+	trie := NewTrie(NewMemTrieStore())
+	for k := 0; k < n; k++ {
+		key := fmt.Sprintf("key%d", k)
+		values[key] = makeValue(k%maxValueLen + 1)
+		trie = trie.Put([]byte(key), values[key])
+	}
+	return trie, values
+}
+
 func TestGetNullForUnknownKey(t *testing.T) {
 	store := NewMemTrieStore()
 	trie := NewTrie(store)
@@ -151,3 +165,146 @@ func TestPutAndGetOneHundredKeyValues(t *testing.T) {
 		}
 	}
 }
+
+func TestPutKeyValueAndDeleteKeyGivesEmptyTrie(t *testing.T) {
+	trie := NewTrie(NewMemTrieStore())
+
+	trie = trie.Put([]byte("foo"), []byte("bar"))
+	trie = trie.Delete([]byte("foo"))
+
+	if !trie.IsEmptyTrie() {
+		t.Error("Expected empty trie after deleting its only key")
+	}
+	if !bytes.Equal(trie.GetHash(), EmptyHash) {
+		t.Errorf("Expected empty hash, got %x", trie.GetHash())
+	}
+}
+
+func TestDeleteNonExistentKeyReturnsSameTrie(t *testing.T) {
+	trie := NewTrie(NewMemTrieStore())
+
+	trie = trie.Put([]byte("foo"), []byte("bar"))
+	trie = trie.Put([]byte("bar"), []byte("foo"))
+
+	if trie.Delete([]byte("baz")) != trie {
+		t.Error("Expected same trie when deleting a missing key")
+	}
+	if trie.Delete([]byte("fo")) != trie {
+		t.Error("Expected same trie when deleting a valueless prefix")
+	}
+}
+
+func TestDeleteCoalescesValuelessNodeWithSingleChild(t *testing.T) {
+	trie := NewTrie(NewMemTrieStore())
+
+	trie = trie.Put([]byte("foo"), []byte("bar"))
+	trie = trie.Put([]byte("fox"), []byte("baz"))
+	if trie.TrieSize() != 3 {
+		t.Fatalf("Expected 3 nodes before delete, got %d", trie.TrieSize())
+	}
+
+	trie = trie.Delete([]byte("fox"))
+
+	if trie.TrieSize() != 1 {
+		t.Errorf("Expected 1 node after delete, got %d", trie.TrieSize())
+	}
+	if trie.GetSharedPath().Length() != 24 {
+		t.Errorf("Expected shared path of 24 bits, got %d", trie.GetSharedPath().Length())
+	}
+	if !bytes.Equal(trie.Get([]byte("foo")), []byte("bar")) {
+		t.Error("foo mismatch")
+	}
+}
+
+func TestDeleteKeyAndSubKeyValues(t *testing.T) {
+	expected := NewTrie(NewMemTrieStore()).Put([]byte("foo"), []byte("bar"))
+
+	trie := NewTrie(NewMemTrieStore())
+	trie = trie.Put([]byte("foo"), []byte("bar"))
+	trie = trie.Put([]byte("f"), []byte("42"))
+	trie = trie.Delete([]byte("f"))
+
+	if trie.Get([]byte("f")) != nil {
+		t.Error("Expected nil after delete")
+	}
+	assertSameNodes(t, trie, expected)
+}
+
+func TestDeleteRestoresTrieWithoutKey(t *testing.T) {
+	expected := NewTrie(NewMemTrieStore())
+	trie := NewTrie(NewMemTrieStore())
+
+	for k := 0; k < 100; k++ {
+		key := []byte(fmt.Sprintf("%d", k))
+		trie = trie.Put(key, makeValue(k+1))
+		if k%2 == 1 {
+			expected = expected.Put(key, makeValue(k+1))
+		}
+	}
+
+	for k := 0; k < 100; k += 2 {
+		trie = trie.Delete([]byte(fmt.Sprintf("%d", k)))
+	}
+
+	assertSameNodes(t, trie, expected)
+	if !bytes.Equal(trie.GetHash(), expected.GetHash()) {
+		t.Errorf("Hash mismatch: got %x, want %x", trie.GetHash(), expected.GetHash())
+	}
+
+	for k := 1; k < 100; k += 2 {
+		trie = trie.Delete([]byte(fmt.Sprintf("%d", k)))
+	}
+
+	if !trie.IsEmptyTrie() {
+		t.Error("Expected empty trie after deleting all keys")
+	}
+}
+
+// assertSameNodes checks that both tries have the same nodes, paths and values in pre-order.
+func assertSameNodes(t *testing.T, trie, expected *Trie) {
+	t.Helper()
+	it := trie.GetPreOrderIterator()
+	expectedIt := expected.GetPreOrderIterator()
+	for expectedIt.HasNext() {
+		if !it.HasNext() {
+			t.Fatal("Trie has fewer nodes than expected")
+		}
+		el := it.Next()
+		expectedEl := expectedIt.Next()
+		if el.String() != expectedEl.String() {
+			t.Fatalf("Node key mismatch: got %s, want %s", el, expectedEl)
+		}
+		if !bytes.Equal(el.GetNode().GetValue(), expectedEl.GetNode().GetValue()) {
+			t.Fatalf("Value mismatch at %s", el)
+		}
+	}
+	if it.HasNext() {
+		t.Fatal("Trie has more nodes than expected")
+	}
+}
+
+func TestFromMessageWithVarIntSharedPathLength(t *testing.T) {
+	// Shared paths of 33 to 159 bits encode their length as 0xff + VarInt
+	for _, bits := range []int{33, 87, 159} {
+		key := make([]byte, (bits+7)/8)
+		for i := range key {
+			key[i] = byte(i*37 + 1)
+		}
+		node := NewTrieFull(nil, TrieKeySliceFromKey(key).Slice(0, bits), []byte{0x2a},
+			NodeReferenceEmpty(), NodeReferenceEmpty(), 1, nil, nil)
+
+		decoded, err := FromMessage(node.ToMessage(), nil)
+		if err != nil {
+			t.Fatalf("FromMessage failed for %d bits: %v", bits, err)
+		}
+		if decoded.GetSharedPath().Length() != bits {
+			t.Errorf("Shared path length: got %d, want %d", decoded.GetSharedPath().Length(), bits)
+		}
+		if !bytes.Equal(decoded.GetValue(), []byte{0x2a}) {
+			t.Errorf("Value lost after a %d bit shared path: got %x", bits, decoded.GetValue())
+		}
+		if !bytes.Equal(decoded.GetHash(), node.GetHash()) {
+			t.Errorf("Hash mismatch for %d bits", bits)
+		}
+	}
+}